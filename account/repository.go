@@ -2,7 +2,10 @@ package account
 
 import (
 	"fmt"
+	"net"
 	"smppizdez/coding"
+	"strconv"
+	"time"
 )
 
 type Account struct {
@@ -10,11 +13,189 @@ type Account struct {
 	Host          string
 	Port          uint16
 	TLS           bool
+	TLSSettings   TLSSettings
 	SystemID      string
 	Password      string
 	SystemType    string
 	BindType      BindType
 	DefaultCoding coding.Coding
+	Reconnect     ReconnectPolicy
+	Timing        SessionTiming
+	Window        WindowPolicy
+	Throughput    Throughput
+	Binds         BindPool
+	// Fallbacks are tried in order when the primary endpoint fails to
+	// connect or bind.
+	Fallbacks []Endpoint
+	Proxy     Proxy
+}
+
+// Proxy is used to reach SMSC endpoints, which are resolved by the proxy
+// itself. Zero Type connects directly.
+type Proxy struct {
+	Type     ProxyType
+	Host     string
+	Port     uint16
+	Username string
+	Password string
+}
+
+func (p Proxy) Address() string {
+	return net.JoinHostPort(p.Host, strconv.Itoa(int(p.Port)))
+}
+
+type ProxyType int
+
+const (
+	SOCKS5 ProxyType = iota + 1
+	HTTPConnect
+)
+
+func (t ProxyType) String() string {
+	switch t {
+	case SOCKS5:
+		return "SOCKS5"
+	case HTTPConnect:
+		return "HTTP CONNECT"
+	default:
+		return fmt.Sprintf("unknown proxy type (%d)", t)
+	}
+}
+
+// TLSSettings customize TLS connections of the account. Zero value uses
+// system roots and TLS 1.2 or newer.
+type TLSSettings struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	MinVersion         TLSVersion
+	MaxVersion         TLSVersion
+	InsecureSkipVerify bool
+	// PinnedSHA256 are hex-encoded SHA-256 fingerprints of server
+	// certificates, one of which must match the leaf certificate.
+	PinnedSHA256 []string
+}
+
+type TLSVersion int
+
+const (
+	TLS10 TLSVersion = iota + 1
+	TLS11
+	TLS12
+	TLS13
+)
+
+func (v TLSVersion) String() string {
+	switch v {
+	case TLS10:
+		return "TLS 1.0"
+	case TLS11:
+		return "TLS 1.1"
+	case TLS12:
+		return "TLS 1.2"
+	case TLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("unknown TLS version (%d)", v)
+	}
+}
+
+type Endpoint struct {
+	Host string
+	Port uint16
+}
+
+func (e Endpoint) String() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(int(e.Port)))
+}
+
+// Endpoints returns the primary endpoint followed by fallbacks.
+func (a *Account) Endpoints() []Endpoint {
+	return append([]Endpoint{{Host: a.Host, Port: a.Port}}, a.Fallbacks...)
+}
+
+// BindPool opens several binds of the account at once. Messages are spread
+// across them, while all segments of a message go over the same bind.
+// Window and throughput limits apply to every bind separately.
+type BindPool struct {
+	Count     int
+	Balancing Balancing
+}
+
+type Balancing int
+
+const (
+	RoundRobin Balancing = iota + 1
+	LeastLoaded
+)
+
+func (b Balancing) String() string {
+	switch b {
+	case RoundRobin:
+		return "Round robin"
+	case LeastLoaded:
+		return "Least loaded"
+	default:
+		return fmt.Sprintf("unknown balancing (%d)", b)
+	}
+}
+
+// Throughput limits the rate of submit_sm requests per session. Zero TPS
+// disables the limit, while throttling responses are retried regardless of
+// it.
+type Throughput struct {
+	TPS        int
+	Burst      int
+	MaxRetries int
+	RetryDelay time.Duration
+}
+
+var DefaultThroughput = Throughput{
+	Burst:      1,
+	MaxRetries: 3,
+	RetryDelay: time.Second,
+}
+
+// WindowPolicy limits the number of submit_sm requests waiting for response.
+// Zero Size disables the limit.
+type WindowPolicy struct {
+	Size          int
+	BlockWhenFull bool
+}
+
+type SessionTiming struct {
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	EnquireLink         time.Duration
+	BindTimeout         time.Duration
+	ResponseTimeout     time.Duration
+	UnbindTimeout       time.Duration
+	EnquireLinkFailures int
+}
+
+var DefaultSessionTiming = SessionTiming{
+	ReadTimeout:         time.Minute,
+	WriteTimeout:        time.Minute,
+	EnquireLink:         30 * time.Second,
+	BindTimeout:         10 * time.Second,
+	ResponseTimeout:     10 * time.Second,
+	UnbindTimeout:       5 * time.Second,
+	EnquireLinkFailures: 3,
+}
+
+type ReconnectPolicy struct {
+	Enabled     bool
+	MaxAttempts int
+	Delay       time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultReconnectPolicy = ReconnectPolicy{
+	Enabled:     true,
+	MaxAttempts: 5,
+	Delay:       time.Second,
+	MaxDelay:    time.Minute,
 }
 
 type BindType int
@@ -23,6 +204,9 @@ const (
 	Transceiver BindType = iota + 1
 	Transmitter
 	Receiver
+	// TransmitterReceiver binds the account twice, as transmitter and as
+	// receiver, for SMSCs that don't support transceiver binds.
+	TransmitterReceiver
 )
 
 func (t BindType) String() string {
@@ -33,6 +217,8 @@ func (t BindType) String() string {
 		return "Transmitter"
 	case Receiver:
 		return "Receiver"
+	case TransmitterReceiver:
+		return "Transmitter + Receiver"
 	default:
 		return fmt.Sprintf("unknown bind type (%d)", t)
 	}
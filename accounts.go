@@ -1,16 +1,28 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"slices"
 	"smppizdez/account"
 	"smppizdez/coding"
+	"smppizdez/sender"
 	"strconv"
+	"strings"
 
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 )
 
-var bindTypes = []account.BindType{account.Transceiver, account.Receiver, account.Transmitter}
+var bindTypes = []account.BindType{
+	account.Transceiver,
+	account.Receiver,
+	account.Transmitter,
+	account.TransmitterReceiver,
+}
 
 func getBindTypeIndex(t account.BindType) int {
 	for i, typ := range bindTypes {
@@ -29,6 +41,8 @@ func bindTypeToString(typ account.BindType) string {
 		return "receiver"
 	case account.Transmitter:
 		return "transmitter"
+	case account.TransmitterReceiver:
+		return "transmitter+receiver"
 	default:
 		return "unknown"
 	}
@@ -36,6 +50,20 @@ func bindTypeToString(typ account.BindType) string {
 
 var defaultCodings = []coding.Coding{coding.GSM7, coding.GSM8}
 
+// tlsVersions has zero version for default at the first position.
+var tlsVersions = []account.TLSVersion{
+	0,
+	account.TLS10,
+	account.TLS11,
+	account.TLS12,
+	account.TLS13,
+}
+
+var balancings = []account.Balancing{account.RoundRobin, account.LeastLoaded}
+
+// proxyTypes has zero type for direct connection at the first position.
+var proxyTypes = []account.ProxyType{0, account.SOCKS5, account.HTTPConnect}
+
 func getDefaultCodingIndex(c coding.Coding) int {
 	for i, cod := range defaultCodings {
 		if c == cod {
@@ -46,17 +74,49 @@ func getDefaultCodingIndex(c coding.Coding) int {
 }
 
 type accountDialog struct {
-	window           *gtk.ApplicationWindow
-	label            *gtk.Label
-	hostEntry        *gtk.Entry
-	portEntry        *gtk.Entry
-	tlsSwitch        *gtk.Switch
-	systemIdEntry    *gtk.Entry
-	passwordEntry    *gtk.Entry
-	systemTypeEntry  *gtk.Entry
-	bindTypeSelector *gtk.ComboBox
-	codingSelector   *gtk.ComboBox
-	callback         func(*account.Account)
+	window            *gtk.ApplicationWindow
+	label             *gtk.Label
+	hostEntry         *gtk.Entry
+	portEntry         *gtk.Entry
+	fallbacksEntry    *gtk.Entry
+	proxyTypeSelector *gtk.ComboBox
+	proxyAddrEntry    *gtk.Entry
+	proxyUserEntry    *gtk.Entry
+	proxyPassEntry    *gtk.Entry
+	tlsSwitch         *gtk.Switch
+	caFileEntry       *gtk.Entry
+	certFileEntry     *gtk.Entry
+	keyFileEntry      *gtk.Entry
+	serverNameEntry   *gtk.Entry
+	minTLSSelector    *gtk.ComboBox
+	maxTLSSelector    *gtk.ComboBox
+	skipVerifySwitch  *gtk.Switch
+	pinsEntry         *gtk.Entry
+	systemIdEntry     *gtk.Entry
+	passwordEntry     *gtk.Entry
+	systemTypeEntry   *gtk.Entry
+	bindTypeSelector  *gtk.ComboBox
+	codingSelector    *gtk.ComboBox
+	reconnectSwitch   *gtk.Switch
+	attemptsEntry     *gtk.Entry
+	delayEntry        *gtk.Entry
+	maxDelayEntry     *gtk.Entry
+	readTimeoutEntry  *gtk.Entry
+	writeTimeoutEntry *gtk.Entry
+	enquireLinkEntry  *gtk.Entry
+	linkFailuresEntry *gtk.Entry
+	bindTimeoutEntry  *gtk.Entry
+	respTimeoutEntry  *gtk.Entry
+	unbindTimeEntry   *gtk.Entry
+	windowSizeEntry   *gtk.Entry
+	windowBlockSwitch *gtk.Switch
+	tpsEntry          *gtk.Entry
+	burstEntry        *gtk.Entry
+	retriesEntry      *gtk.Entry
+	backoffEntry      *gtk.Entry
+	bindsEntry        *gtk.Entry
+	balancingSelector *gtk.ComboBox
+	callback          func(*account.Account)
 }
 
 type accountsContext struct {
@@ -64,6 +124,7 @@ type accountsContext struct {
 	dialog   accountDialog
 	tree     *gtk.TreeView
 	repo     account.Repository
+	sender   sender.Sender
 }
 
 func loadAccounts(ctx *accountsContext) {
@@ -105,6 +166,8 @@ func initAccountsMenu(ctx *accountsContext, builder *gtk.Builder) {
 	editItem.Connect("button_release_event", func() { editAccountHandler(ctx) })
 	delItem := getMenuItemById(builder, "del_account_item")
 	delItem.Connect("button_release_event", func() { deleteAccountHandler(ctx) })
+	testItem := getMenuItemById(builder, "test_account_item")
+	testItem.Connect("button_release_event", func() { testAccountHandler(ctx) })
 }
 
 func accountToIter(store *gtk.ListStore, iter *gtk.TreeIter, account *account.Account) {
@@ -224,23 +287,344 @@ func initAccountDialog(d *accountDialog, builder *gtk.Builder) {
 	d.label = getLabelById(builder, "account_dialog_label")
 	d.hostEntry = getEntryById(builder, "account_dialog_host_entry")
 	d.portEntry = getEntryById(builder, "account_dialog_port_entry")
+	d.fallbacksEntry = getEntryById(builder, "account_dialog_fallbacks_entry")
+	d.proxyTypeSelector = getComboById(builder, "account_dialog_proxy_type_selector")
+	d.proxyAddrEntry = getEntryById(builder, "account_dialog_proxy_address_entry")
+	d.proxyUserEntry = getEntryById(builder, "account_dialog_proxy_username_entry")
+	d.proxyPassEntry = getEntryById(builder, "account_dialog_proxy_password_entry")
 	d.tlsSwitch = getSwitchById(builder, "account_dialog_tls_switch")
+	d.caFileEntry = getEntryById(builder, "account_dialog_tls_ca_entry")
+	d.certFileEntry = getEntryById(builder, "account_dialog_tls_cert_entry")
+	d.keyFileEntry = getEntryById(builder, "account_dialog_tls_key_entry")
+	d.serverNameEntry = getEntryById(builder, "account_dialog_tls_server_name_entry")
+	d.minTLSSelector = getComboById(builder, "account_dialog_tls_min_version_selector")
+	d.maxTLSSelector = getComboById(builder, "account_dialog_tls_max_version_selector")
+	d.skipVerifySwitch = getSwitchById(builder, "account_dialog_tls_skip_verify_switch")
+	d.pinsEntry = getEntryById(builder, "account_dialog_tls_pins_entry")
 	d.systemIdEntry = getEntryById(builder, "account_dialog_system_id_entry")
 	d.passwordEntry = getEntryById(builder, "account_dialog_password_entry")
 	d.systemTypeEntry = getEntryById(builder, "account_dialog_system_type_entry")
 	d.bindTypeSelector = getComboById(builder, "account_dialog_bind_type_selector")
 	d.codingSelector = getComboById(builder, "account_dialog_coding_selector")
+	d.reconnectSwitch = getSwitchById(builder, "account_dialog_reconnect_switch")
+	d.attemptsEntry = getEntryById(builder, "account_dialog_reconnect_attempts_entry")
+	d.delayEntry = getEntryById(builder, "account_dialog_reconnect_delay_entry")
+	d.maxDelayEntry = getEntryById(builder, "account_dialog_reconnect_max_delay_entry")
+	d.readTimeoutEntry = getEntryById(builder, "account_dialog_read_timeout_entry")
+	d.writeTimeoutEntry = getEntryById(builder, "account_dialog_write_timeout_entry")
+	d.enquireLinkEntry = getEntryById(builder, "account_dialog_enquire_link_entry")
+	d.linkFailuresEntry = getEntryById(builder, "account_dialog_enquire_link_failures_entry")
+	d.bindTimeoutEntry = getEntryById(builder, "account_dialog_bind_timeout_entry")
+	d.respTimeoutEntry = getEntryById(builder, "account_dialog_response_timeout_entry")
+	d.unbindTimeEntry = getEntryById(builder, "account_dialog_unbind_timeout_entry")
+	d.windowSizeEntry = getEntryById(builder, "account_dialog_window_size_entry")
+	d.windowBlockSwitch = getSwitchById(builder, "account_dialog_window_block_switch")
+	d.tpsEntry = getEntryById(builder, "account_dialog_tps_entry")
+	d.burstEntry = getEntryById(builder, "account_dialog_burst_entry")
+	d.retriesEntry = getEntryById(builder, "account_dialog_throttle_retries_entry")
+	d.backoffEntry = getEntryById(builder, "account_dialog_throttle_backoff_entry")
+	d.bindsEntry = getEntryById(builder, "account_dialog_binds_entry")
+	d.balancingSelector = getComboById(builder, "account_dialog_balancing_selector")
+	d.reconnectSwitch.Connect("state-set", func(_ *gtk.Switch, state bool) bool {
+		d.setReconnectSensitive(state)
+		return false
+	})
+	d.tlsSwitch.Connect("state-set", func(_ *gtk.Switch, state bool) bool {
+		d.setTLSSensitive(state)
+		return false
+	})
+	d.proxyTypeSelector.Connect("changed", func() {
+		d.setProxySensitive(getComboIndex(d.proxyTypeSelector) != 0)
+	})
+}
+
+func (d *accountDialog) setProxySensitive(sensitive bool) {
+	d.proxyAddrEntry.SetSensitive(sensitive)
+	d.proxyUserEntry.SetSensitive(sensitive)
+	d.proxyPassEntry.SetSensitive(sensitive)
+}
+
+func (d *accountDialog) setProxy(p account.Proxy) {
+	d.proxyTypeSelector.SetActive(max(slices.Index(proxyTypes, p.Type), 0))
+	if p.Type != 0 {
+		d.proxyAddrEntry.SetText(p.Address())
+	} else {
+		d.proxyAddrEntry.SetText("")
+	}
+	d.proxyUserEntry.SetText(p.Username)
+	d.proxyPassEntry.SetText(p.Password)
+	d.setProxySensitive(p.Type != 0)
+}
+
+func (d *accountDialog) getProxy() (account.Proxy, bool) {
+	p := account.Proxy{Type: proxyTypes[getComboIndex(d.proxyTypeSelector)]}
+	if p.Type == 0 {
+		return p, true
+	}
+
+	addr, _ := d.proxyAddrEntry.GetText()
+	host, portStr, err := net.SplitHostPort(strings.TrimSpace(addr))
+	if err != nil {
+		markInvalidEntry(&d.proxyAddrEntry.Widget, "Proxy address must be host:port")
+		return p, false
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || host == "" {
+		markInvalidEntry(&d.proxyAddrEntry.Widget, "Proxy address must be host:port")
+		return p, false
+	}
+	p.Host = host
+	p.Port = uint16(port)
+	p.Username, _ = d.proxyUserEntry.GetText()
+	p.Password, _ = d.proxyPassEntry.GetText()
+
+	if p.Type == account.SOCKS5 && (len(p.Username) > 255 || len(p.Password) > 255) {
+		markInvalidEntry(
+			&d.proxyUserEntry.Widget,
+			"SOCKS5 username and password must not exceed 255 bytes",
+		)
+		return p, false
+	}
+	return p, true
+}
+
+func (d *accountDialog) setTLSSensitive(sensitive bool) {
+	d.caFileEntry.SetSensitive(sensitive)
+	d.certFileEntry.SetSensitive(sensitive)
+	d.keyFileEntry.SetSensitive(sensitive)
+	d.serverNameEntry.SetSensitive(sensitive)
+	d.minTLSSelector.SetSensitive(sensitive)
+	d.maxTLSSelector.SetSensitive(sensitive)
+	d.skipVerifySwitch.SetSensitive(sensitive)
+	d.pinsEntry.SetSensitive(sensitive)
+}
+
+func (d *accountDialog) setTLSSettings(enabled bool, s account.TLSSettings) {
+	d.tlsSwitch.SetActive(enabled)
+	d.caFileEntry.SetText(s.CAFile)
+	d.certFileEntry.SetText(s.CertFile)
+	d.keyFileEntry.SetText(s.KeyFile)
+	d.serverNameEntry.SetText(s.ServerName)
+	d.minTLSSelector.SetActive(max(slices.Index(tlsVersions, s.MinVersion), 0))
+	d.maxTLSSelector.SetActive(max(slices.Index(tlsVersions, s.MaxVersion), 0))
+	d.skipVerifySwitch.SetActive(s.InsecureSkipVerify)
+	d.pinsEntry.SetText(strings.Join(s.PinnedSHA256, ", "))
+	d.setTLSSensitive(enabled)
+}
+
+func (d *accountDialog) getTLSSettings() (account.TLSSettings, bool) {
+	s := account.TLSSettings{
+		MinVersion:         tlsVersions[getComboIndex(d.minTLSSelector)],
+		MaxVersion:         tlsVersions[getComboIndex(d.maxTLSSelector)],
+		InsecureSkipVerify: d.skipVerifySwitch.GetActive(),
+	}
+	s.CAFile, _ = d.caFileEntry.GetText()
+	s.CertFile, _ = d.certFileEntry.GetText()
+	s.KeyFile, _ = d.keyFileEntry.GetText()
+	s.ServerName, _ = d.serverNameEntry.GetText()
+
+	isValid := true
+	if (s.CertFile == "") != (s.KeyFile == "") {
+		markInvalidEntry(
+			&d.keyFileEntry.Widget,
+			"Client certificate and key must be set together",
+		)
+		isValid = false
+	}
+	if s.MinVersion != 0 && s.MaxVersion != 0 && s.MinVersion > s.MaxVersion {
+		markInvalidEntry(
+			&d.maxTLSSelector.Widget,
+			"Max TLS version must not be less than min TLS version",
+		)
+		isValid = false
+	}
+
+	pins, _ := d.pinsEntry.GetText()
+	for _, pin := range strings.Split(pins, ",") {
+		pin = strings.TrimSpace(pin)
+		if pin == "" {
+			continue
+		}
+
+		raw, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+		if err != nil || len(raw) != sha256.Size {
+			markInvalidEntry(&d.pinsEntry.Widget, fmt.Sprintf("Invalid SHA-256 fingerprint %s", pin))
+			isValid = false
+			break
+		}
+		s.PinnedSHA256 = append(s.PinnedSHA256, pin)
+	}
+
+	return s, isValid
+}
+
+func (d *accountDialog) setReconnectSensitive(sensitive bool) {
+	d.attemptsEntry.SetSensitive(sensitive)
+	d.delayEntry.SetSensitive(sensitive)
+	d.maxDelayEntry.SetSensitive(sensitive)
+}
+
+func (d *accountDialog) setReconnectPolicy(policy account.ReconnectPolicy) {
+	d.reconnectSwitch.SetActive(policy.Enabled)
+	d.attemptsEntry.SetText(strconv.Itoa(policy.MaxAttempts))
+	d.delayEntry.SetText(policy.Delay.String())
+	d.maxDelayEntry.SetText(policy.MaxDelay.String())
+	d.setReconnectSensitive(policy.Enabled)
+}
+
+func (d *accountDialog) setTiming(timing account.SessionTiming) {
+	d.readTimeoutEntry.SetText(timing.ReadTimeout.String())
+	d.writeTimeoutEntry.SetText(timing.WriteTimeout.String())
+	d.enquireLinkEntry.SetText(timing.EnquireLink.String())
+	d.linkFailuresEntry.SetText(strconv.Itoa(timing.EnquireLinkFailures))
+	d.bindTimeoutEntry.SetText(timing.BindTimeout.String())
+	d.respTimeoutEntry.SetText(timing.ResponseTimeout.String())
+	d.unbindTimeEntry.SetText(timing.UnbindTimeout.String())
+}
+
+func (d *accountDialog) setThroughput(t account.Throughput) {
+	d.tpsEntry.SetText(strconv.Itoa(t.TPS))
+	d.burstEntry.SetText(strconv.Itoa(t.Burst))
+	d.retriesEntry.SetText(strconv.Itoa(t.MaxRetries))
+	d.backoffEntry.SetText(t.RetryDelay.String())
+}
+
+func (d *accountDialog) getThroughput() (account.Throughput, bool) {
+	var throughput account.Throughput
+	isValid := true
+
+	tps, ok := checkEntryNumerical(d.tpsEntry, 16, "TPS limit")
+	isValid = isValid && ok
+	throughput.TPS = int(tps)
+
+	burst, ok := checkEntryNumerical(d.burstEntry, 16, "Burst")
+	isValid = isValid && ok
+	if ok && burst == 0 {
+		markInvalidEntry(&d.burstEntry.Widget, "Burst must be greater than zero")
+		isValid = false
+	}
+	throughput.Burst = int(burst)
+
+	retries, ok := checkEntryNumerical(d.retriesEntry, 8, "Throttling retries")
+	isValid = isValid && ok
+	throughput.MaxRetries = int(retries)
+
+	throughput.RetryDelay, ok = checkEntryDuration(d.backoffEntry, "Throttling backoff")
+	if ok && throughput.MaxRetries > 0 && throughput.RetryDelay == 0 {
+		markInvalidEntry(&d.backoffEntry.Widget, "Throttling backoff must be greater than zero when retries are enabled")
+		ok = false
+	}
+	isValid = isValid && ok
+
+	return throughput, isValid
+}
+
+func (d *accountDialog) getTiming() (account.SessionTiming, bool) {
+	var timing account.SessionTiming
+	var ok bool
+	isValid := true
+
+	timing.ReadTimeout, ok = checkEntryDuration(d.readTimeoutEntry, "Read timeout")
+	isValid = isValid && ok
+	if ok && timing.ReadTimeout == 0 {
+		markInvalidEntry(&d.readTimeoutEntry.Widget, "Read timeout must be greater than zero")
+		isValid = false
+	}
+
+	timing.WriteTimeout, ok = checkEntryDuration(d.writeTimeoutEntry, "Write timeout")
+	isValid = isValid && ok
+
+	timing.EnquireLink, ok = checkEntryDuration(d.enquireLinkEntry, "Enquire link interval")
+	isValid = isValid && ok
+	if ok && timing.EnquireLink >= timing.ReadTimeout && timing.ReadTimeout > 0 {
+		markInvalidEntry(
+			&d.enquireLinkEntry.Widget,
+			"Enquire link interval must be less than read timeout",
+		)
+		isValid = false
+	}
+
+	failures, ok := checkEntryNumerical(d.linkFailuresEntry, 16, "Enquire link failures")
+	isValid = isValid && ok
+	timing.EnquireLinkFailures = int(failures)
+
+	timing.BindTimeout, ok = checkEntryDuration(d.bindTimeoutEntry, "Bind timeout")
+	isValid = isValid && ok
+
+	timing.ResponseTimeout, ok = checkEntryDuration(d.respTimeoutEntry, "Response timeout")
+	isValid = isValid && ok
+
+	timing.UnbindTimeout, ok = checkEntryDuration(d.unbindTimeEntry, "Unbind timeout")
+	isValid = isValid && ok
+
+	return timing, isValid
+}
+
+// getFallbacks parses comma-separated host:port list of fallback endpoints.
+func (d *accountDialog) getFallbacks() ([]account.Endpoint, bool) {
+	text, _ := d.fallbacksEntry.GetText()
+
+	var endpoints []account.Endpoint
+	for _, item := range strings.Split(text, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		host, portStr, err := net.SplitHostPort(item)
+		if err != nil {
+			markInvalidEntry(&d.fallbacksEntry.Widget, fmt.Sprintf("Invalid endpoint %s", item))
+			return nil, false
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil || host == "" {
+			markInvalidEntry(&d.fallbacksEntry.Widget, fmt.Sprintf("Invalid endpoint %s", item))
+			return nil, false
+		}
+		endpoints = append(endpoints, account.Endpoint{Host: host, Port: uint16(port)})
+	}
+	return endpoints, true
+}
+
+func endpointsToString(endpoints []account.Endpoint) string {
+	items := make([]string, len(endpoints))
+	for i, ep := range endpoints {
+		items[i] = ep.String()
+	}
+	return strings.Join(items, ", ")
 }
 
 func (d *accountDialog) resetStyles() {
 	widgets := []*gtk.Widget{
 		&d.hostEntry.Widget,
 		&d.portEntry.Widget,
+		&d.fallbacksEntry.Widget,
+		&d.proxyAddrEntry.Widget,
+		&d.proxyUserEntry.Widget,
+		&d.keyFileEntry.Widget,
+		&d.maxTLSSelector.Widget,
+		&d.pinsEntry.Widget,
 		&d.systemIdEntry.Widget,
 		&d.passwordEntry.Widget,
 		&d.systemTypeEntry.Widget,
 		&d.bindTypeSelector.Widget,
 		&d.codingSelector.Widget,
+		&d.attemptsEntry.Widget,
+		&d.delayEntry.Widget,
+		&d.maxDelayEntry.Widget,
+		&d.readTimeoutEntry.Widget,
+		&d.writeTimeoutEntry.Widget,
+		&d.enquireLinkEntry.Widget,
+		&d.linkFailuresEntry.Widget,
+		&d.bindTimeoutEntry.Widget,
+		&d.respTimeoutEntry.Widget,
+		&d.unbindTimeEntry.Widget,
+		&d.windowSizeEntry.Widget,
+		&d.tpsEntry.Widget,
+		&d.burstEntry.Widget,
+		&d.retriesEntry.Widget,
+		&d.backoffEntry.Widget,
+		&d.bindsEntry.Widget,
 	}
 
 	for _, widget := range widgets {
@@ -254,12 +638,21 @@ func (d *accountDialog) reset() {
 	d.resetStyles()
 	d.hostEntry.SetText("")
 	d.portEntry.SetText("2775")
-	d.tlsSwitch.SetActive(false)
+	d.fallbacksEntry.SetText("")
+	d.setProxy(account.Proxy{})
+	d.setTLSSettings(false, account.TLSSettings{})
 	d.systemIdEntry.SetText("")
 	d.passwordEntry.SetText("")
 	d.systemTypeEntry.SetText("")
 	d.bindTypeSelector.SetActive(0)
 	d.codingSelector.SetActive(0)
+	d.setReconnectPolicy(account.DefaultReconnectPolicy)
+	d.setTiming(account.DefaultSessionTiming)
+	d.windowSizeEntry.SetText("0")
+	d.windowBlockSwitch.SetActive(true)
+	d.setThroughput(account.DefaultThroughput)
+	d.bindsEntry.SetText("1")
+	d.balancingSelector.SetActive(0)
 }
 
 func (d *accountDialog) validate() *account.Account {
@@ -273,6 +666,12 @@ func (d *accountDialog) validate() *account.Account {
 	isValid = isValid && ok
 	port := uint16(portU64)
 
+	fallbacks, ok := d.getFallbacks()
+	isValid = isValid && ok
+
+	proxy, ok := d.getProxy()
+	isValid = isValid && ok
+
 	systemId, ok := checkEntryPresence(d.systemIdEntry, "System ID")
 	isValid = isValid && ok
 
@@ -281,6 +680,11 @@ func (d *accountDialog) validate() *account.Account {
 
 	systemType, _ := d.systemTypeEntry.GetText()
 	tls := d.tlsSwitch.GetActive()
+	var tlsSettings account.TLSSettings
+	if tls {
+		tlsSettings, ok = d.getTLSSettings()
+		isValid = isValid && ok
+	}
 
 	bindTypeIdx := getComboIndex(d.bindTypeSelector)
 	bindType := bindTypes[bindTypeIdx]
@@ -288,16 +692,66 @@ func (d *accountDialog) validate() *account.Account {
 	defaultCodingIdx := getComboIndex(d.codingSelector)
 	defaultCoding := defaultCodings[defaultCodingIdx]
 
+	reconnect := account.ReconnectPolicy{Enabled: d.reconnectSwitch.GetActive()}
+	if reconnect.Enabled {
+		attempts, ok := checkEntryNumerical(d.attemptsEntry, 16, "Max attempts")
+		isValid = isValid && ok
+		reconnect.MaxAttempts = int(attempts)
+
+		reconnect.Delay, ok = checkEntryDuration(d.delayEntry, "Reconnect delay")
+		isValid = isValid && ok
+
+		reconnect.MaxDelay, ok = checkEntryDuration(d.maxDelayEntry, "Max delay")
+		isValid = isValid && ok
+		if ok && reconnect.MaxDelay < reconnect.Delay {
+			markInvalidEntry(
+				&d.maxDelayEntry.Widget,
+				"Max delay must not be less than reconnect delay",
+			)
+			isValid = false
+		}
+	}
+
+	timing, ok := d.getTiming()
+	isValid = isValid && ok
+
+	windowSize, ok := checkEntryNumerical(d.windowSizeEntry, 16, "Window size")
+	isValid = isValid && ok
+	window := account.WindowPolicy{
+		Size:          int(windowSize),
+		BlockWhenFull: d.windowBlockSwitch.GetActive(),
+	}
+
+	throughput, ok := d.getThroughput()
+	isValid = isValid && ok
+
+	binds := account.BindPool{Balancing: balancings[getComboIndex(d.balancingSelector)]}
+	bindCount, ok := checkEntryNumerical(d.bindsEntry, 8, "Binds")
+	isValid = isValid && ok
+	if ok && bindCount == 0 {
+		markInvalidEntry(&d.bindsEntry.Widget, "Binds must be at least 1")
+		isValid = false
+	}
+	binds.Count = int(bindCount)
+
 	if isValid {
 		account := &account.Account{
 			Host:          host,
 			Port:          port,
 			TLS:           tls,
+			TLSSettings:   tlsSettings,
 			SystemID:      systemId,
 			Password:      password,
 			SystemType:    systemType,
 			BindType:      bindType,
 			DefaultCoding: defaultCoding,
+			Reconnect:     reconnect,
+			Timing:        timing,
+			Window:        window,
+			Throughput:    throughput,
+			Binds:         binds,
+			Fallbacks:     fallbacks,
+			Proxy:         proxy,
 		}
 		return account
 	}
@@ -316,12 +770,26 @@ func (d *accountDialog) run(acc *account.Account, callback func(*account.Account
 
 		d.hostEntry.SetText(acc.Host)
 		d.portEntry.SetText(strconv.Itoa(int(acc.Port)))
-		d.tlsSwitch.SetActive(acc.TLS)
+		d.fallbacksEntry.SetText(endpointsToString(acc.Fallbacks))
+		d.setProxy(acc.Proxy)
+		d.setTLSSettings(acc.TLS, acc.TLSSettings)
 		d.systemIdEntry.SetText(acc.SystemID)
 		d.passwordEntry.SetText(acc.Password)
 		d.systemTypeEntry.SetText(acc.SystemType)
 		d.bindTypeSelector.SetActive(getBindTypeIndex(acc.BindType))
 		d.codingSelector.SetActive(getDefaultCodingIndex(acc.DefaultCoding))
+		if acc.Reconnect.Enabled {
+			d.setReconnectPolicy(acc.Reconnect)
+		} else {
+			d.reconnectSwitch.SetActive(false)
+			d.setReconnectSensitive(false)
+		}
+		d.setTiming(acc.Timing)
+		d.windowSizeEntry.SetText(strconv.Itoa(acc.Window.Size))
+		d.windowBlockSwitch.SetActive(acc.Window.BlockWhenFull)
+		d.setThroughput(acc.Throughput)
+		d.bindsEntry.SetText(strconv.Itoa(max(acc.Binds.Count, 1)))
+		d.balancingSelector.SetActive(max(slices.Index(balancings, acc.Binds.Balancing), 0))
 	} else {
 		d.label.SetText("Add new account")
 		d.callback = callback
@@ -335,11 +803,12 @@ func (ctx *accountsContext) selectAccountHandler(tree *gtk.TreeView, path *gtk.T
 	submitSmStartSessionCallback(acc)
 }
 
-func initAccountsList(builder *gtk.Builder, repo account.Repository) {
+func initAccountsList(builder *gtk.Builder, repo account.Repository, s sender.Sender) {
 	tree := getTreeViewById(builder, "accounts_list")
 	ctx := accountsContext{
-		tree: tree,
-		repo: repo,
+		tree:   tree,
+		repo:   repo,
+		sender: s,
 	}
 	initAccountDialog(&ctx.dialog, builder)
 
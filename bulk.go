@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"smppizdez/bulk"
+	"smppizdez/sender"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// bulkReceiptTimeout limits waiting for delivery receipts once all rows of a
+// bulk job are submitted.
+const bulkReceiptTimeout = time.Minute
+
+type bulkSend struct {
+	button      *gtk.Button
+	pauseButton *gtk.Button
+	label       *gtk.Label
+	// job is read by the PDU handler, the rest is used on the main loop
+	// only.
+	job    atomic.Pointer[bulk.Job]
+	cancel context.CancelFunc
+}
+
+func (ctx *submitSmContext) initBulkSend(builder *gtk.Builder) {
+	b := &ctx.bulkSend
+	b.button = getButtonById(builder, "bulk_button")
+	b.pauseButton = getButtonById(builder, "bulk_pause_button")
+	b.label = getLabelById(builder, "bulk_progress_label")
+
+	b.button.Connect("pressed", ctx.startBulkSend)
+	b.pauseButton.Connect("pressed", func() {
+		job := b.job.Load()
+		if job == nil {
+			return
+		}
+		if job.Paused() {
+			job.Resume()
+			b.pauseButton.SetLabel("Pause")
+			ctx.appendLog("Bulk job resumed\n")
+		} else {
+			job.Pause()
+			b.pauseButton.SetLabel("Resume")
+			ctx.appendLog("Bulk job paused\n")
+		}
+	})
+}
+
+func (ctx *submitSmContext) startBulkSend() {
+	b := &ctx.bulkSend
+	if b.job.Load() != nil {
+		return
+	}
+
+	ctx.resetStyles()
+	req := ctx.getRequest(true)
+	if req == nil {
+		return
+	}
+
+	csvPath, ok := chooseFile("Open CSV", gtk.FILE_CHOOSER_ACTION_OPEN, "Open", "")
+	if !ok {
+		return
+	}
+	f, err := os.Open(csvPath)
+	if err != nil {
+		errorDialog("Failed to open CSV: %v", err)
+		return
+	}
+	rows, err := bulk.ReadRows(f)
+	f.Close()
+	if err != nil {
+		errorDialog("Failed to read CSV: %v", err)
+		return
+	}
+
+	resultName := strings.TrimSuffix(filepath.Base(csvPath), filepath.Ext(csvPath)) + ".result.csv"
+	resultPath, ok := chooseFile("Save results", gtk.FILE_CHOOSER_ACTION_SAVE, "Save", resultName)
+	if !ok {
+		return
+	}
+
+	// An existing result file is either continued, skipping rows submitted
+	// before, or replaced.
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if _, err := os.Stat(resultPath); err == nil {
+		resume, ok := resumeDialog(resultPath)
+		if !ok {
+			return
+		}
+		if resume {
+			if rows, err = ctx.skipSubmitted(rows, resultPath); err != nil {
+				errorDialog("Failed to read results: %v", err)
+				return
+			}
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+	}
+	if len(rows) == 0 {
+		ctx.appendLog("Bulk job has nothing to send\n")
+		return
+	}
+
+	out, err := os.OpenFile(resultPath, flags, 0o644)
+	if err != nil {
+		errorDialog("Failed to open results: %v", err)
+		return
+	}
+	info, err := out.Stat()
+	if err != nil {
+		out.Close()
+		errorDialog("Failed to open results: %v", err)
+		return
+	}
+
+	// Results are written as rows complete, so that a job stopped or killed
+	// midway can be resumed. Rows with delivery receipts are written again
+	// once receipts arrive.
+	var writeErr error
+	if info.Size() == 0 {
+		writeErr = bulk.WriteResults(out, nil, true)
+	}
+	concurrency := bulk.DefaultConcurrency
+	if _, size := ctx.session.InFlight(); size > 0 {
+		concurrency = min(concurrency, size)
+	}
+	job, err := bulk.NewJob(req, rows, concurrency, func(res bulk.Result, done, total int) {
+		if err := bulk.WriteResults(out, []bulk.Result{res}, false); err != nil && writeErr == nil {
+			writeErr = err
+		}
+		glib.IdleAdd(func() { b.label.SetText(fmt.Sprintf("%d/%d", done, total)) })
+	})
+	if err != nil {
+		out.Close()
+		errorDialog("Invalid message template: %v", err)
+		return
+	}
+
+	b.job.Store(job)
+	b.button.SetSensitive(false)
+	b.pauseButton.SetSensitive(true)
+	b.label.SetText(fmt.Sprintf("0/%d", len(rows)))
+	ctx.appendLog(fmt.Sprintf("Bulk job started: %d row(s) from %s\n", len(rows), csvPath))
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	session := ctx.session
+	go func() {
+		err := job.Run(runCtx, session)
+		if err == nil {
+			glib.IdleAdd(func() { b.label.SetText("Waiting for receipts") })
+			job.WaitReceipts(runCtx, bulkReceiptTimeout)
+		}
+
+		results := job.Results()
+		if err := bulk.WriteReceipts(out, results); err != nil && writeErr == nil {
+			writeErr = err
+		}
+		if err := out.Close(); err != nil && writeErr == nil {
+			writeErr = err
+		}
+		glib.IdleAdd(func() { ctx.finishBulkSend(results, err, writeErr, resultPath) })
+	}()
+}
+
+// skipSubmitted drops rows accepted or interrupted according to the result
+// CSV at path. Interrupted rows are logged, since they may have not been
+// accepted.
+func (ctx *submitSmContext) skipSubmitted(rows []bulk.Row, path string) ([]bulk.Row, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	submitted, err := bulk.ReadSubmitted(f)
+	if err != nil {
+		return nil, err
+	}
+	rest, interrupted := bulk.SkipSubmitted(rows, submitted)
+	if len(interrupted) > 0 {
+		numbers := make([]string, len(interrupted))
+		for i, n := range interrupted {
+			numbers[i] = strconv.Itoa(n)
+		}
+		ctx.appendLog(fmt.Sprintf(
+			"Skipping row(s) %s interrupted before response, check whether they were delivered\n",
+			strings.Join(numbers, ", "),
+		))
+	}
+	ctx.appendLog(fmt.Sprintf("Bulk job resumed from %s: %d row(s) left\n", path, len(rest)))
+	return rest, nil
+}
+
+// resumeDialog asks whether to continue the job with results at path or to
+// replace them. ok is false if the job was cancelled.
+func resumeDialog(path string) (resume bool, ok bool) {
+	dialog, err := gtk.DialogNewWithButtons(
+		"Results exist",
+		mainWindow,
+		gtk.DIALOG_DESTROY_WITH_PARENT|gtk.DIALOG_MODAL,
+		[]any{"Cancel", gtk.RESPONSE_CANCEL},
+		[]any{"Replace", gtk.RESPONSE_REJECT},
+		[]any{"Resume", gtk.RESPONSE_ACCEPT},
+	)
+	if err != nil {
+		errorDialog("Failed to create dialog: %v", err)
+		return false, false
+	}
+	defer dialog.Destroy()
+
+	box, err := dialog.GetContentArea()
+	if err == nil {
+		var label *gtk.Label
+		label, err = gtk.LabelNew(fmt.Sprintf(
+			"%s exists. Resume the job, skipping rows submitted before, or replace the results?",
+			path,
+		))
+		if err == nil {
+			box.Add(label)
+		}
+	}
+	if err != nil {
+		errorDialog("Failed to create dialog: %v", err)
+		return false, false
+	}
+	dialog.ShowAll()
+
+	switch dialog.Run() {
+	case gtk.RESPONSE_ACCEPT:
+		return true, true
+	case gtk.RESPONSE_REJECT:
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+func (ctx *submitSmContext) finishBulkSend(
+	results []bulk.Result,
+	err error,
+	writeErr error,
+	resultPath string,
+) {
+	b := &ctx.bulkSend
+	b.job.Store(nil)
+	b.cancel()
+	b.cancel = nil
+	if ctx.closed {
+		return
+	}
+
+	b.button.SetSensitive(true)
+	b.pauseButton.SetSensitive(false)
+	b.pauseButton.SetLabel("Pause")
+	b.label.SetText("")
+
+	failed, interrupted := 0, 0
+	for _, res := range results {
+		switch {
+		case res.Interrupted():
+			interrupted++
+		case res.Failed():
+			failed++
+		}
+	}
+	status := "finished"
+	if err != nil {
+		status = "stopped"
+	}
+	ctx.appendLog(fmt.Sprintf(
+		"Bulk job %s: %d row(s) submitted, %d failed, %d interrupted\n",
+		status,
+		len(results),
+		failed,
+		interrupted,
+	))
+
+	if writeErr != nil {
+		errorDialog("Failed to write bulk job results: %v", writeErr)
+		return
+	}
+	ctx.appendLog(fmt.Sprintf("Bulk job results written to %s\n", resultPath))
+}
+
+// stopBulkSend stops submission of a running bulk job, its results are
+// written anyway.
+func (ctx *submitSmContext) stopBulkSend() {
+	if ctx.bulkSend.cancel != nil {
+		ctx.bulkSend.cancel()
+	}
+}
+
+func (ctx *submitSmContext) bulkPDUHandler(dir sender.Direction, pd sender.PDU) {
+	if job := ctx.bulkSend.job.Load(); job != nil {
+		job.HandlePDU(dir, pd)
+	}
+}
+
+func chooseFile(title string, action gtk.FileChooserAction, accept string, name string) (string, bool) {
+	dialog, err := gtk.FileChooserDialogNewWith2Buttons(
+		title,
+		mainWindow,
+		action,
+		"Cancel",
+		gtk.RESPONSE_CANCEL,
+		accept,
+		gtk.RESPONSE_ACCEPT,
+	)
+	if err != nil {
+		errorDialog("Failed to create file chooser: %v", err)
+		return "", false
+	}
+	defer dialog.Destroy()
+
+	// Existing files are not confirmed here, callers decide what to do with
+	// them.
+	if action == gtk.FILE_CHOOSER_ACTION_SAVE {
+		dialog.SetCurrentName(name)
+	}
+	if dialog.Run() != gtk.RESPONSE_ACCEPT {
+		return "", false
+	}
+	return dialog.GetFilename(), true
+}
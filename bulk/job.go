@@ -0,0 +1,517 @@
+// Package bulk sends a message personalized from a template to every row of
+// a CSV file.
+package bulk
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"smppizdez/sender"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var (
+	MissingDestination = errors.New("CSV has no destination column")
+	JobStarted         = errors.New("Job is already started")
+)
+
+// DefaultConcurrency is the number of messages submitted at once unless the
+// window of the account is smaller.
+const DefaultConcurrency = 10
+
+// Row is a CSV row. Vars holds all its columns by header names, destination
+// included.
+type Row struct {
+	// Number is the number of the row starting from 1, not counting the
+	// header.
+	Number      int
+	Destination string
+	Vars        map[string]string
+}
+
+// ReadRows reads CSV with a header, one of its columns must be named
+// "destination".
+func ReadRows(r io.Reader) ([]Row, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, MissingDestination
+	}
+
+	header := records[0]
+	dstIdx := -1
+	for i, name := range header {
+		header[i] = strings.TrimSpace(name)
+		if strings.EqualFold(header[i], "destination") {
+			dstIdx = i
+		}
+	}
+	if dstIdx < 0 {
+		return nil, MissingDestination
+	}
+
+	rows := make([]Row, 0, len(records)-1)
+	for i, record := range records[1:] {
+		row := Row{Number: i + 1, Destination: record[dstIdx], Vars: make(map[string]string, len(header))}
+		for j, name := range header {
+			row.Vars[name] = record[j]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+type Result struct {
+	Row  Row
+	Text string
+	// Segments are reported as returned by Session.Send.
+	Segments []sender.SegmentResult
+	// ReceiptStates holds the states of delivery receipts of segments by
+	// their message IDs.
+	ReceiptStates map[string]string
+	// Err is set if the message couldn't be rendered or submitted.
+	Err error
+}
+
+// Interrupted reports whether the job was stopped while the message was
+// submitted, so that SMSC may have accepted it.
+func (r Result) Interrupted() bool {
+	return slices.ContainsFunc(r.Segments, func(seg sender.SegmentResult) bool {
+		return errors.Is(seg.Err, sender.Interrupted)
+	})
+}
+
+// Failed reports whether the message was not rendered, not submitted or
+// rejected.
+func (r Result) Failed() bool {
+	if r.Err != nil {
+		return true
+	}
+	for _, seg := range r.Segments {
+		if seg.Err != nil || seg.Status != sender.ESME_ROK {
+			return true
+		}
+	}
+	return false
+}
+
+// Job submits a message for every row. Message text of the base request is a
+// text/template executed with row columns, e.g. "Hello, {{.name}}".
+type Job struct {
+	base        sender.Request
+	tmpl        *template.Template
+	rows        []Row
+	concurrency int
+	onProgress  func(res Result, done, total int)
+
+	// notify is held while onProgress runs, so that reports are not
+	// reordered.
+	notify   sync.Mutex
+	mu       sync.Mutex
+	started  bool
+	paused   bool
+	resumed  chan struct{}
+	done     int
+	results  []*Result
+	receipts map[string]string
+	changed  chan struct{}
+}
+
+// NewJob creates a job. onProgress, if not nil, is called with the result of
+// every row once it's submitted, from goroutines of the job, one call at a
+// time.
+func NewJob(
+	base *sender.Request,
+	rows []Row,
+	concurrency int,
+	onProgress func(res Result, done, total int),
+) (*Job, error) {
+	j := &Job{
+		base:        *base,
+		rows:        rows,
+		concurrency: max(concurrency, 1),
+		onProgress:  onProgress,
+		results:     make([]*Result, len(rows)),
+		receipts:    make(map[string]string),
+		changed:     make(chan struct{}, 1),
+	}
+	if !base.IsBinary {
+		tmpl, err := template.New("message").Option("missingkey=error").Parse(base.Message)
+		if err != nil {
+			return nil, err
+		}
+		j.tmpl = tmpl
+	}
+	return j, nil
+}
+
+// HandlePDU records delivery receipts. It must be called for every PDU of
+// the session.
+func (j *Job) HandlePDU(dir sender.Direction, pd sender.PDU) {
+	dlv, ok := pd.(*sender.DeliverSMPDU)
+	if !ok || dir != sender.Inbound || dlv.MessageID == "" || dlv.ReceiptState == "" {
+		return
+	}
+
+	j.mu.Lock()
+	j.receipts[dlv.MessageID] = dlv.ReceiptState
+	j.mu.Unlock()
+	select {
+	case j.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Pause stops submission of new rows, rows being submitted are completed.
+func (j *Job) Pause() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.paused {
+		j.paused = true
+		j.resumed = make(chan struct{})
+	}
+}
+
+func (j *Job) Resume() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.paused {
+		j.paused = false
+		close(j.resumed)
+	}
+}
+
+func (j *Job) Paused() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.paused
+}
+
+// waitResumed blocks while the job is paused.
+func (j *Job) waitResumed(ctx context.Context) error {
+	j.mu.Lock()
+	resumed := j.resumed
+	paused := j.paused
+	j.mu.Unlock()
+	if !paused {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run submits rows over session until all of them are submitted or ctx is
+// done. Results of submitted rows are kept either way.
+func (j *Job) Run(ctx context.Context, session sender.Session) error {
+	j.mu.Lock()
+	if j.started {
+		j.mu.Unlock()
+		return JobStarted
+	}
+	j.started = true
+	j.mu.Unlock()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	slots := make(chan struct{}, j.concurrency)
+	for i := range j.rows {
+		if err := j.waitResumed(ctx); err != nil {
+			return err
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			j.submit(ctx, session, i)
+			<-slots
+		}()
+	}
+	return nil
+}
+
+func (j *Job) submit(ctx context.Context, session sender.Session, i int) {
+	row := j.rows[i]
+	res := &Result{Row: row}
+	defer func() {
+		j.notify.Lock()
+		defer j.notify.Unlock()
+
+		j.mu.Lock()
+		j.results[i] = res
+		j.done++
+		done := j.done
+		r := j.withReceipts(res)
+		j.mu.Unlock()
+		if j.onProgress != nil {
+			j.onProgress(r, done, len(j.rows))
+		}
+	}()
+
+	req := j.base
+	req.Destination.Addr = row.Destination
+	if j.tmpl != nil {
+		var text strings.Builder
+		if res.Err = j.tmpl.Execute(&text, row.Vars); res.Err != nil {
+			return
+		}
+		req.Message = text.String()
+		res.Text = req.Message
+	}
+
+	result, err := session.Send(ctx, &req)
+	res.Segments = result.Segments
+	if err != nil && len(result.Segments) == 0 {
+		res.Err = err
+	}
+}
+
+// WaitReceipts waits until final delivery receipts arrive for all accepted
+// segments, ctx is done or timeout expires. It does nothing unless receipts
+// were requested.
+func (j *Job) WaitReceipts(ctx context.Context, timeout time.Duration) {
+	if j.base.RegisteredDelivery&sender.RdRequested == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		j.mu.Lock()
+		final := true
+		for _, res := range j.results {
+			if res == nil {
+				continue
+			}
+			for _, seg := range res.Segments {
+				if seg.Err != nil || seg.Status != sender.ESME_ROK {
+					continue
+				}
+				state, ok := j.receipts[seg.MessageID]
+				final = final && ok && state != "ENROUTE" && state != "ACCEPTD"
+			}
+		}
+		j.mu.Unlock()
+		if final {
+			return
+		}
+
+		select {
+		case <-j.changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Results returns results of submitted rows in the order of rows.
+func (j *Job) Results() []Result {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var results []Result
+	for _, res := range j.results {
+		if res != nil {
+			results = append(results, j.withReceipts(res))
+		}
+	}
+	return results
+}
+
+// withReceipts returns a copy of res with states of receipts received so far.
+// j.mu must be held.
+func (j *Job) withReceipts(res *Result) Result {
+	r := *res
+	r.ReceiptStates = make(map[string]string)
+	for _, seg := range r.Segments {
+		if state, ok := j.receipts[seg.MessageID]; ok && seg.MessageID != "" {
+			r.ReceiptStates[seg.MessageID] = state
+		}
+	}
+	return r
+}
+
+// interruptedStatus is written as status of segments left without response
+// when the job was stopped.
+const interruptedStatus = "INTERRUPTED"
+
+var resultHeader = []string{
+	"row",
+	"destination",
+	"text",
+	"segment",
+	"sequence",
+	"status",
+	"message_id",
+	"latency_ms",
+	"receipt_state",
+	"error",
+}
+
+// WriteResults writes a line per segment of every result, or a single line
+// if the message was not submitted. A result may be written again later, e.g.
+// once its delivery receipts arrive, its last lines are the ones that count.
+func WriteResults(w io.Writer, results []Result, header bool) error {
+	cw := csv.NewWriter(w)
+	if header {
+		cw.Write(resultHeader)
+	}
+
+	for _, res := range results {
+		prefix := []string{strconv.Itoa(res.Row.Number), res.Row.Destination, res.Text}
+		if res.Err != nil || len(res.Segments) == 0 {
+			cw.Write(append(prefix, "", "", "", "", "", "", errString(res.Err)))
+			continue
+		}
+
+		for i, seg := range res.Segments {
+			line := append(prefix, strconv.Itoa(i+1), strconv.FormatUint(uint64(seg.Sequence), 10))
+			switch {
+			case errors.Is(seg.Err, sender.Interrupted):
+				line = append(line, interruptedStatus, "", "", "", seg.Err.Error())
+			case seg.Err != nil:
+				line = append(line, "", "", "", "", seg.Err.Error())
+			default:
+				line = append(
+					line,
+					seg.Status.String(),
+					seg.MessageID,
+					fmt.Sprintf("%.3f", float64(seg.Latency)/float64(time.Millisecond)),
+					res.ReceiptStates[seg.MessageID],
+					"",
+				)
+			}
+			cw.Write(line)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteReceipts writes again results that got delivery receipts, so that
+// lines with receipt states follow the lines written once rows were
+// submitted.
+func WriteReceipts(w io.Writer, results []Result) error {
+	var receipted []Result
+	for _, res := range results {
+		if len(res.ReceiptStates) > 0 {
+			receipted = append(receipted, res)
+		}
+	}
+	return WriteResults(w, receipted, false)
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Submission is the outcome of a row according to a result CSV.
+type Submission int
+
+const (
+	SubmissionAccepted Submission = iota + 1
+	// SubmissionInterrupted rows were being submitted when the job was
+	// stopped and may have been accepted.
+	SubmissionInterrupted
+)
+
+func (s Submission) String() string {
+	switch s {
+	case SubmissionAccepted:
+		return "Accepted"
+	case SubmissionInterrupted:
+		return "Interrupted"
+	default:
+		return fmt.Sprintf("Unknown Submission enum value (%d)", s)
+	}
+}
+
+// ReadSubmitted reads a result CSV written before and returns outcomes of
+// rows accepted by SMSC or interrupted, so that a stopped job can be resumed
+// without sending them again. Rows that failed are left out.
+func ReadSubmitted(r io.Reader) (map[int]Submission, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(resultHeader)
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Lines of a row are written together, numbered by segment from 1, or a
+	// single line without a segment if the message was not submitted. Rows
+	// sent again after resuming follow, so the last lines of a row tell its
+	// outcome, even if they come right after lines of the previous run. A
+	// row with an interrupted segment is interrupted, a row is accepted only
+	// if all its segments are.
+	submitted := make(map[int]Submission)
+	prev := -1
+	for i, record := range records {
+		if i == 0 && record[0] == resultHeader[0] {
+			continue
+		}
+		row, err := strconv.Atoi(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid row number %q", record[0])
+		}
+
+		var outcome Submission
+		switch record[5] {
+		case sender.ESME_ROK.String():
+			outcome = SubmissionAccepted
+		case interruptedStatus:
+			outcome = SubmissionInterrupted
+		}
+		first := row != prev || record[3] == "" || record[3] == "1"
+		if !first && outcome != SubmissionInterrupted && submitted[row] != SubmissionAccepted {
+			outcome = submitted[row]
+		}
+		submitted[row] = outcome
+		prev = row
+	}
+
+	for row, outcome := range submitted {
+		if outcome == 0 {
+			delete(submitted, row)
+		}
+	}
+	return submitted, nil
+}
+
+// SkipSubmitted drops rows accepted or interrupted according to submitted
+// and returns the rest with numbers of interrupted rows, which may have not
+// been accepted and should be checked by hand.
+func SkipSubmitted(rows []Row, submitted map[int]Submission) (rest []Row, interrupted []int) {
+	for _, row := range rows {
+		switch submitted[row.Number] {
+		case SubmissionAccepted:
+		case SubmissionInterrupted:
+			interrupted = append(interrupted, row.Number)
+		default:
+			rest = append(rest, row)
+		}
+	}
+	return rest, interrupted
+}
@@ -0,0 +1,289 @@
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"smppizdez/sender"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadRows(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []Row
+		err  error
+	}{
+		{
+			name: "rows",
+			csv:  "name, Destination\nAnn,111\nBob,222\n",
+			want: []Row{
+				{Number: 1, Destination: "111", Vars: map[string]string{"name": "Ann", "Destination": "111"}},
+				{Number: 2, Destination: "222", Vars: map[string]string{"name": "Bob", "Destination": "222"}},
+			},
+		},
+		{name: "header only", csv: "destination\n", want: []Row{}},
+		{name: "empty", csv: "", err: MissingDestination},
+		{name: "no destination", csv: "name,phone\nAnn,111\n", err: MissingDestination},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ReadRows(strings.NewReader(tt.csv))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("got %d row(s), want %d", len(rows), len(tt.want))
+			}
+			for i, row := range rows {
+				want := tt.want[i]
+				if row.Number != want.Number || row.Destination != want.Destination || !maps.Equal(row.Vars, want.Vars) {
+					t.Fatalf("row %d is %+v, want %+v", i, row, want)
+				}
+			}
+		})
+	}
+
+	if _, err := ReadRows(strings.NewReader("destination,name\n111\n")); err == nil {
+		t.Fatal("row with missing column was read")
+	}
+}
+
+var (
+	accepted = sender.SegmentResult{
+		Sequence:  1,
+		Status:    sender.ESME_ROK,
+		MessageID: "m1",
+		Latency:   1500 * time.Microsecond,
+	}
+	rejected    = sender.SegmentResult{Sequence: 2, Status: sender.ESME_RTHROTTLED}
+	noResponse  = sender.SegmentResult{Sequence: 3, Err: errors.New("No response")}
+	interrupted = sender.SegmentResult{Sequence: 4, Err: fmt.Errorf("%w: %w", sender.Interrupted, context.Canceled)}
+)
+
+func TestWriteResults(t *testing.T) {
+	row := Row{Number: 1, Destination: "111"}
+	results := []Result{
+		{
+			Row:           row,
+			Text:          "hi",
+			Segments:      []sender.SegmentResult{accepted, rejected},
+			ReceiptStates: map[string]string{"m1": "DELIVRD"},
+		},
+		{Row: Row{Number: 2, Destination: "222"}, Err: errors.New("bad template")},
+		{Row: Row{Number: 3, Destination: "333"}, Segments: []sender.SegmentResult{noResponse, interrupted}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, results, true); err != nil {
+		t.Fatal(err)
+	}
+	want := "row,destination,text,segment,sequence,status,message_id,latency_ms,receipt_state,error\n" +
+		"1,111,hi,1,1,ESME_ROK,m1,1.500,DELIVRD,\n" +
+		"1,111,hi,2,2,ESME_RTHROTTLED,,0.000,,\n" +
+		"2,222,,,,,,,,bad template\n" +
+		"3,333,,1,3,,,,,No response\n" +
+		"3,333,,2,4,INTERRUPTED,,,,Sending interrupted before response: context canceled\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+
+	buf.Reset()
+	if err := WriteResults(&buf, results[1:2], false); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "2,222,,,,,,,,bad template\n" {
+		t.Fatalf("got %q without header", got)
+	}
+}
+
+func TestReadSubmitted(t *testing.T) {
+	results := func(rows ...Result) string {
+		var buf bytes.Buffer
+		WriteResults(&buf, rows, true)
+		return buf.String()
+	}
+	result := func(number int, segments ...sender.SegmentResult) Result {
+		return Result{Row: Row{Number: number}, Segments: segments}
+	}
+
+	tests := []struct {
+		name string
+		csv  string
+		want map[int]Submission
+	}{
+		{
+			name: "outcomes",
+			csv: results(
+				result(1, accepted, accepted),
+				result(2, accepted, rejected),
+				result(3, noResponse),
+				result(4, accepted, interrupted),
+				result(5, rejected, interrupted),
+				Result{Row: Row{Number: 6}, Err: errors.New("bad template")},
+			),
+			want: map[int]Submission{1: SubmissionAccepted, 4: SubmissionInterrupted, 5: SubmissionInterrupted},
+		},
+		{
+			name: "resumed",
+			csv:  results(result(1, rejected), result(2, accepted)) + strings.SplitN(results(result(1, accepted)), "\n", 2)[1],
+			want: map[int]Submission{1: SubmissionAccepted, 2: SubmissionAccepted},
+		},
+		{
+			name: "resumed right after the last row",
+			csv:  results(result(4, accepted), result(5, rejected)) + strings.SplitN(results(result(5, accepted)), "\n", 2)[1],
+			want: map[int]Submission{4: SubmissionAccepted, 5: SubmissionAccepted},
+		},
+		{
+			name: "resumed multipart right after the last row",
+			csv:  results(result(5, accepted, rejected)) + strings.SplitN(results(result(5, accepted, accepted)), "\n", 2)[1],
+			want: map[int]Submission{5: SubmissionAccepted},
+		},
+		{
+			name: "rejected on resume",
+			csv:  results(result(5, accepted, interrupted)) + strings.SplitN(results(result(5, rejected)), "\n", 2)[1],
+			want: map[int]Submission{},
+		},
+		{name: "empty", csv: "", want: map[int]Submission{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadSubmitted(strings.NewReader(tt.csv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ReadSubmitted(strings.NewReader("x,,,,,,,,,\n")); err == nil {
+		t.Fatal("invalid row number was read")
+	}
+	if _, err := ReadSubmitted(strings.NewReader("1,111\n")); err == nil {
+		t.Fatal("line with missing columns was read")
+	}
+}
+
+func TestSkipSubmitted(t *testing.T) {
+	rows := []Row{{Number: 1}, {Number: 2}, {Number: 3}, {Number: 4}}
+	submitted := map[int]Submission{1: SubmissionAccepted, 3: SubmissionInterrupted}
+
+	rest, interrupted := SkipSubmitted(rows, submitted)
+	var numbers []int
+	for _, row := range rest {
+		numbers = append(numbers, row.Number)
+	}
+	if !slices.Equal(numbers, []int{2, 4}) {
+		t.Fatalf("got rows %v, want [2 4]", numbers)
+	}
+	if !slices.Equal(interrupted, []int{3}) {
+		t.Fatalf("got interrupted rows %v, want [3]", interrupted)
+	}
+}
+
+func TestWriteReceipts(t *testing.T) {
+	results := []Result{
+		{Row: Row{Number: 1, Destination: "111"}, Segments: []sender.SegmentResult{accepted}},
+		{
+			Row:           Row{Number: 2, Destination: "222"},
+			Segments:      []sender.SegmentResult{accepted},
+			ReceiptStates: map[string]string{"m1": "DELIVRD"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReceipts(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "2,222,,1,1,ESME_ROK,m1,1.500,DELIVRD,\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// Rows written again with receipts count as accepted once.
+	var resumed bytes.Buffer
+	WriteResults(&resumed, results, true)
+	WriteReceipts(&resumed, results)
+	submitted, err := ReadSubmitted(&resumed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int]Submission{1: SubmissionAccepted, 2: SubmissionAccepted}; !maps.Equal(submitted, want) {
+		t.Fatalf("got %v, want %v", submitted, want)
+	}
+}
+
+// blockingSession accepts messages for destination "ok" and blocks others
+// until ctx is done, as if their responses never arrived.
+type blockingSession struct {
+	sender.Session
+	sending chan struct{}
+}
+
+func (s *blockingSession) Send(ctx context.Context, req *sender.Request) (sender.SendResult, error) {
+	if req.Destination.Addr == "ok" {
+		return sender.SendResult{Segments: []sender.SegmentResult{accepted}}, nil
+	}
+	s.sending <- struct{}{}
+	<-ctx.Done()
+	seg := sender.SegmentResult{Err: fmt.Errorf("%w: %w", sender.Interrupted, ctx.Err())}
+	return sender.SendResult{Segments: []sender.SegmentResult{seg}}, ctx.Err()
+}
+
+func TestJobStoppedMidSend(t *testing.T) {
+	rows := []Row{{Number: 1, Destination: "ok"}, {Number: 2, Destination: "slow"}, {Number: 3, Destination: "ok"}}
+	for i := range rows {
+		rows[i].Vars = map[string]string{"name": rows[i].Destination}
+	}
+	// Results are written as rows complete, as if the job could be killed
+	// any moment.
+	var buf bytes.Buffer
+	WriteResults(&buf, nil, true)
+	job, err := NewJob(&sender.Request{Message: "hi {{.name}}"}, rows, 1, func(res Result, done, total int) {
+		if err := WriteResults(&buf, []Result{res}, false); err != nil {
+			t.Error(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &blockingSession{sending: make(chan struct{})}
+	go func() {
+		<-session.sending
+		cancel()
+	}()
+	if err := job.Run(ctx, session); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	results := job.Results()
+	if len(results) != 2 {
+		t.Fatalf("got %d result(s), want 2", len(results))
+	}
+	if results[0].Text != "hi ok" || results[0].Failed() || results[0].Interrupted() {
+		t.Fatalf("first row is %+v, want accepted", results[0])
+	}
+	if !results[1].Interrupted() {
+		t.Fatalf("second row is %+v, want interrupted", results[1])
+	}
+
+	submitted, err := ReadSubmitted(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]Submission{1: SubmissionAccepted, 2: SubmissionInterrupted}
+	if !maps.Equal(submitted, want) {
+		t.Fatalf("resume would skip %v, want %v", submitted, want)
+	}
+}
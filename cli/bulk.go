@@ -0,0 +1,225 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"smppizdez/bulk"
+	"smppizdez/sender"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func (a *app) bulk(args []string) int {
+	req := a.newRequest()
+	f := sendFlags{timeout: time.Minute}
+	var csvPath, outPath string
+	var resume bool
+	concurrency := bulk.DefaultConcurrency
+
+	fs := a.newFlagSet("bulk")
+	a.addRequestFlags(fs, req, &f)
+	fs.StringVar(&f.text, "text", "", "message template, e.g. \"Hello, {{.name}}\" for a CSV column named name")
+	fs.StringVar(&csvPath, "csv", "", "CSV `path` with a header and a destination column")
+	fs.StringVar(&outPath, "out", "", "result CSV `path` (default is -csv path with .result.csv suffix)")
+	fs.BoolVar(&resume, "resume", false, "skip rows accepted or interrupted according to -out and append results to it")
+	fs.IntVar(&concurrency, "concurrency", concurrency, "messages submitted at once, limited by the account window")
+	fs.DurationVar(&f.timeout, "timeout", f.timeout, "time to wait for delivery receipts after all rows are submitted")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if csvPath == "" {
+		return a.usageError("-csv is required")
+	}
+	if outPath == "" {
+		outPath = csvPath + ".result.csv"
+	}
+	if code := a.completeRequest(req, &f, true); code != ExitOK {
+		return code
+	}
+
+	rows, err := readRows(csvPath)
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Failed to read %s: %v\n", csvPath, err)
+		return ExitFailure
+	}
+	if resume {
+		rows, err = a.skipSubmitted(rows, outPath)
+		if err != nil {
+			fmt.Fprintf(a.stderr, "Failed to read %s: %v\n", outPath, err)
+			return ExitFailure
+		}
+	}
+
+	if len(rows) == 0 {
+		fmt.Fprintln(a.stderr, "Nothing to send")
+		return ExitOK
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if resume {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	out, err := os.OpenFile(outPath, flags, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return a.usageError("%s exists, pass -resume to continue the job or remove it", outPath)
+	}
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Failed to open results: %v\n", err)
+		return ExitFailure
+	}
+	defer out.Close()
+	info, err := out.Stat()
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Failed to open results: %v\n", err)
+		return ExitFailure
+	}
+
+	acc, err := a.findAccount(f.account)
+	if err != nil {
+		fmt.Fprintln(a.stderr, err)
+		return ExitUsage
+	}
+	if acc.Window.Size > 0 && acc.Window.Size < concurrency {
+		concurrency = acc.Window.Size
+	}
+
+	// Results are written as rows complete, so that a job killed midway can
+	// be resumed. Rows with delivery receipts are written again once
+	// receipts arrive.
+	var writeErr error
+	if info.Size() == 0 {
+		writeErr = bulk.WriteResults(out, nil, true)
+	}
+	job, err := bulk.NewJob(req, rows, concurrency, func(res bulk.Result, done, total int) {
+		if err := bulk.WriteResults(out, []bulk.Result{res}, false); err != nil && writeErr == nil {
+			writeErr = err
+		}
+		fmt.Fprintf(a.stderr, "\rSubmitted %d/%d", done, total)
+	})
+	if err != nil {
+		return a.usageError("Invalid template: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	session, err := a.sender.StartSession(
+		acc,
+		job.HandlePDU,
+		a.closeHandler,
+		a.reconnectHandler,
+		func(sender.SessionState) {},
+	)
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Failed to bind: %v\n", err)
+		return ExitFailure
+	}
+	defer func() {
+		if err := session.Close(); err != nil {
+			fmt.Fprintf(a.stderr, "Unbind: %v\n", err)
+		}
+	}()
+
+	err = job.Run(ctx, session)
+	fmt.Fprintln(a.stderr)
+	stopped := err != nil
+	if stopped {
+		fmt.Fprintf(a.stderr, "Job stopped, run it again with -resume to send the rest\n")
+	} else {
+		job.WaitReceipts(ctx, f.timeout)
+	}
+
+	results := job.Results()
+	if err = bulk.WriteReceipts(out, results); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if writeErr != nil {
+		fmt.Fprintf(a.stderr, "Failed to write results: %v\n", writeErr)
+		return ExitFailure
+	}
+
+	code, failed, interrupted := ExitOK, 0, 0
+	for _, res := range results {
+		switch {
+		case res.Interrupted():
+			interrupted++
+		case res.Failed():
+			failed++
+		}
+		for _, seg := range res.Segments {
+			if code == ExitOK {
+				code = segmentCode(seg)
+			}
+			if state, ok := res.ReceiptStates[seg.MessageID]; ok && state != "DELIVRD" && code == ExitOK {
+				code = ExitUndelivered
+			}
+		}
+		if res.Err != nil && code == ExitOK {
+			code = ExitFailure
+		}
+	}
+	fmt.Fprintf(
+		a.stderr,
+		"%d row(s) submitted, %d failed, %d interrupted, results written to %s\n",
+		len(results),
+		failed,
+		interrupted,
+		outPath,
+	)
+
+	if stopped {
+		return ExitFailure
+	}
+	return code
+}
+
+func readRows(path string) ([]bulk.Row, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return bulk.ReadRows(f)
+}
+
+// skipSubmitted drops rows accepted or interrupted according to the result
+// CSV at path, if it exists. Interrupted rows are listed, since they may
+// have not been accepted.
+func (a *app) skipSubmitted(rows []bulk.Row, path string) ([]bulk.Row, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return rows, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	submitted, err := bulk.ReadSubmitted(f)
+	if err != nil {
+		return nil, err
+	}
+	rest, interrupted := bulk.SkipSubmitted(rows, submitted)
+	if len(interrupted) > 0 {
+		fmt.Fprintf(
+			a.stderr,
+			"Skipping row(s) %s interrupted before response, check whether they were delivered\n",
+			joinRows(interrupted),
+		)
+	}
+	return rest, nil
+}
+
+func joinRows(numbers []int) string {
+	s := make([]string, len(numbers))
+	for i, n := range numbers {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ", ")
+}
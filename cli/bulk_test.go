@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"smppizdez/sender"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// bulkSession accepts messages to destinations listed in accept and rejects
+// the rest, recording every destination sent to.
+type bulkSession struct {
+	mu     sync.Mutex
+	accept map[string]bool
+	sent   []string
+}
+
+func (s *bulkSession) respond(req *sender.Request) (sender.SendResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, req.Destination.Addr)
+	seg := rejectedSeg
+	if s.accept[req.Destination.Addr] {
+		seg = acceptedSeg
+		seg.MessageID = "m" + req.Destination.Addr
+	}
+	return sender.SendResult{Segments: []sender.SegmentResult{seg}}, nil
+}
+
+func TestBulkResume(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "rows.csv")
+	if err := os.WriteFile(csvPath, []byte("destination,name\n111,Ann\n222,Bob\n333,Eve\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"bulk", "-account", "test", "-from", "1", "-text", "Hi {{.name}}", "-csv", csvPath, "-concurrency", "1"}
+
+	bulk := &bulkSession{accept: map[string]bool{"111": true, "333": true}}
+	snd := &testSender{session: &testSession{respond: bulk.respond}}
+	code, _, stderr := runApp(t, snd, args...)
+	if code != ExitRejected {
+		t.Fatalf("got exit code %d, want %d; stderr %q", code, ExitRejected, stderr)
+	}
+	results, err := os.ReadFile(csvPath + ".result.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(results), "Hi Bob") || strings.Count(string(results), "\n") != 4 {
+		t.Fatalf("results are %q, want a header and a line per row", results)
+	}
+
+	// Results exist, so the job is either resumed or refused.
+	if code, _, _ := runApp(t, snd, args...); code != ExitUsage {
+		t.Fatalf("got exit code %d running over results, want %d", code, ExitUsage)
+	}
+
+	bulk = &bulkSession{accept: map[string]bool{"222": true}}
+	snd = &testSender{session: &testSession{respond: bulk.respond}}
+	code, _, stderr = runApp(t, snd, append(args, "-resume")...)
+	if code != ExitOK {
+		t.Fatalf("got exit code %d on resume, want %d; stderr %q", code, ExitOK, stderr)
+	}
+	if len(bulk.sent) != 1 || bulk.sent[0] != "222" {
+		t.Fatalf("resume sent to %v, want only the rejected row", bulk.sent)
+	}
+
+	// Every row is accepted now.
+	code, _, stderr = runApp(t, snd, append(args, "-resume")...)
+	if code != ExitOK || !strings.Contains(stderr, "Nothing to send") {
+		t.Fatalf("got exit code %d, stderr %q with every row accepted", code, stderr)
+	}
+}
+
+func TestBulkUsage(t *testing.T) {
+	snd := &testSender{session: &testSession{respond: respondWith(acceptedSeg)}}
+	if code, _, _ := runApp(t, snd, "bulk", "-account", "test", "-from", "1", "-text", "hi"); code != ExitUsage {
+		t.Fatalf("got exit code %d without -csv, want %d", code, ExitUsage)
+	}
+
+	csvPath := filepath.Join(t.TempDir(), "rows.csv")
+	if err := os.WriteFile(csvPath, []byte("destination\n111\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, _, _ := runApp(t, snd, "bulk", "-account", "test", "-from", "1", "-text", "Hi {{.name", "-csv", csvPath)
+	if code != ExitUsage {
+		t.Fatalf("got exit code %d with invalid template, want %d", code, ExitUsage)
+	}
+}
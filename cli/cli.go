@@ -0,0 +1,248 @@
+// Package cli implements headless commands run instead of the GTK window when
+// the first argument names one of them.
+package cli
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"smppizdez/account"
+	"smppizdez/sender"
+	"strconv"
+	"strings"
+)
+
+// Exit codes of commands.
+const (
+	ExitOK = iota
+	// ExitFailure is returned when the account couldn't be bound or the
+	// message couldn't be submitted.
+	ExitFailure
+	ExitUsage
+	// ExitRejected is returned when SMSC responded with an error status.
+	ExitRejected
+	// ExitTimeout is returned when a response or delivery receipt didn't
+	// arrive in time.
+	ExitTimeout
+	// ExitUndelivered is returned when a delivery receipt reported a final
+	// state other than DELIVRD.
+	ExitUndelivered
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(a *app, args []string) int
+}
+
+var commands = []command{
+	{name: "accounts", summary: "List accounts", run: (*app).accounts},
+	{name: "send", summary: "Send a message", run: (*app).send},
+	{name: "bulk", summary: "Send a templated message to every row of a CSV file", run: (*app).bulk},
+	{name: "listen", summary: "Print PDUs as JSON lines until interrupted", run: (*app).listen},
+	{name: "load", summary: "Submit messages over several sessions at a target rate", run: (*app).load},
+	{name: "scenario", summary: "Run scripted test scenarios with a report per step", run: (*app).scenario},
+}
+
+type app struct {
+	repo   account.Repository
+	sender sender.Sender
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// IsCommand reports whether name is a command handled by Run.
+func IsCommand(name string) bool {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return true
+		}
+	}
+	return name == "help"
+}
+
+// Run runs the command named by args[0] and returns its exit code.
+func Run(args []string, repo account.Repository, snd sender.Sender) int {
+	a := &app{repo: repo, sender: snd, stdout: os.Stdout, stderr: os.Stderr}
+	for _, cmd := range commands {
+		if len(args) > 0 && cmd.name == args[0] {
+			return cmd.run(a, args[1:])
+		}
+	}
+
+	fmt.Fprintf(a.stderr, "Usage: smppizdez [command] [flags]\n\n")
+	fmt.Fprintf(a.stderr, "Without a command the GTK window is opened. Commands:\n\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(a.stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(a.stderr, "\nRun \"smppizdez <command> -h\" for command flags.\n")
+	if len(args) > 0 && args[0] == "help" {
+		return ExitOK
+	}
+	return ExitUsage
+}
+
+func (a *app) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	return fs
+}
+
+// parseFlags parses command flags. It returns false with the exit code if
+// the command must not run.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK, false
+	}
+	if err != nil {
+		return ExitUsage, false
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "Unexpected argument %q\n", fs.Arg(0))
+		return ExitUsage, false
+	}
+	return ExitOK, true
+}
+
+func (a *app) usageError(format string, args ...any) int {
+	fmt.Fprintf(a.stderr, format+"\n", args...)
+	return ExitUsage
+}
+
+func (a *app) accounts(args []string) int {
+	fs := a.newFlagSet("accounts")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	accounts, err := a.repo.GetAccounts()
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Failed to load accounts: %v\n", err)
+		return ExitFailure
+	}
+	for _, acc := range accounts {
+		fmt.Fprintf(a.stdout, "%s\t%s\t%s\t%v\n", acc.ID, acc.SystemID, acc.Endpoints()[0], acc.BindType)
+	}
+	return ExitOK
+}
+
+// findAccount looks an account up by ID, system_id or system_id@host.
+func (a *app) findAccount(name string) (*account.Account, error) {
+	accounts, err := a.repo.GetAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load accounts: %w", err)
+	}
+
+	var found []*account.Account
+	for i := range accounts {
+		acc := &accounts[i]
+		if acc.ID == name {
+			return acc, nil
+		}
+		if acc.SystemID == name || acc.SystemID+"@"+acc.Host == name {
+			found = append(found, acc)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("No account %q", name)
+	case 1:
+		return found[0], nil
+	default:
+		return nil, fmt.Errorf(
+			"Several accounts match %q, use system_id@host or account ID (see \"smppizdez accounts\")",
+			name,
+		)
+	}
+}
+
+// named is a value selectable by name on the command line.
+type named[T comparable] struct {
+	value T
+	name  string
+}
+
+// choiceFlag is a flag that accepts one of the names.
+type choiceFlag[T comparable] struct {
+	value *T
+	names []named[T]
+	set   bool
+}
+
+func newChoiceFlag[T comparable](value *T, names []named[T]) *choiceFlag[T] {
+	return &choiceFlag[T]{value: value, names: names}
+}
+
+func (f *choiceFlag[T]) String() string {
+	if f == nil || f.value == nil {
+		return ""
+	}
+	for _, n := range f.names {
+		if n.value == *f.value {
+			return n.name
+		}
+	}
+	return ""
+}
+
+func (f *choiceFlag[T]) Set(s string) error {
+	for _, n := range f.names {
+		if strings.EqualFold(n.name, s) {
+			*f.value = n.value
+			f.set = true
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", f.choices())
+}
+
+func (f *choiceFlag[T]) choices() string {
+	choices := make([]string, len(f.names))
+	for i, n := range f.names {
+		choices[i] = n.name
+	}
+	return strings.Join(choices, ", ")
+}
+
+// hexPairsFlag collects repeated KEY=VALUE flags, where KEY is a hex number
+// of the given size and VALUE is hex data.
+type hexPairsFlag struct {
+	bits   int
+	keys   []uint64
+	values [][]byte
+}
+
+func (f *hexPairsFlag) String() string {
+	pairs := make([]string, len(f.keys))
+	for i := range f.keys {
+		pairs[i] = fmt.Sprintf("%x=%x", f.keys[i], f.values[i])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f *hexPairsFlag) Set(s string) error {
+	keyStr, valueStr, ok := strings.Cut(s, "=")
+	if !ok {
+		return errors.New("must be KEY=VALUE")
+	}
+	key, err := strconv.ParseUint(keyStr, 16, f.bits)
+	if err != nil {
+		return fmt.Errorf("key must be a %d-bit hex number", f.bits)
+	}
+	value, err := parseHex(valueStr)
+	if err != nil {
+		return errors.New("value must be a hex string")
+	}
+	f.keys = append(f.keys, key)
+	f.values = append(f.values, value)
+	return nil
+}
+
+func parseHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.Join(strings.Fields(s), ""))
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"smppizdez/account"
+	"smppizdez/coding"
+	"smppizdez/sender"
+	"testing"
+)
+
+type testRepo []account.Account
+
+func (r testRepo) GetAccounts() ([]account.Account, error) { return r, nil }
+func (testRepo) CreateAccount(*account.Account) error      { return nil }
+func (testRepo) UpdateAccount(*account.Account) error      { return nil }
+func (testRepo) DeleteAccount(string) error                { return nil }
+
+// testSender starts testSession, or fails to bind with bindErr.
+type testSender struct {
+	session *testSession
+	bindErr error
+}
+
+func (s *testSender) SupportedCodings() []coding.Coding {
+	return []coding.Coding{coding.GSM7, coding.UCS2, coding.Octet1}
+}
+
+func (s *testSender) StartSession(
+	_ *account.Account,
+	handler sender.PDUHandler,
+	_ sender.CloseHandler,
+	_ sender.ReconnectHandler,
+	_ sender.StateHandler,
+) (sender.Session, error) {
+	if s.bindErr != nil {
+		return nil, s.bindErr
+	}
+	s.session.handler = handler
+	return s.session, nil
+}
+
+func (s *testSender) Diagnose(*account.Account) []sender.DiagnosticStep {
+	return nil
+}
+
+// testSession answers every message with the result of respond and then
+// delivers receipts with states by message ID.
+type testSession struct {
+	respond  func(req *sender.Request) (sender.SendResult, error)
+	receipts map[string]string
+	handler  sender.PDUHandler
+	closed   bool
+}
+
+func (s *testSession) SendMessage(req *sender.Request) error {
+	_, err := s.Send(context.Background(), req)
+	return err
+}
+
+func (s *testSession) Send(ctx context.Context, req *sender.Request) (sender.SendResult, error) {
+	res, err := s.respond(req)
+	for _, seg := range res.Segments {
+		if state, ok := s.receipts[seg.MessageID]; ok {
+			s.handler(sender.Inbound, &sender.DeliverSMPDU{
+				Header:       sender.Header{Command: sender.DeliverSM},
+				MessageID:    seg.MessageID,
+				ReceiptState: state,
+			})
+		}
+	}
+	return res, err
+}
+
+func (s *testSession) InFlight() (int, int)          { return 0, 0 }
+func (s *testSession) Stats() []sender.ResponseStats { return nil }
+func (s *testSession) Binds() []sender.BindStatus    { return nil }
+func (s *testSession) State() sender.SessionState    { return sender.StateBound }
+func (s *testSession) Close() error                  { s.closed = true; return nil }
+
+// respondWith returns a respond function giving the same segments to every
+// message.
+func respondWith(segments ...sender.SegmentResult) func(*sender.Request) (sender.SendResult, error) {
+	return func(*sender.Request) (sender.SendResult, error) {
+		return sender.SendResult{Segments: segments}, nil
+	}
+}
+
+var (
+	acceptedSeg = sender.SegmentResult{Sequence: 1, Status: sender.ESME_ROK, MessageID: "m1"}
+	rejectedSeg = sender.SegmentResult{Sequence: 1, Status: sender.ESME_RTHROTTLED}
+)
+
+// runApp runs args against a single account and returns the exit code with
+// stdout and stderr.
+func runApp(t *testing.T, snd sender.Sender, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	a := &app{
+		repo:   testRepo{{ID: "acc1", SystemID: "test", Host: "localhost", Port: 2775, BindType: account.Transceiver}},
+		sender: snd,
+		stdout: &stdout,
+		stderr: &stderr,
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(a, args[1:]), stdout.String(), stderr.String()
+		}
+	}
+	t.Fatalf("no command %s", args[0])
+	return 0, "", ""
+}
@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"smppizdez/sender"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type addressJson struct {
+	TON  string `json:"ton"`
+	NPI  string `json:"npi"`
+	Addr string `json:"addr"`
+}
+
+type tlvJson struct {
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+// pduJson is a line printed by listen. Fields not carried by the PDU are
+// omitted. A request left without response is printed with direction
+// "timeout", the command of the request and no status.
+type pduJson struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Command   string    `json:"command"`
+	Status    string    `json:"status,omitempty"`
+	Sequence  uint32    `json:"sequence"`
+
+	Ref       int    `json:"ref,omitempty"`
+	Total     int    `json:"total,omitempty"`
+	Seq       int    `json:"seq,omitempty"`
+	Retry     int    `json:"retry,omitempty"`
+	MessageID string `json:"messageId,omitempty"`
+	Timeout   string `json:"timeout,omitempty"`
+
+	Source       *addressJson `json:"source,omitempty"`
+	Destination  *addressJson `json:"destination,omitempty"`
+	EsmClass     *int         `json:"esmClass,omitempty"`
+	Coding       string       `json:"coding,omitempty"`
+	Message      string       `json:"message,omitempty"`
+	ReceiptState string       `json:"receiptState,omitempty"`
+	Optional     []tlvJson    `json:"tlvs,omitempty"`
+}
+
+func addressToJson(addr sender.Address) *addressJson {
+	return &addressJson{TON: addr.TON.String(), NPI: addr.NPI.String(), Addr: addr.Addr}
+}
+
+func pduToJson(dir sender.Direction, pd sender.PDU) pduJson {
+	hdr := pd.GetHeader()
+	j := pduJson{
+		Time:      time.Now(),
+		Direction: strings.ToLower(dir.String()),
+		Command:   hdr.Command.String(),
+		Status:    hdr.Status.String(),
+		Sequence:  hdr.Sequence,
+	}
+
+	switch p := pd.(type) {
+	case *sender.SubmitSMPDU:
+		j.Ref = p.Ref
+		j.Total = p.Total
+		j.Seq = p.Seq
+		j.Retry = p.Retry
+	case *sender.SubmitSMRespPDU:
+		j.MessageID = p.MessageID
+	case *sender.NoResponsePDU:
+		j.Direction = "timeout"
+		j.Status = ""
+		j.Timeout = p.Timeout.String()
+	case *sender.DeliverSMPDU:
+		j.Source = addressToJson(p.Source)
+		j.Destination = addressToJson(p.Destination)
+		j.EsmClass = &p.EsmClass
+		j.Coding = p.Coding.String()
+		j.Message = p.Message
+		j.MessageID = p.MessageID
+		j.ReceiptState = p.ReceiptState
+		for _, tlv := range p.Optional {
+			j.Optional = append(j.Optional, tlvJson{
+				Tag:   fmt.Sprintf("%04x", tlv.Tag),
+				Value: hex.EncodeToString(tlv.Value),
+			})
+		}
+	}
+	return j
+}
+
+// commandsFlag accepts a comma separated list of command names.
+type commandsFlag map[sender.Command]bool
+
+func (f commandsFlag) String() string {
+	var names []string
+	for cmd := range f {
+		names = append(names, cmd.String())
+	}
+	return strings.Join(names, ",")
+}
+
+func (f commandsFlag) Set(s string) error {
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for cmd := sender.BindTransceiver; cmd <= sender.GenericNack; cmd++ {
+			if strings.EqualFold(cmd.String(), name) {
+				f[cmd] = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown command %s", name)
+		}
+	}
+	return nil
+}
+
+// esmClassFlag matches esm_class given as VALUE or VALUE/MASK in hex.
+type esmClassFlag struct {
+	value byte
+	mask  byte
+	set   bool
+}
+
+func (f *esmClassFlag) String() string {
+	if f == nil || !f.set {
+		return ""
+	}
+	return fmt.Sprintf("%02x/%02x", f.value, f.mask)
+}
+
+func (f *esmClassFlag) Set(s string) error {
+	valueStr, maskStr, hasMask := strings.Cut(s, "/")
+	value, err := strconv.ParseUint(valueStr, 16, 8)
+	if err != nil {
+		return errors.New("must be a hex byte, optionally followed by /MASK")
+	}
+	mask := uint64(0xff)
+	if hasMask {
+		mask, err = strconv.ParseUint(maskStr, 16, 8)
+		if err != nil {
+			return errors.New("mask must be a hex byte")
+		}
+	}
+	f.value = byte(value & mask)
+	f.mask = byte(mask)
+	f.set = true
+	return nil
+}
+
+// match reports whether pd passes the filter. Only deliver_sm carries
+// esm_class, so other PDUs never pass an active filter.
+func (f *esmClassFlag) match(pd sender.PDU) bool {
+	if !f.set {
+		return true
+	}
+	dlv, ok := pd.(*sender.DeliverSMPDU)
+	return ok && byte(dlv.EsmClass)&f.mask == f.value
+}
+
+// pduPrinter writes PDUs passing the filters as JSON lines. The first write
+// error is sent to failed and nothing is written after it.
+type pduPrinter struct {
+	commands commandsFlag
+	esmClass esmClassFlag
+	failed   chan error
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+func (p *pduPrinter) handler(dir sender.Direction, pd sender.PDU) {
+	if len(p.commands) > 0 && !p.commands[pd.GetHeader().Command] {
+		return
+	}
+	if !p.esmClass.match(pd) {
+		return
+	}
+
+	j := pduToJson(dir, pd)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return
+	}
+	if p.err = p.enc.Encode(j); p.err != nil {
+		p.failed <- p.err
+	}
+}
+
+func (a *app) listen(args []string) int {
+	var accName string
+	printer := &pduPrinter{
+		commands: make(commandsFlag),
+		failed:   make(chan error, 1),
+		enc:      json.NewEncoder(a.stdout),
+	}
+
+	fs := a.newFlagSet("listen")
+	fs.StringVar(&accName, "account", "", "account `ID`, system_id or system_id@host")
+	fs.Var(printer.commands, "command", "print only PDUs of these comma separated `commands` (e.g. deliver_sm,unbind)")
+	fs.Var(&printer.esmClass, "esm-class", "print only deliver_sm with esm_class `VALUE[/MASK]` in hex (e.g. 04/3c for receipts)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if accName == "" {
+		return a.usageError("-account is required")
+	}
+
+	acc, err := a.findAccount(accName)
+	if err != nil {
+		fmt.Fprintln(a.stderr, err)
+		return ExitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	closed := make(chan error, 1)
+	session, err := a.sender.StartSession(
+		acc,
+		printer.handler,
+		func(err error) {
+			a.closeHandler(err)
+			closed <- err
+		},
+		a.reconnectHandler,
+		func(sender.SessionState) {},
+	)
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Failed to bind: %v\n", err)
+		return ExitFailure
+	}
+
+	select {
+	case <-ctx.Done():
+		stop()
+		if err := session.Close(); err != nil {
+			fmt.Fprintf(a.stderr, "Unbind: %v\n", err)
+			return ExitFailure
+		}
+		return ExitOK
+	case err := <-printer.failed:
+		// Nobody reads the output anymore, e.g. the pipe was closed.
+		stop()
+		fmt.Fprintf(a.stderr, "Failed to write PDU: %v\n", err)
+		session.Close()
+		return ExitFailure
+	case err := <-closed:
+		// SMSC unbound us or the connection was lost for good.
+		if err != nil {
+			return ExitFailure
+		}
+		return ExitOK
+	}
+}
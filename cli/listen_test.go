@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"smppizdez/sender"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandsFlag(t *testing.T) {
+	f := make(commandsFlag)
+	if err := f.Set("deliver_sm, UNBIND"); err != nil {
+		t.Fatal(err)
+	}
+	if len(f) != 2 || !f[sender.DeliverSM] || !f[sender.Unbind] {
+		t.Fatalf("got %v, want deliver_sm and unbind", f)
+	}
+	if err := f.Set("deliver"); err == nil {
+		t.Fatal("unknown command accepted")
+	}
+}
+
+func TestEsmClassFlag(t *testing.T) {
+	tests := []struct {
+		value string
+		want  esmClassFlag
+		err   bool
+	}{
+		{value: "04", want: esmClassFlag{value: 0x04, mask: 0xff, set: true}},
+		{value: "04/3c", want: esmClassFlag{value: 0x04, mask: 0x3c, set: true}},
+		// Bits outside of the mask are dropped from the value.
+		{value: "ff/0f", want: esmClassFlag{value: 0x0f, mask: 0x0f, set: true}},
+		{value: "100", err: true},
+		{value: "04/x", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var f esmClassFlag
+			err := f.Set(tt.value)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v", err)
+			}
+			if err == nil && f != tt.want {
+				t.Fatalf("got %+v, want %+v", f, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDUPrinterFilters(t *testing.T) {
+	receipt := &sender.DeliverSMPDU{Header: sender.Header{Command: sender.DeliverSM}, EsmClass: 0x04, MessageID: "m1"}
+	mo := &sender.DeliverSMPDU{Header: sender.Header{Command: sender.DeliverSM}, EsmClass: 0x00, Message: "hi"}
+	unbind := &sender.GenericPDU{Header: sender.Header{Command: sender.Unbind}}
+	submit := &sender.SubmitSMPDU{Header: sender.Header{Command: sender.SubmitSM}}
+	timeout := &sender.NoResponsePDU{Header: sender.Header{Command: sender.SubmitSM, Sequence: 7}, Timeout: time.Second}
+
+	tests := []struct {
+		name     string
+		commands string
+		esmClass string
+		want     []string
+	}{
+		{name: "all", want: []string{"DELIVER_SM", "DELIVER_SM", "UNBIND", "SUBMIT_SM", "SUBMIT_SM"}},
+		{name: "commands", commands: "deliver_sm,unbind", want: []string{"DELIVER_SM", "DELIVER_SM", "UNBIND"}},
+		{name: "receipts", esmClass: "04/3c", want: []string{"DELIVER_SM"}},
+		{name: "both", commands: "unbind", esmClass: "04/3c", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			p := &pduPrinter{commands: make(commandsFlag), failed: make(chan error, 1), enc: json.NewEncoder(&out)}
+			if tt.commands != "" {
+				p.commands.Set(tt.commands)
+			}
+			if tt.esmClass != "" {
+				p.esmClass.Set(tt.esmClass)
+			}
+
+			p.handler(sender.Inbound, receipt)
+			p.handler(sender.Inbound, mo)
+			p.handler(sender.Inbound, unbind)
+			p.handler(sender.Outbound, submit)
+			p.handler(sender.Inbound, timeout)
+
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				if line == "" {
+					continue
+				}
+				var j pduJson
+				if err := json.Unmarshal([]byte(line), &j); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, j.Command)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("printed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDUToJsonTimeout(t *testing.T) {
+	pd := &sender.NoResponsePDU{Header: sender.Header{Command: sender.SubmitSM, Sequence: 7}, Timeout: time.Second}
+	data, err := json.Marshal(pduToJson(sender.Inbound, pd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var j map[string]any
+	if err := json.Unmarshal(data, &j); err != nil {
+		t.Fatal(err)
+	}
+	if j["direction"] != "timeout" || j["command"] != "SUBMIT_SM" || j["timeout"] != "1s" {
+		t.Fatalf("got %s", data)
+	}
+	if _, ok := j["status"]; ok {
+		t.Fatalf("missing response has a status: %s", data)
+	}
+}
+
+// failingWriter fails every write, as a closed pipe does.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestPDUPrinterStopsOnWriteError(t *testing.T) {
+	p := &pduPrinter{commands: make(commandsFlag), failed: make(chan error, 1), enc: json.NewEncoder(failingWriter{})}
+	unbind := &sender.GenericPDU{Header: sender.Header{Command: sender.Unbind}}
+	p.handler(sender.Inbound, unbind)
+	p.handler(sender.Inbound, unbind)
+
+	select {
+	case err := <-p.failed:
+		if err == nil {
+			t.Fatal("nil error reported")
+		}
+	default:
+		t.Fatal("write error not reported")
+	}
+	if len(p.failed) != 0 {
+		t.Fatal("write error reported twice")
+	}
+}
+
+func TestListenExitCodes(t *testing.T) {
+	if code, _, _ := runApp(t, &testSender{}, "listen"); code != ExitUsage {
+		t.Fatalf("got exit code %d without -account, want %d", code, ExitUsage)
+	}
+	if code, _, _ := runApp(t, &testSender{}, "listen", "-account", "test", "-command", "nope"); code != ExitUsage {
+		t.Fatalf("got exit code %d with unknown command, want %d", code, ExitUsage)
+	}
+	code, _, stderr := runApp(t, &testSender{bindErr: errors.New("refused")}, "listen", "-account", "test")
+	if code != ExitFailure || !strings.Contains(stderr, "Failed to bind") {
+		t.Fatalf("got exit code %d, stderr %q when bind fails", code, stderr)
+	}
+}
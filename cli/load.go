@@ -0,0 +1,213 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"smppizdez/coding"
+	"smppizdez/loadtest"
+	"smppizdez/sender"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// mixFlag accepts a comma separated list of CODING/SPLIT/LENGTH[/WEIGHT].
+type mixFlag struct {
+	entries []loadtest.MixEntry
+	codings []named[coding.Coding]
+}
+
+func (f *mixFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	entries := make([]string, len(f.entries))
+	for i, e := range f.entries {
+		entries[i] = fmt.Sprintf("%v/%d", e, e.Weight)
+	}
+	return strings.Join(entries, ",")
+}
+
+func (f *mixFlag) Set(s string) error {
+	f.entries = nil
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), "/")
+		if len(parts) != 3 && len(parts) != 4 {
+			return errors.New("entries must be CODING/SPLIT/LENGTH[/WEIGHT]")
+		}
+
+		e := loadtest.MixEntry{Weight: 1}
+		if err := newChoiceFlag(&e.Coding, f.codings).Set(parts[0]); err != nil {
+			return fmt.Errorf("coding %w", err)
+		}
+		if err := newChoiceFlag(&e.SplitMode, splitModeNames).Set(parts[1]); err != nil {
+			return fmt.Errorf("split mode %w", err)
+		}
+		length, err := strconv.Atoi(parts[2])
+		if err != nil || length <= 0 {
+			return errors.New("length must be a positive number")
+		}
+		e.Length = length
+		if len(parts) == 4 {
+			e.Weight, err = strconv.Atoi(parts[3])
+			if err != nil || e.Weight <= 0 {
+				return errors.New("weight must be a positive number")
+			}
+		}
+		f.entries = append(f.entries, e)
+	}
+	return nil
+}
+
+// parseDestinations parses comma separated ranges or random:PREFIX:LENGTH.
+func parseDestinations(s string) (loadtest.Destinations, error) {
+	if rest, ok := strings.CutPrefix(s, "random:"); ok {
+		prefix, lengthStr, _ := strings.Cut(rest, ":")
+		length, err := strconv.Atoi(lengthStr)
+		if err != nil || length <= len(prefix) {
+			return nil, errors.New("random destinations must be random:PREFIX:LENGTH with LENGTH longer than PREFIX")
+		}
+		return loadtest.Random(prefix, length), nil
+	}
+
+	var ranges []loadtest.Range
+	for _, part := range strings.Split(s, ",") {
+		r, err := loadtest.ParseRange(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return loadtest.Sequential(ranges), nil
+}
+
+func (a *app) load(args []string) int {
+	req := a.newRequest()
+	f := sendFlags{}
+	cfg := loadtest.Config{
+		Sessions:       1,
+		TPS:            10,
+		Duration:       time.Minute,
+		ReceiptWait:    time.Minute,
+		ReportInterval: time.Second,
+	}
+	mix := &mixFlag{codings: codingNames(a.supportedCodings())}
+	var to, reportPath string
+
+	fs := a.newFlagSet("load")
+	a.addRequestFlags(fs, req, &f)
+	fs.StringVar(&to, "to", "", "comma separated destination ranges `FROM-TO` or random:PREFIX:LENGTH")
+	fs.Var(mix, "mix", "message mix as comma separated `CODING/SPLIT/LENGTH[/WEIGHT]` (default is -coding, -split and 160 characters)")
+	fs.IntVar(&cfg.Sessions, "sessions", cfg.Sessions, "number of sessions")
+	fs.Float64Var(&cfg.TPS, "tps", cfg.TPS, "target messages per second over all sessions")
+	fs.DurationVar(&cfg.Duration, "duration", cfg.Duration, "time to submit messages for")
+	fs.DurationVar(&cfg.ReceiptWait, "receipt-wait", cfg.ReceiptWait, "time to wait for delivery receipts after the last message")
+	fs.DurationVar(&cfg.ReportInterval, "interval", cfg.ReportInterval, "interval of the live summary, 0 disables it")
+	fs.StringVar(&reportPath, "report", "-", "`path` of the final JSON report, - for stdout")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if to == "" {
+		return a.usageError("-to is required")
+	}
+	destinations, err := parseDestinations(to)
+	if err != nil {
+		return a.usageError("Invalid -to: %v", err)
+	}
+	cfg.Destinations = destinations
+	if cfg.Sessions <= 0 || cfg.TPS <= 0 || cfg.Duration <= 0 {
+		return a.usageError("-sessions, -tps and -duration must be positive")
+	}
+	if code := a.completeRequest(req, &f, true); code != ExitOK {
+		return code
+	}
+	if req.IsBinary {
+		return a.usageError("-hex and -file aren't supported, message text is generated from -mix")
+	}
+
+	cfg.Mix = mix.entries
+	if len(cfg.Mix) == 0 {
+		cfg.Mix = []loadtest.MixEntry{{Coding: req.EffectiveCoding, SplitMode: req.SplitMode, Length: 160, Weight: 1}}
+	}
+	cfg.Base = *req
+
+	cfg.Account, err = a.findAccount(f.account)
+	if err != nil {
+		fmt.Fprintln(a.stderr, err)
+		return ExitUsage
+	}
+	cfg.OnReport = a.printLoadReport
+	cfg.OnClose = func(session int, err error) {
+		fmt.Fprintf(a.stderr, "Session %d closed: %v\n", session, err)
+	}
+	cfg.OnReconnect = func(session int, ev sender.ReconnectEvent) {
+		fmt.Fprintf(a.stderr, "Session %d: %s\n", session, reconnectMessage(ev))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := loadtest.Run(ctx, a.sender, cfg)
+	var bindErr *loadtest.BindError
+	switch {
+	case errors.Is(err, loadtest.InvalidMix):
+		return a.usageError("Invalid -mix: %v", err)
+	case errors.Is(err, loadtest.InvalidConfig):
+		return a.usageError("%v", err)
+	case errors.As(err, &bindErr):
+		fmt.Fprintf(a.stderr, "Failed to bind %v\n", bindErr)
+		return ExitFailure
+	case err != nil:
+		fmt.Fprintf(a.stderr, "Load test failed: %v\n", err)
+		return ExitFailure
+	}
+	a.printLoadReport(report)
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Failed to encode report: %v\n", err)
+		return ExitFailure
+	}
+	data = append(data, '\n')
+	if reportPath == "-" {
+		_, err = a.stdout.Write(data)
+	} else {
+		err = os.WriteFile(reportPath, data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Failed to write report: %v\n", err)
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// printLoadReport prints a one line summary of r.
+func (a *app) printLoadReport(r loadtest.Report) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%6.1fs %d msg %.1f msg/s %.1f seg/s", r.ElapsedS, r.Messages, r.AchievedTPS, r.SegmentsTPS)
+	for _, status := range slices.Sorted(maps.Keys(r.Statuses)) {
+		fmt.Fprintf(&b, " %s=%d", status, r.Statuses[status])
+	}
+	for _, kind := range slices.Sorted(maps.Keys(r.Errors)) {
+		fmt.Fprintf(&b, " %q=%d", kind, r.Errors[kind])
+	}
+	fmt.Fprintf(&b, " p50=%.1fms p95=%.1fms p99=%.1fms", r.Latency.P50, r.Latency.P95, r.Latency.P99)
+	if r.Receipts.Expected > 0 {
+		fmt.Fprintf(&b, " receipts=%d/%d %.1f/s", r.Receipts.Arrived, r.Receipts.Expected, r.Receipts.PerSecond)
+	}
+	if r.Receipts.Unmatched > 0 {
+		fmt.Fprintf(&b, " unmatched=%d", r.Receipts.Unmatched)
+	}
+	if r.Receipts.Untracked > 0 {
+		fmt.Fprintf(&b, " untracked=%d", r.Receipts.Untracked)
+	}
+	fmt.Fprintln(a.stderr, b.String())
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"smppizdez/loadtest"
+	"strings"
+	"testing"
+)
+
+func TestLoadExitCodes(t *testing.T) {
+	accepting := &testSender{session: &testSession{respond: respondWith(acceptedSeg)}}
+	args := func(extra ...string) []string {
+		return append([]string{"load", "-account", "test", "-from", "1", "-to", "100-199", "-interval", "0"}, extra...)
+	}
+
+	tests := []struct {
+		name   string
+		sender *testSender
+		args   []string
+		want   int
+		stderr string
+	}{
+		{name: "missing -to", sender: accepting, args: []string{"load", "-account", "test", "-from", "1"}, want: ExitUsage},
+		{name: "zero tps", sender: accepting, args: args("-tps", "0"), want: ExitUsage},
+		{name: "zero sessions", sender: accepting, args: args("-sessions", "0"), want: ExitUsage},
+		{name: "invalid mix", sender: accepting, args: args("-mix", "GSM7/x/160"), want: ExitUsage},
+		{
+			name:   "bind error",
+			sender: &testSender{bindErr: errors.New("refused")},
+			args:   args(),
+			want:   ExitFailure,
+			stderr: "Failed to bind session 1: refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := runApp(t, tt.sender, tt.args...)
+			if code != tt.want {
+				t.Fatalf("got exit code %d, want %d; stderr %q", code, tt.want, stderr)
+			}
+			if !strings.Contains(stderr, tt.stderr) {
+				t.Fatalf("stderr %q doesn't contain %q", stderr, tt.stderr)
+			}
+		})
+	}
+}
+
+func TestLoadReport(t *testing.T) {
+	snd := &testSender{session: &testSession{respond: respondWith(acceptedSeg)}}
+	code, stdout, stderr := runApp(t, snd,
+		"load", "-account", "test", "-from", "1", "-to", "100-199",
+		"-tps", "50", "-duration", "100ms", "-receipt-wait", "0", "-interval", "0",
+	)
+	if code != ExitOK {
+		t.Fatalf("got exit code %d, want %d; stderr %q", code, ExitOK, stderr)
+	}
+
+	var report loadtest.Report
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("report %q isn't JSON: %v", stdout, err)
+	}
+	if report.Messages == 0 || report.Statuses["ESME_ROK"] != report.Messages {
+		t.Fatalf("got %d message(s) with statuses %v, want all accepted", report.Messages, report.Statuses)
+	}
+	if !strings.Contains(stderr, " msg/s ") {
+		t.Fatalf("stderr %q has no summary", stderr)
+	}
+}
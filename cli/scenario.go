@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"smppizdez/scenario"
+	"smppizdez/sender"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func (a *app) scenario(args []string) int {
+	var junitPath string
+
+	fs := a.newFlagSet("scenario")
+	fs.StringVar(&junitPath, "junit", "", "write JUnit XML report to `path`")
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: smppizdez scenario [flags] FILE...\n\n")
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	if err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() == 0 {
+		return a.usageError("At least one scenario file is required")
+	}
+
+	var scenarios []*scenario.Scenario
+	for _, path := range fs.Args() {
+		sc, err := a.loadScenario(path)
+		if err != nil {
+			return a.usageError("%s: %v", path, err)
+		}
+		scenarios = append(scenarios, sc)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	code := ExitOK
+	var reports []scenario.Report
+	for _, sc := range scenarios {
+		report := scenario.Run(ctx, a.sender, sc)
+		reports = append(reports, report)
+		a.printScenarioReport(report)
+		if report.Count(scenario.Failed) > 0 {
+			code = ExitFailure
+		}
+	}
+
+	if junitPath != "" {
+		if err := writeJUnit(junitPath, reports); err != nil {
+			fmt.Fprintf(a.stderr, "Failed to write JUnit report: %v\n", err)
+			return ExitFailure
+		}
+	}
+	return code
+}
+
+// loadScenario parses the scenario at path and resolves its accounts and
+// requests.
+func (a *app) loadScenario(path string) (*scenario.Scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc, err := scenario.Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	if sc.Name == "" {
+		sc.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	for i := range sc.Steps {
+		step := &sc.Steps[i]
+		switch {
+		case step.Bind != nil:
+			step.Bind.Resolved, err = a.findAccount(step.Bind.Account)
+		case step.Send != nil:
+			step.Send.Request, err = a.requestFromOptions(step.Send.Options)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", step.Title(i), err)
+		}
+	}
+	return sc, nil
+}
+
+// requestFromOptions makes a request of send step options, named as send
+// command flags without the dash.
+func (a *app) requestFromOptions(options map[string]any) (*sender.Request, error) {
+	var errs bytes.Buffer
+	sub := &app{repo: a.repo, sender: a.sender, stdout: io.Discard, stderr: &errs}
+	req := sub.newRequest()
+	var f sendFlags
+
+	fs := sub.newFlagSet("send")
+	fs.Usage = func() {}
+	sub.addRequestFlags(fs, req, &f)
+	fs.StringVar(&req.Destination.Addr, "to", "", "destination address")
+	fs.StringVar(&f.text, "text", "", "message text")
+
+	var args []string
+	for _, name := range slices.Sorted(maps.Keys(options)) {
+		values, ok := options[name].([]any)
+		if !ok {
+			values = []any{options[name]}
+		}
+		for _, v := range values {
+			s, err := optionValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("Option %s %w", name, err)
+			}
+			args = append(args, "-"+name+"="+s)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if f.account != "" {
+		return nil, errors.New("Account is given by bind step")
+	}
+	if req.Destination.Addr == "" {
+		return nil, errors.New("Option to is required")
+	}
+	if code := sub.completeRequest(req, &f, false); code != ExitOK {
+		return nil, errors.New(strings.TrimSpace(errs.String()))
+	}
+	return req, nil
+}
+
+func optionValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", errors.New("must be a string, number, boolean or array of them")
+	}
+}
+
+func (a *app) printScenarioReport(report scenario.Report) {
+	fmt.Fprintf(a.stdout, "Scenario %s\n", report.Name)
+	for _, step := range report.Steps {
+		fmt.Fprintf(a.stdout, "  %v %s", step.Status, step.Title)
+		switch step.Status {
+		case scenario.Passed:
+			fmt.Fprintf(a.stdout, " (%v)", step.Duration.Round(time.Millisecond))
+		case scenario.Failed:
+			fmt.Fprintf(a.stdout, ": %v", step.Err)
+		}
+		fmt.Fprintln(a.stdout)
+	}
+	fmt.Fprintf(
+		a.stdout,
+		"%d passed, %d failed, %d skipped in %v\n",
+		report.Count(scenario.Passed),
+		report.Count(scenario.Failed),
+		report.Count(scenario.Skipped),
+		report.Duration.Round(time.Millisecond),
+	)
+}
+
+func writeJUnit(path string, reports []scenario.Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = scenario.WriteJUnit(f, reports)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
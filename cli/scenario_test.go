@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScenarioExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, json string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(json), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	passing := write("passing.json", `{"steps": [
+		{"bind": {"account": "test"}},
+		{"send": {"from": "1", "to": "2", "text": "hi"}},
+		{"expectResp": {"status": "ESME_ROK"}},
+		{"unbind": {}}
+	]}`)
+	failing := write("failing.json", `{"steps": [
+		{"bind": {"account": "test"}},
+		{"send": {"from": "1", "to": "2", "text": "hi"}},
+		{"expectResp": {"status": "ESME_RTHROTTLED"}}
+	]}`)
+	unknownAccount := write("unknown.json", `{"steps": [{"bind": {"account": "nobody"}}]}`)
+	junit := filepath.Join(dir, "junit.xml")
+
+	tests := []struct {
+		name   string
+		args   []string
+		want   int
+		stdout string
+	}{
+		{name: "no files", args: []string{"scenario"}, want: ExitUsage},
+		{name: "missing file", args: []string{"scenario", filepath.Join(dir, "missing.json")}, want: ExitUsage},
+		{name: "unknown account", args: []string{"scenario", unknownAccount}, want: ExitUsage},
+		{name: "passed", args: []string{"scenario", passing}, want: ExitOK, stdout: "4 passed, 0 failed"},
+		{
+			name:   "failed",
+			args:   []string{"scenario", "-junit", junit, passing, failing},
+			want:   ExitFailure,
+			stdout: "Scenario failing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snd := &testSender{session: &testSession{respond: respondWith(acceptedSeg)}}
+			code, stdout, stderr := runApp(t, snd, tt.args...)
+			if code != tt.want {
+				t.Fatalf("got exit code %d, want %d; stderr %q", code, tt.want, stderr)
+			}
+			if !strings.Contains(stdout, tt.stdout) {
+				t.Fatalf("stdout %q doesn't contain %q", stdout, tt.stdout)
+			}
+		})
+	}
+
+	report, err := os.ReadFile(junit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), `name="passing"`) || !strings.Contains(string(report), "<failure") {
+		t.Fatalf("JUnit report %s doesn't cover both scenarios", report)
+	}
+}
@@ -0,0 +1,497 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"smppizdez/coding"
+	"smppizdez/sender"
+	"smppizdez/smpp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var NoReceipt = errors.New("No delivery receipt within timeout")
+
+var tonNames = []named[sender.TON]{
+	{sender.TONUnknown, "unknown"},
+	{sender.TONInternational, "international"},
+	{sender.TONNational, "national"},
+	{sender.TONNetworkSpecific, "network-specific"},
+	{sender.TONSubscriberNumber, "subscriber"},
+	{sender.TONAlphanumeric, "alphanumeric"},
+	{sender.TONAbbreviated, "abbreviated"},
+}
+
+var npiNames = []named[sender.NPI]{
+	{sender.NPIUnknown, "unknown"},
+	{sender.NPIISDN, "isdn"},
+	{sender.NPIData, "data"},
+	{sender.NPITelex, "telex"},
+	{sender.NPILandMobile, "land-mobile"},
+	{sender.NPINational, "national"},
+	{sender.NPIPrivate, "private"},
+	{sender.NPIERMES, "ermes"},
+	{sender.NPIInternet, "internet"},
+	{sender.NPIWAP, "wap"},
+}
+
+var splitModeNames = []named[sender.SplitMode]{
+	{sender.SplitUDH, "udh"},
+	{sender.SplitSAR, "sar"},
+	{sender.SplitMessagePayload, "payload"},
+	{sender.SplitNone, "none"},
+}
+
+var concatIENames = []named[sender.ConcatIE]{
+	{sender.Concat8Bit, "8"},
+	{sender.Concat16Bit, "16"},
+}
+
+var refModeNames = []named[sender.RefMode]{
+	{sender.RefAuto, "auto"},
+	{sender.RefPerDestination, "per-destination"},
+	{sender.RefExplicit, "explicit"},
+}
+
+var portAddressingNames = []named[sender.PortAddressing]{
+	{sender.PortsNone, "none"},
+	{sender.Ports8Bit, "8"},
+	{sender.Ports16Bit, "16"},
+}
+
+var registeredDeliveryNames = []named[sender.RegisteredDelivery]{
+	{sender.RdRequested, "requested"},
+	{sender.RdOnFailure, "failure"},
+	{sender.RdIntermediate, "intermediate"},
+}
+
+func codingNames(codings []coding.Coding) []named[coding.Coding] {
+	names := make([]named[coding.Coding], len(codings))
+	for i, cod := range codings {
+		names[i] = named[coding.Coding]{cod, strings.ToLower(cod.String())}
+	}
+	return names
+}
+
+// waitMode tells how long send waits after submission.
+type waitMode int
+
+const (
+	waitNone waitMode = iota + 1
+	waitResponse
+	waitReceipt
+)
+
+var waitModeNames = []named[waitMode]{
+	{waitNone, "none"},
+	{waitResponse, "resp"},
+	{waitReceipt, "receipt"},
+}
+
+// registeredDeliveryFlag accepts a comma separated list of receipt kinds.
+type registeredDeliveryFlag struct {
+	value *sender.RegisteredDelivery
+}
+
+func (f registeredDeliveryFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	var kinds []string
+	for _, n := range registeredDeliveryNames {
+		if *f.value&n.value != 0 {
+			kinds = append(kinds, n.name)
+		}
+	}
+	return strings.Join(kinds, ",")
+}
+
+func (f registeredDeliveryFlag) Set(s string) error {
+	*f.value = sender.RdNotRequested
+	for _, kind := range strings.Split(s, ",") {
+		idx := slices.IndexFunc(registeredDeliveryNames, func(n named[sender.RegisteredDelivery]) bool {
+			return strings.EqualFold(n.name, strings.TrimSpace(kind))
+		})
+		if idx < 0 {
+			return errors.New("must be a list of requested, failure, intermediate")
+		}
+		*f.value |= registeredDeliveryNames[idx].value
+	}
+	return nil
+}
+
+// sendFlags holds flags of send that don't map to Request fields directly.
+type sendFlags struct {
+	account   string
+	text      string
+	hex       string
+	file      string
+	dcs       string
+	ref       uint
+	srcPort   uint
+	dstPort   uint
+	tlvs      hexPairsFlag
+	ies       hexPairsFlag
+	wait      waitMode
+	timeout   time.Duration
+	deceptive *choiceFlag[coding.Coding]
+}
+
+// newRequest returns a request with the defaults of the submit form.
+func (a *app) newRequest() *sender.Request {
+	return &sender.Request{
+		Source:          sender.Address{TON: sender.TONUnknown, NPI: sender.NPIUnknown},
+		Destination:     sender.Address{TON: sender.TONUnknown, NPI: sender.NPIUnknown},
+		EffectiveCoding: a.supportedCodings()[0],
+		SplitMode:       sender.SplitUDH,
+		ConcatIE:        sender.Concat8Bit,
+		RefMode:         sender.RefAuto,
+		BytePerSegment:  140,
+		Ports:           sender.ApplicationPorts{Addressing: sender.PortsNone},
+	}
+}
+
+// supportedCodings returns codings of the sender in the order of the submit
+// form.
+func (a *app) supportedCodings() []coding.Coding {
+	codings := a.sender.SupportedCodings()
+	slices.Sort(codings)
+	return codings
+}
+
+// addRequestFlags adds flags for every field of the submit form, except
+// destination address.
+func (a *app) addRequestFlags(fs *flag.FlagSet, req *sender.Request, f *sendFlags) {
+	f.tlvs = hexPairsFlag{bits: 16}
+	f.ies = hexPairsFlag{bits: 8}
+
+	fs.StringVar(&f.account, "account", "", "account `ID`, system_id or system_id@host")
+	fs.StringVar(&req.Source.Addr, "from", "", "source address")
+	fs.Var(newChoiceFlag(&req.Source.TON, tonNames), "from-ton", "source TON")
+	fs.Var(newChoiceFlag(&req.Source.NPI, npiNames), "from-npi", "source NPI")
+	fs.Var(newChoiceFlag(&req.Destination.TON, tonNames), "to-ton", "destination TON")
+	fs.Var(newChoiceFlag(&req.Destination.NPI, npiNames), "to-npi", "destination NPI")
+	fs.StringVar(&f.hex, "hex", "", "binary message as a hex string")
+	fs.StringVar(&f.file, "file", "", "binary message read from `path`")
+	fs.StringVar(&req.ValidityPeriod, "validity", "", "validity period")
+	fs.Var(newChoiceFlag(&req.EffectiveCoding, codingNames(a.supportedCodings())),
+		"coding", "coding the message is encoded with")
+	f.deceptive = newChoiceFlag(&req.DeceptiveCoding, codingNames(coding.All))
+	fs.Var(f.deceptive, "deceptive-coding", "coding put into data_coding (defaults to -coding)")
+	fs.StringVar(&f.dcs, "dcs", "", "raw data_coding hex `byte`, overrides -deceptive-coding")
+	fs.Var(newChoiceFlag(&req.SplitMode, splitModeNames), "split", "split mode: udh, sar, payload or none")
+	fs.IntVar(&req.BytePerSegment, "segment-bytes", req.BytePerSegment, "bytes per segment")
+	fs.Var(newChoiceFlag(&req.ConcatIE, concatIENames), "concat", "concatenation reference size in bits: 8 or 16")
+	fs.Var(newChoiceFlag(&req.RefMode, refModeNames), "ref-mode", "reference mode: auto, per-destination or explicit")
+	fs.UintVar(&f.ref, "ref", 0, "reference number for -ref-mode explicit")
+	fs.Var(newChoiceFlag(&req.Ports.Addressing, portAddressingNames), "ports", "application port addressing: none, 8 or 16")
+	fs.UintVar(&f.srcPort, "src-port", 0, "source application port")
+	fs.UintVar(&f.dstPort, "dst-port", 0, "destination application port")
+	fs.Var(&f.tlvs, "tlv", "optional parameter as `TAG=VALUE` in hex, may be repeated")
+	fs.Var(&f.ies, "udh", "UDH information element as `IEI=VALUE` in hex, may be repeated")
+	fs.Var(registeredDeliveryFlag{&req.RegisteredDelivery}, "receipt",
+		"registered delivery: comma separated requested, failure, intermediate")
+}
+
+func (a *app) send(args []string) int {
+	req := a.newRequest()
+	f := sendFlags{wait: waitResponse, timeout: time.Minute}
+
+	fs := a.newFlagSet("send")
+	a.addRequestFlags(fs, req, &f)
+	fs.StringVar(&req.Destination.Addr, "to", "", "destination address")
+	fs.StringVar(&f.text, "text", "", "message text")
+	fs.Var(newChoiceFlag(&f.wait, waitModeNames), "wait", "wait for nothing, submit_sm_resp or delivery receipt: none, resp or receipt")
+	fs.DurationVar(&f.timeout, "timeout", f.timeout, "time to wait for delivery receipts")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if req.Destination.Addr == "" {
+		return a.usageError("-to is required")
+	}
+	if code := a.completeRequest(req, &f, true); code != ExitOK {
+		return code
+	}
+	if f.wait == waitReceipt && req.RegisteredDelivery&sender.RdRequested == 0 {
+		return a.usageError("-wait receipt requires -receipt requested")
+	}
+
+	acc, err := a.findAccount(f.account)
+	if err != nil {
+		fmt.Fprintln(a.stderr, err)
+		return ExitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	receipts := newReceiptWaiter()
+	session, err := a.sender.StartSession(
+		acc,
+		receipts.handler,
+		a.closeHandler,
+		a.reconnectHandler,
+		func(sender.SessionState) {},
+	)
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Failed to bind: %v\n", err)
+		return ExitFailure
+	}
+	defer func() {
+		if err := session.Close(); err != nil {
+			fmt.Fprintf(a.stderr, "Unbind: %v\n", err)
+		}
+	}()
+
+	if f.wait == waitNone {
+		if err = session.SendMessage(req); err != nil {
+			fmt.Fprintf(a.stderr, "Message submission error: %v\n", err)
+			return ExitFailure
+		}
+		return ExitOK
+	}
+
+	result, err := session.Send(ctx, req)
+	code := ExitOK
+	for _, seg := range result.Segments {
+		a.printSegment(seg)
+		if code == ExitOK {
+			code = segmentCode(seg)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Message submission error: %v\n", err)
+		return ExitFailure
+	}
+	if code != ExitOK || f.wait != waitReceipt {
+		return code
+	}
+
+	ids := make([]string, len(result.Segments))
+	for i, seg := range result.Segments {
+		ids[i] = seg.MessageID
+	}
+	states, err := receipts.wait(ctx, ids, f.timeout)
+	for _, id := range ids {
+		if state, ok := states[id]; ok {
+			fmt.Fprintf(a.stdout, "receipt message_id=%s stat=%s\n", id, state)
+			if state != "DELIVRD" && code == ExitOK {
+				code = ExitUndelivered
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(a.stderr, "%v\n", err)
+		if errors.Is(err, NoReceipt) {
+			return ExitTimeout
+		}
+		return ExitFailure
+	}
+	return code
+}
+
+// completeRequest validates flags added by addRequestFlags and fills the
+// fields of req that they give. -account is checked if accountRequired.
+func (a *app) completeRequest(req *sender.Request, f *sendFlags, accountRequired bool) int {
+	if accountRequired && f.account == "" {
+		return a.usageError("-account is required")
+	}
+	if req.Source.Addr == "" {
+		return a.usageError("-from is required")
+	}
+
+	var err error
+	switch {
+	case f.hex != "" && f.file != "", f.text != "" && (f.hex != "" || f.file != ""):
+		return a.usageError("Only one of -text, -hex and -file may be given")
+	case f.hex != "":
+		req.IsBinary = true
+		req.BinaryMessage, err = parseHex(f.hex)
+		if err != nil {
+			return a.usageError("Binary message must be a hex string")
+		}
+	case f.file != "":
+		req.IsBinary = true
+		req.BinaryMessage, err = os.ReadFile(f.file)
+		if err != nil {
+			fmt.Fprintf(a.stderr, "Failed to read message: %v\n", err)
+			return ExitFailure
+		}
+	default:
+		req.Message = f.text
+	}
+
+	if !f.deceptive.set {
+		req.DeceptiveCoding = req.EffectiveCoding
+	}
+	if f.dcs != "" {
+		dcs, err := strconv.ParseUint(f.dcs, 16, 8)
+		if err != nil {
+			return a.usageError("-dcs must be a hex byte")
+		}
+		req.OverrideDataCoding = true
+		req.DataCoding = byte(dcs)
+	}
+
+	if req.BytePerSegment < 1 || req.BytePerSegment > 255 {
+		return a.usageError("-segment-bytes must be between 1 and 255")
+	}
+
+	if req.RefMode == sender.RefExplicit {
+		refBits := 16
+		if req.SplitMode == sender.SplitUDH && req.ConcatIE == sender.Concat8Bit {
+			refBits = 8
+		}
+		if f.ref >= 1<<refBits {
+			return a.usageError("-ref must be a %d-bit number", refBits)
+		}
+		req.Ref = uint16(f.ref)
+	}
+
+	if req.Ports.Addressing != sender.PortsNone {
+		bits := 16
+		if req.Ports.Addressing == sender.Ports8Bit {
+			bits = 8
+		}
+		if f.srcPort >= 1<<bits || f.dstPort >= 1<<bits {
+			return a.usageError("-src-port and -dst-port must be %d-bit numbers", bits)
+		}
+		req.Ports.Source = uint16(f.srcPort)
+		req.Ports.Destination = uint16(f.dstPort)
+	}
+
+	for i, tag := range f.tlvs.keys {
+		req.Optional = append(req.Optional, sender.TLV{Tag: uint16(tag), Value: f.tlvs.values[i]})
+	}
+	for i, id := range f.ies.keys {
+		req.InfoElements = append(req.InfoElements, sender.InfoElement{ID: byte(id), Value: f.ies.values[i]})
+	}
+	return ExitOK
+}
+
+// segmentCode returns the exit code telling the outcome of submission of
+// seg.
+func segmentCode(seg sender.SegmentResult) int {
+	switch {
+	case errors.Is(seg.Err, smpp.NoResponse):
+		return ExitTimeout
+	case seg.Err != nil:
+		return ExitFailure
+	case seg.Status != sender.ESME_ROK:
+		return ExitRejected
+	default:
+		return ExitOK
+	}
+}
+
+func (a *app) printSegment(seg sender.SegmentResult) {
+	if seg.Total > 0 {
+		fmt.Fprintf(a.stdout, "segment %d/%d ", seg.Seq, seg.Total)
+	}
+	fmt.Fprintf(a.stdout, "sequence=%d", seg.Sequence)
+	if seg.Err != nil {
+		fmt.Fprintf(a.stdout, " error=%q\n", seg.Err)
+		return
+	}
+	fmt.Fprintf(a.stdout, " status=%v message_id=%s latency=%v", seg.Status, seg.MessageID, seg.Latency)
+	if seg.Retries > 0 {
+		fmt.Fprintf(a.stdout, " retries=%d", seg.Retries)
+	}
+	fmt.Fprintln(a.stdout)
+}
+
+func (a *app) closeHandler(err error) {
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Session closed: %v\n", err)
+	}
+}
+
+func (a *app) reconnectHandler(ev sender.ReconnectEvent) {
+	fmt.Fprintln(a.stderr, reconnectMessage(ev))
+}
+
+func reconnectMessage(ev sender.ReconnectEvent) string {
+	var msg string
+	switch ev.State {
+	case sender.Reconnecting:
+		msg = fmt.Sprintf("Connection lost: %v. Reconnecting in %v (attempt %d)", ev.Err, ev.Delay, ev.Attempt)
+	case sender.Reconnected:
+		msg = fmt.Sprintf("Reconnected to %s after %d attempt(s)", ev.Endpoint, ev.Attempt)
+	}
+	if ev.ReceiveOnly {
+		msg = fmt.Sprintf("Receiver: %s, sending is not affected", msg)
+	}
+	if ev.Bind > 0 {
+		msg = fmt.Sprintf("Bind %d: %s", ev.Bind, msg)
+	}
+	return msg
+}
+
+// receiptWaiter collects delivery receipts, which may arrive before the
+// responses carrying their message IDs.
+type receiptWaiter struct {
+	mu      sync.Mutex
+	states  map[string]string
+	changed chan struct{}
+}
+
+func newReceiptWaiter() *receiptWaiter {
+	return &receiptWaiter{states: make(map[string]string), changed: make(chan struct{}, 1)}
+}
+
+func (w *receiptWaiter) handler(dir sender.Direction, pd sender.PDU) {
+	dlv, ok := pd.(*sender.DeliverSMPDU)
+	if !ok || dir != sender.Inbound || dlv.MessageID == "" || dlv.ReceiptState == "" {
+		return
+	}
+
+	w.mu.Lock()
+	w.states[dlv.MessageID] = dlv.ReceiptState
+	w.mu.Unlock()
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+}
+
+// wait waits until final receipts for all ids arrive. It returns states of
+// the receipts arrived so far.
+func (w *receiptWaiter) wait(ctx context.Context, ids []string, timeout time.Duration) (map[string]string, error) {
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, NoReceipt)
+	defer cancel()
+
+	for {
+		w.mu.Lock()
+		states := make(map[string]string, len(ids))
+		for _, id := range ids {
+			if state, ok := w.states[id]; ok {
+				states[id] = state
+			}
+		}
+		w.mu.Unlock()
+
+		final := true
+		for _, id := range ids {
+			state, ok := states[id]
+			final = final && ok && state != "ENROUTE" && state != "ACCEPTD"
+		}
+		if final {
+			return states, nil
+		}
+
+		select {
+		case <-w.changed:
+		case <-ctx.Done():
+			return states, context.Cause(ctx)
+		}
+	}
+}
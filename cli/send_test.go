@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"smppizdez/sender"
+	"smppizdez/smpp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendExitCodes(t *testing.T) {
+	base := []string{"send", "-account", "test", "-from", "1", "-to", "2", "-text", "hi"}
+	tests := []struct {
+		name     string
+		args     []string
+		session  *testSession
+		bindErr  error
+		want     int
+		wantText string
+	}{
+		{name: "accepted", session: &testSession{respond: respondWith(acceptedSeg)}, want: ExitOK, wantText: "status=ESME_ROK"},
+		{name: "rejected", session: &testSession{respond: respondWith(acceptedSeg, rejectedSeg)}, want: ExitRejected},
+		{
+			name:    "no response",
+			session: &testSession{respond: respondWith(sender.SegmentResult{Err: smpp.NoResponse})},
+			want:    ExitTimeout,
+		},
+		{
+			name: "not submitted",
+			session: &testSession{respond: func(*sender.Request) (sender.SendResult, error) {
+				return sender.SendResult{}, smpp.SessionNotBound
+			}},
+			want: ExitFailure,
+		},
+		{name: "bind failed", bindErr: errors.New("refused"), want: ExitFailure, wantText: "Failed to bind"},
+		{
+			name:     "delivered",
+			args:     []string{"-receipt", "requested", "-wait", "receipt"},
+			session:  &testSession{respond: respondWith(acceptedSeg), receipts: map[string]string{"m1": "DELIVRD"}},
+			want:     ExitOK,
+			wantText: "stat=DELIVRD",
+		},
+		{
+			name:    "undelivered",
+			args:    []string{"-receipt", "requested", "-wait", "receipt"},
+			session: &testSession{respond: respondWith(acceptedSeg), receipts: map[string]string{"m1": "UNDELIV"}},
+			want:    ExitUndelivered,
+		},
+		{
+			name:    "no receipt",
+			args:    []string{"-receipt", "requested", "-wait", "receipt", "-timeout", "10ms"},
+			session: &testSession{respond: respondWith(acceptedSeg)},
+			want:    ExitTimeout,
+		},
+		{
+			name:    "no receipt requested",
+			args:    []string{"-wait", "receipt"},
+			session: &testSession{respond: respondWith(acceptedSeg)},
+			want:    ExitUsage,
+		},
+		{name: "unknown account", args: []string{"-account", "other"}, want: ExitUsage, wantText: "No account"},
+		{name: "unknown flag", args: []string{"-nope"}, want: ExitUsage},
+		{name: "help", args: []string{"-h"}, want: ExitOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := tt.session
+			if session == nil {
+				session = &testSession{respond: respondWith(acceptedSeg)}
+			}
+			snd := &testSender{session: session, bindErr: tt.bindErr}
+			code, stdout, stderr := runApp(t, snd, append(append([]string{}, base...), tt.args...)...)
+			if code != tt.want {
+				t.Fatalf("got exit code %d, want %d; stdout %q, stderr %q", code, tt.want, stdout, stderr)
+			}
+			if !strings.Contains(stdout+stderr, tt.wantText) {
+				t.Fatalf("output %q doesn't contain %q", stdout+stderr, tt.wantText)
+			}
+		})
+	}
+
+	t.Run("missing flags", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"send", "-from", "1", "-to", "2"},
+			{"send", "-account", "test", "-to", "2"},
+			{"send", "-account", "test", "-from", "1"},
+			{"send", "-account", "test", "-from", "1", "-to", "2", "-text", "hi", "-hex", "00"},
+		} {
+			snd := &testSender{session: &testSession{respond: respondWith(acceptedSeg)}}
+			if code, _, _ := runApp(t, snd, args...); code != ExitUsage {
+				t.Fatalf("%v: got exit code %d, want %d", args, code, ExitUsage)
+			}
+		}
+	})
+
+	t.Run("wait none", func(t *testing.T) {
+		session := &testSession{respond: respondWith(rejectedSeg)}
+		code, stdout, _ := runApp(t, &testSender{session: session}, append(base, "-wait", "none")...)
+		// The response isn't awaited, so rejection isn't seen.
+		if code != ExitOK || stdout != "" || !session.closed {
+			t.Fatalf("got exit code %d, output %q, closed %v", code, stdout, session.closed)
+		}
+	})
+}
+
+func TestReceiptWaiterTimeout(t *testing.T) {
+	w := newReceiptWaiter()
+	w.handler(sender.Inbound, &sender.DeliverSMPDU{MessageID: "m1", ReceiptState: "ENROUTE"})
+	states, err := w.wait(context.Background(), []string{"m1"}, 10*time.Millisecond)
+	if !errors.Is(err, NoReceipt) || states["m1"] != "ENROUTE" {
+		t.Fatalf("got %v, %v, want intermediate state and %v", states, err, NoReceipt)
+	}
+}
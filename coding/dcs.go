@@ -0,0 +1,216 @@
+package coding
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ClassRequired = errors.New("Data coding/message class group requires a message class")
+
+type DCSGroup int
+
+const (
+	DCSGeneral DCSGroup = iota + 1
+	DCSMWIDiscard
+	DCSMWIStoreGSM7
+	DCSMWIStoreUCS2
+	DCSDataClass
+	DCSRaw
+)
+
+var AllDCSGroups = []DCSGroup{
+	DCSGeneral,
+	DCSMWIDiscard,
+	DCSMWIStoreGSM7,
+	DCSMWIStoreUCS2,
+	DCSDataClass,
+	DCSRaw,
+}
+
+func (g DCSGroup) String() string {
+	switch g {
+	case DCSGeneral:
+		return "General"
+	case DCSMWIDiscard:
+		return "MWI (discard)"
+	case DCSMWIStoreGSM7:
+		return "MWI (store, GSM7)"
+	case DCSMWIStoreUCS2:
+		return "MWI (store, UCS2)"
+	case DCSDataClass:
+		return "Data coding/message class"
+	case DCSRaw:
+		return "Raw"
+	default:
+		return fmt.Sprintf("Unknown DCSGroup enum value (%d)", g)
+	}
+}
+
+type Alphabet int
+
+const (
+	AlphabetGSM7 Alphabet = iota + 1
+	Alphabet8Bit
+	AlphabetUCS2
+)
+
+var AllAlphabets = []Alphabet{AlphabetGSM7, Alphabet8Bit, AlphabetUCS2}
+
+func (a Alphabet) String() string {
+	switch a {
+	case AlphabetGSM7:
+		return "GSM7"
+	case Alphabet8Bit:
+		return "8-bit data"
+	case AlphabetUCS2:
+		return "UCS2"
+	default:
+		return fmt.Sprintf("Unknown Alphabet enum value (%d)", a)
+	}
+}
+
+type MessageClass int
+
+const (
+	ClassNone MessageClass = iota + 1
+	Class0
+	Class1
+	Class2
+	Class3
+)
+
+var AllMessageClasses = []MessageClass{ClassNone, Class0, Class1, Class2, Class3}
+
+func (c MessageClass) String() string {
+	switch c {
+	case ClassNone:
+		return "No class"
+	case Class0:
+		return "Class 0 (flash)"
+	case Class1:
+		return "Class 1 (ME specific)"
+	case Class2:
+		return "Class 2 (SIM specific)"
+	case Class3:
+		return "Class 3 (TE specific)"
+	default:
+		return fmt.Sprintf("Unknown MessageClass enum value (%d)", c)
+	}
+}
+
+type Indication int
+
+const (
+	IndicationVoicemail Indication = iota + 1
+	IndicationFax
+	IndicationEmail
+	IndicationOther
+)
+
+var AllIndications = []Indication{
+	IndicationVoicemail,
+	IndicationFax,
+	IndicationEmail,
+	IndicationOther,
+}
+
+func (i Indication) String() string {
+	switch i {
+	case IndicationVoicemail:
+		return "Voicemail"
+	case IndicationFax:
+		return "Fax"
+	case IndicationEmail:
+		return "E-mail"
+	case IndicationOther:
+		return "Other"
+	default:
+		return fmt.Sprintf("Unknown Indication enum value (%d)", i)
+	}
+}
+
+// DCS describes a data coding scheme as defined in GSM 03.38 section 4.
+// Fields that are meaningless for the selected group are ignored.
+type DCS struct {
+	Group            DCSGroup
+	Alphabet         Alphabet
+	Class            MessageClass
+	Compressed       bool
+	IndicationActive bool
+	Indication       Indication
+	Raw              byte
+}
+
+// Byte encodes the data coding scheme. It fails for the data coding/message
+// class group without a class, which has no way to encode it.
+func (d DCS) Byte() (byte, error) {
+	switch d.Group {
+	case DCSGeneral:
+		var b byte
+		if d.Compressed {
+			b |= 0x20
+		}
+		if d.Class != ClassNone {
+			b |= 0x10 | d.classBits()
+		}
+		return b | d.alphabetBits()<<2, nil
+	case DCSMWIDiscard:
+		return 0xc0 | d.indicationBits(), nil
+	case DCSMWIStoreGSM7:
+		return 0xd0 | d.indicationBits(), nil
+	case DCSMWIStoreUCS2:
+		return 0xe0 | d.indicationBits(), nil
+	case DCSDataClass:
+		if d.Class == ClassNone {
+			return 0, ClassRequired
+		}
+		b := byte(0xf0) | d.classBits()
+		if d.Alphabet == Alphabet8Bit {
+			b |= 0x04
+		}
+		return b, nil
+	default:
+		return d.Raw, nil
+	}
+}
+
+func (d DCS) classBits() byte {
+	switch d.Class {
+	case Class1:
+		return 0x01
+	case Class2:
+		return 0x02
+	case Class3:
+		return 0x03
+	default:
+		return 0x00
+	}
+}
+
+func (d DCS) alphabetBits() byte {
+	switch d.Alphabet {
+	case Alphabet8Bit:
+		return 0x01
+	case AlphabetUCS2:
+		return 0x02
+	default:
+		return 0x00
+	}
+}
+
+func (d DCS) indicationBits() byte {
+	var b byte
+	if d.IndicationActive {
+		b |= 0x08
+	}
+
+	switch d.Indication {
+	case IndicationFax:
+		b |= 0x01
+	case IndicationEmail:
+		b |= 0x02
+	case IndicationOther:
+		b |= 0x03
+	}
+	return b
+}
@@ -0,0 +1,46 @@
+package coding
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDCSByte(t *testing.T) {
+	tests := []struct {
+		name string
+		dcs  DCS
+		want byte
+		err  error
+	}{
+		{name: "general GSM7", dcs: DCS{Group: DCSGeneral, Alphabet: AlphabetGSM7, Class: ClassNone}, want: 0x00},
+		{name: "general 8-bit", dcs: DCS{Group: DCSGeneral, Alphabet: Alphabet8Bit, Class: ClassNone}, want: 0x04},
+		{name: "general UCS2", dcs: DCS{Group: DCSGeneral, Alphabet: AlphabetUCS2, Class: ClassNone}, want: 0x08},
+		{name: "general flash", dcs: DCS{Group: DCSGeneral, Alphabet: AlphabetGSM7, Class: Class0}, want: 0x10},
+		{name: "general UCS2 class 2", dcs: DCS{Group: DCSGeneral, Alphabet: AlphabetUCS2, Class: Class2}, want: 0x1a},
+		{name: "general compressed", dcs: DCS{Group: DCSGeneral, Alphabet: AlphabetGSM7, Class: ClassNone, Compressed: true}, want: 0x20},
+		{
+			name: "general compressed 8-bit class 3",
+			dcs:  DCS{Group: DCSGeneral, Alphabet: Alphabet8Bit, Class: Class3, Compressed: true},
+			want: 0x37,
+		},
+		{name: "MWI discard", dcs: DCS{Group: DCSMWIDiscard, Indication: IndicationVoicemail}, want: 0xc0},
+		{name: "MWI discard active", dcs: DCS{Group: DCSMWIDiscard, Indication: IndicationFax, IndicationActive: true}, want: 0xc9},
+		{name: "MWI store GSM7", dcs: DCS{Group: DCSMWIStoreGSM7, Indication: IndicationEmail}, want: 0xd2},
+		{name: "MWI store UCS2", dcs: DCS{Group: DCSMWIStoreUCS2, Indication: IndicationOther, IndicationActive: true}, want: 0xeb},
+		{name: "data class 0", dcs: DCS{Group: DCSDataClass, Alphabet: AlphabetGSM7, Class: Class0}, want: 0xf0},
+		{name: "data class 1 8-bit", dcs: DCS{Group: DCSDataClass, Alphabet: Alphabet8Bit, Class: Class1}, want: 0xf5},
+		// The group has no UCS2.
+		{name: "data class UCS2", dcs: DCS{Group: DCSDataClass, Alphabet: AlphabetUCS2, Class: Class3}, want: 0xf3},
+		{name: "data class without class", dcs: DCS{Group: DCSDataClass, Alphabet: AlphabetGSM7, Class: ClassNone}, err: ClassRequired},
+		{name: "raw", dcs: DCS{Group: DCSRaw, Raw: 0x99, Class: Class1}, want: 0x99},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.dcs.Byte()
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Fatalf("got (0x%02X, %v), want (0x%02X, %v)", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
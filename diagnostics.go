@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"smppizdez/sender"
+	"strings"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+func testAccountHandler(ctx *accountsContext) {
+	idx, path := getSelectedAccountIdx(ctx)
+	if path == nil {
+		return
+	}
+	acc := ctx.accounts[idx]
+
+	buf, err := diagnosticsDialog(fmt.Sprintf("Connection test: %s", acc.SystemID))
+	if err != nil {
+		errorDialog("Failed to create connection test dialog: %v", err)
+		return
+	}
+	buf.SetText(fmt.Sprintf("Testing connection to %s:%d...\n", acc.Host, acc.Port))
+
+	go func() {
+		steps := ctx.sender.Diagnose(&acc)
+		glib.IdleAdd(func() { buf.SetText(formatDiagnostics(steps)) })
+	}()
+}
+
+func diagnosticsDialog(title string) (*gtk.TextBuffer, error) {
+	dialog, err := gtk.DialogNewWithButtons(
+		title,
+		mainWindow,
+		gtk.DIALOG_DESTROY_WITH_PARENT,
+		[]any{"Close", gtk.RESPONSE_CLOSE},
+	)
+	if err != nil {
+		return nil, err
+	}
+	dialog.Connect("response", func() { dialog.Destroy() })
+
+	box, err := dialog.GetContentArea()
+	if err != nil {
+		return nil, err
+	}
+
+	scroller, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	scroller.SetSizeRequest(600, 400)
+	scroller.SetVExpand(true)
+
+	view, err := gtk.TextViewNew()
+	if err != nil {
+		return nil, err
+	}
+	view.SetEditable(false)
+	view.SetCursorVisible(false)
+	view.SetMonospace(true)
+	view.SetWrapMode(gtk.WRAP_WORD_CHAR)
+
+	scroller.Add(view)
+	box.Add(scroller)
+	dialog.ShowAll()
+
+	return view.GetBuffer()
+}
+
+func formatDiagnostics(steps []sender.DiagnosticStep) string {
+	var text strings.Builder
+	var endpoint string
+	for i, step := range steps {
+		if i == 0 || step.Endpoint != endpoint {
+			endpoint = step.Endpoint
+			if endpoint != "" {
+				fmt.Fprintf(&text, "%s\n", endpoint)
+			}
+		}
+
+		duration := step.Duration.Round(10 * time.Microsecond)
+		if step.Err != nil {
+			fmt.Fprintf(&text, "    %v: FAILED after %v\n        %v\n", step.Stage, duration, step.Err)
+		} else {
+			fmt.Fprintf(&text, "    %v: ok in %v\n", step.Stage, duration)
+		}
+		for _, detail := range step.Details {
+			fmt.Fprintf(&text, "        %s\n", detail)
+		}
+	}
+	return text.String()
+}
@@ -4,3 +4,9 @@ import _ "embed"
 
 //go:embed smppizdez_min.glade
 var Source string
+
+// SessionSource describes a single session page, it is instantiated once per
+// opened session.
+//
+//go:embed session_min.glade
+var SessionSource string
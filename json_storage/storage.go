@@ -10,6 +10,7 @@ import (
 	"smppizdez/account"
 	"smppizdez/coding"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -24,14 +25,504 @@ func Open(path string) (Storage, error) {
 }
 
 type accountJson struct {
-	Host          string `json:"host"`
-	Port          uint16 `json:"port"`
-	TLS           bool   `json:"tls"`
-	SystemID      string `json:"systemID"`
-	Password      string `json:"password"`
-	SystemType    string `json:"systemType,omitempty"`
-	BindType      string `json:"bindType"`
-	DefaultCoding string `json:"defaultCoding"`
+	Host          string          `json:"host"`
+	Port          uint16          `json:"port"`
+	TLS           bool            `json:"tls"`
+	TLSSettings   *tlsJson        `json:"tlsSettings,omitempty"`
+	SystemID      string          `json:"systemID"`
+	Password      string          `json:"password"`
+	SystemType    string          `json:"systemType,omitempty"`
+	BindType      string          `json:"bindType"`
+	DefaultCoding string          `json:"defaultCoding"`
+	Reconnect     *reconnectJson  `json:"reconnect,omitempty"`
+	Timing        *timingJson     `json:"timing,omitempty"`
+	Window        *windowJson     `json:"window,omitempty"`
+	Throughput    *throughputJson `json:"throughput,omitempty"`
+	Binds         *bindPoolJson   `json:"binds,omitempty"`
+	Fallbacks     []endpointJson  `json:"fallbacks,omitempty"`
+	Proxy         *proxyJson      `json:"proxy,omitempty"`
+}
+
+type tlsJson struct {
+	CAFile             string   `json:"caFile,omitempty"`
+	CertFile           string   `json:"certFile,omitempty"`
+	KeyFile            string   `json:"keyFile,omitempty"`
+	ServerName         string   `json:"serverName,omitempty"`
+	MinVersion         string   `json:"minVersion,omitempty"`
+	MaxVersion         string   `json:"maxVersion,omitempty"`
+	InsecureSkipVerify bool     `json:"insecureSkipVerify,omitempty"`
+	PinnedSHA256       []string `json:"pinnedSHA256,omitempty"`
+}
+
+func tlsFromJson(j *tlsJson) (account.TLSSettings, error) {
+	if j == nil {
+		return account.TLSSettings{}, nil
+	}
+
+	minVersion, err := parseTLSVersion(j.MinVersion)
+	if err != nil {
+		return account.TLSSettings{}, err
+	}
+
+	maxVersion, err := parseTLSVersion(j.MaxVersion)
+	if err != nil {
+		return account.TLSSettings{}, err
+	}
+
+	return account.TLSSettings{
+		CAFile:             j.CAFile,
+		CertFile:           j.CertFile,
+		KeyFile:            j.KeyFile,
+		ServerName:         j.ServerName,
+		MinVersion:         minVersion,
+		MaxVersion:         maxVersion,
+		InsecureSkipVerify: j.InsecureSkipVerify,
+		PinnedSHA256:       j.PinnedSHA256,
+	}, nil
+}
+
+func tlsToJson(s account.TLSSettings) *tlsJson {
+	j := &tlsJson{
+		CAFile:             s.CAFile,
+		CertFile:           s.CertFile,
+		KeyFile:            s.KeyFile,
+		ServerName:         s.ServerName,
+		MinVersion:         tlsVersionToString(s.MinVersion),
+		MaxVersion:         tlsVersionToString(s.MaxVersion),
+		InsecureSkipVerify: s.InsecureSkipVerify,
+		PinnedSHA256:       s.PinnedSHA256,
+	}
+	if j.CAFile == "" && j.CertFile == "" && j.KeyFile == "" && j.ServerName == "" &&
+		j.MinVersion == "" && j.MaxVersion == "" && !j.InsecureSkipVerify &&
+		len(j.PinnedSHA256) == 0 {
+		return nil
+	}
+	return j
+}
+
+type tlsVersionStr struct {
+	version account.TLSVersion
+	str     string
+}
+
+var tlsVersionStrings = []tlsVersionStr{
+	{version: account.TLS10, str: "1.0"},
+	{version: account.TLS11, str: "1.1"},
+	{version: account.TLS12, str: "1.2"},
+	{version: account.TLS13, str: "1.3"},
+}
+
+// parseTLSVersion parses optional TLS version, empty string means default.
+func parseTLSVersion(s string) (account.TLSVersion, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	for _, versionStr := range tlsVersionStrings {
+		if versionStr.str == s {
+			return versionStr.version, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown TLS version %s", s)
+}
+
+func tlsVersionToString(v account.TLSVersion) string {
+	for _, versionStr := range tlsVersionStrings {
+		if versionStr.version == v {
+			return versionStr.str
+		}
+	}
+	return ""
+}
+
+type endpointJson struct {
+	Host string `json:"host"`
+	Port uint16 `json:"port"`
+}
+
+func endpointsFromJson(j []endpointJson) []account.Endpoint {
+	if len(j) == 0 {
+		return nil
+	}
+
+	result := make([]account.Endpoint, len(j))
+	for i, ep := range j {
+		result[i] = account.Endpoint{Host: ep.Host, Port: ep.Port}
+	}
+	return result
+}
+
+func endpointsToJson(endpoints []account.Endpoint) []endpointJson {
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	result := make([]endpointJson, len(endpoints))
+	for i, ep := range endpoints {
+		result[i] = endpointJson{Host: ep.Host, Port: ep.Port}
+	}
+	return result
+}
+
+type proxyJson struct {
+	Type     string `json:"type"`
+	Host     string `json:"host"`
+	Port     uint16 `json:"port"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+func proxyFromJson(j *proxyJson) (account.Proxy, error) {
+	if j == nil {
+		return account.Proxy{}, nil
+	}
+
+	proxyType, err := parseProxyType(j.Type)
+	if err != nil {
+		return account.Proxy{}, err
+	}
+	return account.Proxy{
+		Type:     proxyType,
+		Host:     j.Host,
+		Port:     j.Port,
+		Username: j.Username,
+		Password: j.Password,
+	}, nil
+}
+
+func proxyToJson(p account.Proxy) (*proxyJson, error) {
+	if p.Type == 0 {
+		return nil, nil
+	}
+
+	proxyType, err := proxyTypeToString(p.Type)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyJson{
+		Type:     proxyType,
+		Host:     p.Host,
+		Port:     p.Port,
+		Username: p.Username,
+		Password: p.Password,
+	}, nil
+}
+
+type proxyTypeStr struct {
+	typ account.ProxyType
+	str string
+}
+
+var proxyTypeStrings = []proxyTypeStr{
+	{typ: account.SOCKS5, str: "socks5"},
+	{typ: account.HTTPConnect, str: "http"},
+}
+
+func parseProxyType(s string) (account.ProxyType, error) {
+	for _, typeStr := range proxyTypeStrings {
+		if typeStr.str == s {
+			return typeStr.typ, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown proxy type %s", s)
+}
+
+func proxyTypeToString(t account.ProxyType) (string, error) {
+	for _, typeStr := range proxyTypeStrings {
+		if t == typeStr.typ {
+			return typeStr.str, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown proxy type enum %d", t)
+}
+
+type bindPoolJson struct {
+	Count     int    `json:"count"`
+	Balancing string `json:"balancing"`
+}
+
+func bindPoolFromJson(j *bindPoolJson) (account.BindPool, error) {
+	if j == nil {
+		return account.BindPool{Count: 1, Balancing: account.RoundRobin}, nil
+	}
+
+	balancing, err := parseBalancing(j.Balancing)
+	if err != nil {
+		return account.BindPool{}, err
+	}
+	return account.BindPool{Count: j.Count, Balancing: balancing}, nil
+}
+
+func bindPoolToJson(p account.BindPool) (*bindPoolJson, error) {
+	if p.Count <= 1 {
+		return nil, nil
+	}
+
+	balancing, err := balancingToString(p.Balancing)
+	if err != nil {
+		return nil, err
+	}
+	return &bindPoolJson{Count: p.Count, Balancing: balancing}, nil
+}
+
+type throughputJson struct {
+	TPS        int    `json:"tps"`
+	Burst      int    `json:"burst"`
+	MaxRetries int    `json:"maxRetries"`
+	RetryDelay string `json:"retryDelay"`
+}
+
+func throughputFromJson(j *throughputJson) (account.Throughput, error) {
+	// Accounts saved before throughput settings existed never retried
+	// throttled messages, so they keep not retrying.
+	if j == nil {
+		return account.Throughput{Burst: 1, RetryDelay: account.DefaultThroughput.RetryDelay}, nil
+	}
+
+	retryDelay, err := time.ParseDuration(j.RetryDelay)
+	if err != nil {
+		return account.Throughput{}, fmt.Errorf("Invalid throttling retry delay: %w", err)
+	}
+
+	return account.Throughput{
+		TPS:        j.TPS,
+		Burst:      j.Burst,
+		MaxRetries: j.MaxRetries,
+		RetryDelay: retryDelay,
+	}, nil
+}
+
+func throughputToJson(t account.Throughput) *throughputJson {
+	return &throughputJson{
+		TPS:        t.TPS,
+		Burst:      t.Burst,
+		MaxRetries: t.MaxRetries,
+		RetryDelay: t.RetryDelay.String(),
+	}
+}
+
+type windowJson struct {
+	Size          int  `json:"size"`
+	BlockWhenFull bool `json:"blockWhenFull"`
+}
+
+type timingJson struct {
+	ReadTimeout         string `json:"readTimeout"`
+	WriteTimeout        string `json:"writeTimeout"`
+	EnquireLink         string `json:"enquireLink"`
+	BindTimeout         string `json:"bindTimeout"`
+	ResponseTimeout     string `json:"responseTimeout"`
+	UnbindTimeout       string `json:"unbindTimeout,omitempty"`
+	EnquireLinkFailures int    `json:"enquireLinkFailures"`
+}
+
+func timingFromJson(j *timingJson) (account.SessionTiming, error) {
+	if j == nil {
+		return account.DefaultSessionTiming, nil
+	}
+
+	timing := account.SessionTiming{EnquireLinkFailures: j.EnquireLinkFailures}
+	durations := []struct {
+		name string
+		str  string
+		dst  *time.Duration
+	}{
+		{name: "read timeout", str: j.ReadTimeout, dst: &timing.ReadTimeout},
+		{name: "write timeout", str: j.WriteTimeout, dst: &timing.WriteTimeout},
+		{name: "enquire link", str: j.EnquireLink, dst: &timing.EnquireLink},
+		{name: "bind timeout", str: j.BindTimeout, dst: &timing.BindTimeout},
+		{name: "response timeout", str: j.ResponseTimeout, dst: &timing.ResponseTimeout},
+	}
+	for _, d := range durations {
+		var err error
+		*d.dst, err = time.ParseDuration(d.str)
+		if err != nil {
+			return account.SessionTiming{}, fmt.Errorf("Invalid %s: %w", d.name, err)
+		}
+	}
+
+	// Unbind timeout is missing in accounts saved by older versions.
+	timing.UnbindTimeout = account.DefaultSessionTiming.UnbindTimeout
+	if j.UnbindTimeout != "" {
+		var err error
+		timing.UnbindTimeout, err = time.ParseDuration(j.UnbindTimeout)
+		if err != nil {
+			return account.SessionTiming{}, fmt.Errorf("Invalid unbind timeout: %w", err)
+		}
+	}
+	return timing, nil
+}
+
+func timingToJson(t account.SessionTiming) *timingJson {
+	return &timingJson{
+		ReadTimeout:         t.ReadTimeout.String(),
+		WriteTimeout:        t.WriteTimeout.String(),
+		EnquireLink:         t.EnquireLink.String(),
+		BindTimeout:         t.BindTimeout.String(),
+		ResponseTimeout:     t.ResponseTimeout.String(),
+		UnbindTimeout:       t.UnbindTimeout.String(),
+		EnquireLinkFailures: t.EnquireLinkFailures,
+	}
+}
+
+type reconnectJson struct {
+	Enabled     bool   `json:"enabled"`
+	MaxAttempts int    `json:"maxAttempts"`
+	Delay       string `json:"delay"`
+	MaxDelay    string `json:"maxDelay"`
+}
+
+func reconnectFromJson(j *reconnectJson) (account.ReconnectPolicy, error) {
+	if j == nil {
+		return account.ReconnectPolicy{}, nil
+	}
+
+	delay, err := time.ParseDuration(j.Delay)
+	if err != nil {
+		return account.ReconnectPolicy{}, fmt.Errorf("Invalid reconnect delay: %w", err)
+	}
+
+	maxDelay, err := time.ParseDuration(j.MaxDelay)
+	if err != nil {
+		return account.ReconnectPolicy{}, fmt.Errorf("Invalid reconnect max delay: %w", err)
+	}
+
+	return account.ReconnectPolicy{
+		Enabled:     j.Enabled,
+		MaxAttempts: j.MaxAttempts,
+		Delay:       delay,
+		MaxDelay:    maxDelay,
+	}, nil
+}
+
+func reconnectToJson(p account.ReconnectPolicy) *reconnectJson {
+	if p == (account.ReconnectPolicy{}) {
+		return nil
+	}
+
+	return &reconnectJson{
+		Enabled:     p.Enabled,
+		MaxAttempts: p.MaxAttempts,
+		Delay:       p.Delay.String(),
+		MaxDelay:    p.MaxDelay.String(),
+	}
+}
+
+func windowFromJson(j *windowJson) account.WindowPolicy {
+	if j == nil {
+		return account.WindowPolicy{}
+	}
+	return account.WindowPolicy{Size: j.Size, BlockWhenFull: j.BlockWhenFull}
+}
+
+func windowToJson(w account.WindowPolicy) *windowJson {
+	if w.Size == 0 {
+		return nil
+	}
+	return &windowJson{Size: w.Size, BlockWhenFull: w.BlockWhenFull}
+}
+
+func accountFromJson(id string, accJson accountJson) (account.Account, error) {
+	bindType, err := parseBindType(accJson.BindType)
+	if err != nil {
+		return account.Account{}, err
+	}
+
+	defaultCoding, err := parseCoding(accJson.DefaultCoding)
+	if err != nil {
+		return account.Account{}, err
+	}
+
+	reconnect, err := reconnectFromJson(accJson.Reconnect)
+	if err != nil {
+		return account.Account{}, err
+	}
+
+	timing, err := timingFromJson(accJson.Timing)
+	if err != nil {
+		return account.Account{}, err
+	}
+
+	throughput, err := throughputFromJson(accJson.Throughput)
+	if err != nil {
+		return account.Account{}, err
+	}
+
+	binds, err := bindPoolFromJson(accJson.Binds)
+	if err != nil {
+		return account.Account{}, err
+	}
+
+	tlsSettings, err := tlsFromJson(accJson.TLSSettings)
+	if err != nil {
+		return account.Account{}, err
+	}
+
+	proxy, err := proxyFromJson(accJson.Proxy)
+	if err != nil {
+		return account.Account{}, err
+	}
+
+	return account.Account{
+		ID:            id,
+		Host:          accJson.Host,
+		Port:          accJson.Port,
+		TLS:           accJson.TLS,
+		TLSSettings:   tlsSettings,
+		SystemID:      accJson.SystemID,
+		Password:      accJson.Password,
+		SystemType:    accJson.SystemType,
+		BindType:      bindType,
+		DefaultCoding: defaultCoding,
+		Reconnect:     reconnect,
+		Timing:        timing,
+		Window:        windowFromJson(accJson.Window),
+		Throughput:    throughput,
+		Binds:         binds,
+		Fallbacks:     endpointsFromJson(accJson.Fallbacks),
+		Proxy:         proxy,
+	}, nil
+}
+
+func accountToJson(acc *account.Account) (accountJson, error) {
+	bindTypeStr, err := bindTypeToString(acc.BindType)
+	if err != nil {
+		return accountJson{}, err
+	}
+
+	defaultCodingStr, err := codingToString(acc.DefaultCoding)
+	if err != nil {
+		return accountJson{}, err
+	}
+
+	binds, err := bindPoolToJson(acc.Binds)
+	if err != nil {
+		return accountJson{}, err
+	}
+
+	proxy, err := proxyToJson(acc.Proxy)
+	if err != nil {
+		return accountJson{}, err
+	}
+
+	return accountJson{
+		Host:          acc.Host,
+		Port:          acc.Port,
+		TLS:           acc.TLS,
+		TLSSettings:   tlsToJson(acc.TLSSettings),
+		SystemID:      acc.SystemID,
+		Password:      acc.Password,
+		SystemType:    acc.SystemType,
+		BindType:      bindTypeStr,
+		DefaultCoding: defaultCodingStr,
+		Reconnect:     reconnectToJson(acc.Reconnect),
+		Timing:        timingToJson(acc.Timing),
+		Window:        windowToJson(acc.Window),
+		Throughput:    throughputToJson(acc.Throughput),
+		Binds:         binds,
+		Fallbacks:     endpointsToJson(acc.Fallbacks),
+		Proxy:         proxy,
+	}, nil
 }
 
 type bindTypeStr struct {
@@ -43,6 +534,7 @@ var bindTypeStrings = []bindTypeStr{
 	{typ: account.Transceiver, str: "transceiver"},
 	{typ: account.Transmitter, str: "transmitter"},
 	{typ: account.Receiver, str: "receiver"},
+	{typ: account.TransmitterReceiver, str: "transmitter+receiver"},
 }
 
 func parseBindType(s string) (account.BindType, error) {
@@ -64,6 +556,35 @@ func bindTypeToString(typ account.BindType) (string, error) {
 	return "", fmt.Errorf("Unknown bind type enum %d", typ)
 }
 
+type balancingStr struct {
+	balancing account.Balancing
+	str       string
+}
+
+var balancingStrings = []balancingStr{
+	{balancing: account.RoundRobin, str: "roundRobin"},
+	{balancing: account.LeastLoaded, str: "leastLoaded"},
+}
+
+func parseBalancing(s string) (account.Balancing, error) {
+	for _, balancingStr := range balancingStrings {
+		if balancingStr.str == s {
+			return balancingStr.balancing, nil
+		}
+	}
+
+	return account.RoundRobin, fmt.Errorf("Unknown balancing %s", s)
+}
+
+func balancingToString(balancing account.Balancing) (string, error) {
+	for _, balancingStr := range balancingStrings {
+		if balancing == balancingStr.balancing {
+			return balancingStr.str, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown balancing enum %d", balancing)
+}
+
 type codingStr struct {
 	cod coding.Coding
 	str string
@@ -113,11 +634,7 @@ func (s Storage) GetAccounts() ([]account.Account, error) {
 	accounts := make([]account.Account, 0, len(accountsMap))
 	var loadErr error
 	for id, accJson := range accountsMap {
-		var defaultCoding coding.Coding
-		bindType, err := parseBindType(accJson.BindType)
-		if err == nil {
-			defaultCoding, err = parseCoding(accJson.DefaultCoding)
-		}
+		acc, err := accountFromJson(id, accJson)
 		if err != nil {
 			loadErr = errors.Join(
 				loadErr,
@@ -125,18 +642,6 @@ func (s Storage) GetAccounts() ([]account.Account, error) {
 			)
 			continue
 		}
-
-		acc := account.Account{
-			ID:            id,
-			Host:          accJson.Host,
-			Port:          accJson.Port,
-			TLS:           accJson.TLS,
-			SystemID:      accJson.SystemID,
-			Password:      accJson.Password,
-			SystemType:    accJson.SystemType,
-			BindType:      bindType,
-			DefaultCoding: defaultCoding,
-		}
 		accounts = append(accounts, acc)
 	}
 
@@ -151,12 +656,7 @@ func (s Storage) GetAccounts() ([]account.Account, error) {
 }
 
 func (s Storage) CreateAccount(account *account.Account) error {
-	bindTypeStr, err := bindTypeToString(account.BindType)
-	if err != nil {
-		return err
-	}
-
-	defaultCodingStr, err := codingToString(account.DefaultCoding)
+	accJson, err := accountToJson(account)
 	if err != nil {
 		return err
 	}
@@ -167,26 +667,12 @@ func (s Storage) CreateAccount(account *account.Account) error {
 	}
 
 	account.ID = uuid.NewString()
-	accountsMap[account.ID] = accountJson{
-		Host:          account.Host,
-		Port:          account.Port,
-		TLS:           account.TLS,
-		SystemID:      account.SystemID,
-		Password:      account.Password,
-		SystemType:    account.SystemType,
-		BindType:      bindTypeStr,
-		DefaultCoding: defaultCodingStr,
-	}
+	accountsMap[account.ID] = accJson
 	return s.save(accountsMap)
 }
 
 func (s Storage) UpdateAccount(account *account.Account) error {
-	bindTypeStr, err := bindTypeToString(account.BindType)
-	if err != nil {
-		return err
-	}
-
-	defaultCodingStr, err := codingToString(account.DefaultCoding)
+	accJson, err := accountToJson(account)
 	if err != nil {
 		return err
 	}
@@ -200,16 +686,7 @@ func (s Storage) UpdateAccount(account *account.Account) error {
 		return fmt.Errorf("Account ID=%s does not exist", account.ID)
 	}
 
-	accountsMap[account.ID] = accountJson{
-		Host:          account.Host,
-		Port:          account.Port,
-		TLS:           account.TLS,
-		SystemID:      account.SystemID,
-		Password:      account.Password,
-		SystemType:    account.SystemType,
-		BindType:      bindTypeStr,
-		DefaultCoding: defaultCodingStr,
-	}
+	accountsMap[account.ID] = accJson
 	return s.save(accountsMap)
 }
 
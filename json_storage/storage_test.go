@@ -0,0 +1,204 @@
+package json_storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"smppizdez/account"
+	"smppizdez/coding"
+	"testing"
+	"time"
+)
+
+func openStorage(t *testing.T, content string) Storage {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.f.Close() })
+	return s
+}
+
+func TestAccountRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		acc  account.Account
+	}{
+		{
+			name: "defaults",
+			acc: account.Account{
+				Host:          "smsc.example.com",
+				Port:          2775,
+				SystemID:      "test",
+				Password:      "secret",
+				BindType:      account.Transceiver,
+				DefaultCoding: coding.GSM7,
+				Timing:        account.DefaultSessionTiming,
+				Throughput:    account.DefaultThroughput,
+				Binds:         account.BindPool{Count: 1, Balancing: account.RoundRobin},
+			},
+		},
+		{
+			name: "all settings",
+			acc: account.Account{
+				Host: "smsc.example.com",
+				Port: 3550,
+				TLS:  true,
+				TLSSettings: account.TLSSettings{
+					CAFile:             "ca.pem",
+					CertFile:           "client.pem",
+					KeyFile:            "client.key",
+					ServerName:         "smsc",
+					MinVersion:         account.TLS12,
+					MaxVersion:         account.TLS13,
+					InsecureSkipVerify: true,
+					PinnedSHA256:       []string{"ab12", "cd34"},
+				},
+				SystemID:      "test",
+				Password:      "secret",
+				SystemType:    "VMA",
+				BindType:      account.TransmitterReceiver,
+				DefaultCoding: coding.UCS2,
+				Reconnect: account.ReconnectPolicy{
+					Enabled:     true,
+					MaxAttempts: 7,
+					Delay:       2 * time.Second,
+					MaxDelay:    90 * time.Second,
+				},
+				Timing: account.SessionTiming{
+					ReadTimeout:         2 * time.Minute,
+					WriteTimeout:        30 * time.Second,
+					EnquireLink:         15 * time.Second,
+					BindTimeout:         5 * time.Second,
+					ResponseTimeout:     3 * time.Second,
+					UnbindTimeout:       time.Second,
+					EnquireLinkFailures: 2,
+				},
+				Window:     account.WindowPolicy{Size: 50, BlockWhenFull: true},
+				Throughput: account.Throughput{TPS: 100, Burst: 10, MaxRetries: 5, RetryDelay: 500 * time.Millisecond},
+				Binds:      account.BindPool{Count: 4, Balancing: account.LeastLoaded},
+				Fallbacks: []account.Endpoint{
+					{Host: "backup1.example.com", Port: 2775},
+					{Host: "backup2.example.com", Port: 2776},
+				},
+				Proxy: account.Proxy{
+					Type:     account.HTTPConnect,
+					Host:     "proxy.example.com",
+					Port:     3128,
+					Username: "user",
+					Password: "pass",
+				},
+			},
+		},
+		{
+			name: "SOCKS5 without auth",
+			acc: account.Account{
+				Host:          "smsc.example.com",
+				Port:          2775,
+				BindType:      account.Receiver,
+				DefaultCoding: coding.Latin1,
+				Timing:        account.DefaultSessionTiming,
+				Throughput:    account.Throughput{Burst: 1},
+				Binds:         account.BindPool{Count: 1, Balancing: account.RoundRobin},
+				Proxy:         account.Proxy{Type: account.SOCKS5, Host: "127.0.0.1", Port: 1080},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openStorage(t, "")
+			acc := tt.acc
+			if err := s.CreateAccount(&acc); err != nil {
+				t.Fatal(err)
+			}
+
+			accounts, err := s.GetAccounts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.acc
+			want.ID = acc.ID
+			if len(accounts) != 1 || !reflect.DeepEqual(accounts[0], want) {
+				t.Fatalf("got %+v, want %+v", accounts, want)
+			}
+		})
+	}
+}
+
+func TestLegacyAccount(t *testing.T) {
+	s := openStorage(t, `{"id1": {
+		"host": "smsc.example.com",
+		"port": 2775,
+		"tls": false,
+		"systemID": "test",
+		"password": "secret",
+		"bindType": "transceiver",
+		"defaultCoding": "gsm7"
+	}}`)
+
+	accounts, err := s.GetAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := account.Account{
+		ID:            "id1",
+		Host:          "smsc.example.com",
+		Port:          2775,
+		SystemID:      "test",
+		Password:      "secret",
+		BindType:      account.Transceiver,
+		DefaultCoding: coding.GSM7,
+		Timing:        account.DefaultSessionTiming,
+		// Throttled messages weren't retried before.
+		Throughput: account.Throughput{Burst: 1, RetryDelay: account.DefaultThroughput.RetryDelay},
+		Binds:      account.BindPool{Count: 1, Balancing: account.RoundRobin},
+	}
+	if len(accounts) != 1 || !reflect.DeepEqual(accounts[0], want) {
+		t.Fatalf("got %+v, want %+v", accounts, want)
+	}
+}
+
+func TestTimingWithoutUnbindTimeout(t *testing.T) {
+	timing, err := timingFromJson(&timingJson{
+		ReadTimeout:     "1m0s",
+		WriteTimeout:    "1m0s",
+		EnquireLink:     "30s",
+		BindTimeout:     "10s",
+		ResponseTimeout: "10s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timing.UnbindTimeout != account.DefaultSessionTiming.UnbindTimeout {
+		t.Fatalf("got unbind timeout %v, want default", timing.UnbindTimeout)
+	}
+}
+
+func TestInvalidAccount(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{name: "retry delay", json: `"throughput": {"tps": 1, "burst": 1, "maxRetries": 1, "retryDelay": "soon"}`},
+		{name: "proxy type", json: `"proxy": {"type": "ftp", "host": "p", "port": 1}`},
+		{name: "balancing", json: `"binds": {"count": 2, "balancing": "random"}`},
+		{name: "TLS version", json: `"tlsSettings": {"minVersion": "1.9"}`},
+		{name: "reconnect delay", json: `"reconnect": {"enabled": true, "delay": "x", "maxDelay": "1m"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openStorage(t, `{"id1": {"host": "h", "port": 1, "bindType": "transceiver", "defaultCoding": "gsm7", `+tt.json+`}}`)
+			accounts, err := s.GetAccounts()
+			if err == nil || len(accounts) != 0 {
+				t.Fatalf("got %v and error %v", accounts, err)
+			}
+		})
+	}
+}
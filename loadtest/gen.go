@@ -0,0 +1,152 @@
+package loadtest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"smppizdez/coding"
+	"smppizdez/sender"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	InvalidRange = errors.New("Range must be FROM-TO with numbers of the same length")
+	InvalidMix   = errors.New("Message mix weights must be positive")
+)
+
+// Destinations generates destination addresses.
+type Destinations interface {
+	Next() string
+}
+
+// Range is an inclusive range of numbers of the same length, leading zeros
+// included.
+type Range struct {
+	From  uint64
+	To    uint64
+	Width int
+}
+
+// ParseRange parses range "FROM-TO" or a single number.
+func ParseRange(s string) (Range, error) {
+	fromStr, toStr, ok := strings.Cut(s, "-")
+	if !ok {
+		toStr = fromStr
+	}
+	if len(fromStr) != len(toStr) {
+		return Range{}, InvalidRange
+	}
+	from, err := strconv.ParseUint(fromStr, 10, 64)
+	if err != nil {
+		return Range{}, InvalidRange
+	}
+	to, err := strconv.ParseUint(toStr, 10, 64)
+	if err != nil || to < from {
+		return Range{}, InvalidRange
+	}
+	return Range{From: from, To: to, Width: len(fromStr)}, nil
+}
+
+// sequential cycles through ranges in order.
+type sequential struct {
+	ranges []Range
+
+	mu   sync.Mutex
+	idx  int
+	next uint64
+}
+
+func Sequential(ranges []Range) Destinations {
+	return &sequential{ranges: ranges, next: ranges[0].From}
+}
+
+func (s *sequential) Next() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.ranges[s.idx]
+	addr := fmt.Sprintf("%0*d", r.Width, s.next)
+	if s.next < r.To {
+		s.next++
+	} else {
+		s.idx = (s.idx + 1) % len(s.ranges)
+		s.next = s.ranges[s.idx].From
+	}
+	return addr
+}
+
+type random struct {
+	prefix string
+	digits int
+}
+
+// Random generates numbers of the given length starting with prefix.
+func Random(prefix string, length int) Destinations {
+	return random{prefix: prefix, digits: max(length-len(prefix), 0)}
+}
+
+func (r random) Next() string {
+	var b strings.Builder
+	b.WriteString(r.prefix)
+	for range r.digits {
+		b.WriteByte(byte('0' + rand.IntN(10)))
+	}
+	return b.String()
+}
+
+// MixEntry is a kind of messages sent with probability proportional to its
+// weight.
+type MixEntry struct {
+	Coding    coding.Coding
+	SplitMode sender.SplitMode
+	// Length is the number of characters of message text.
+	Length int
+	Weight int
+}
+
+func (e MixEntry) String() string {
+	return fmt.Sprintf("%v/%v/%d", e.Coding, e.SplitMode, e.Length)
+}
+
+// mix picks mix entries according to their weights.
+type mix struct {
+	entries []MixEntry
+	total   int
+}
+
+func newMix(entries []MixEntry) (*mix, error) {
+	m := &mix{entries: entries}
+	for _, e := range entries {
+		if e.Weight <= 0 {
+			return nil, InvalidMix
+		}
+		m.total += e.Weight
+	}
+	if m.total == 0 {
+		return nil, InvalidMix
+	}
+	return m, nil
+}
+
+func (m *mix) pick() MixEntry {
+	n := rand.IntN(m.total)
+	for _, e := range m.entries {
+		if n < e.Weight {
+			return e
+		}
+		n -= e.Weight
+	}
+	return m.entries[len(m.entries)-1]
+}
+
+// messageText returns text of the given length that every coding can
+// encode.
+func messageText(n int, length int) string {
+	text := fmt.Sprintf("Load test %d ", n)
+	if len(text) >= length {
+		return text[:length]
+	}
+	return text + strings.Repeat("x", length-len(text))
+}
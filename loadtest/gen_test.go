@@ -0,0 +1,96 @@
+package loadtest
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Range
+		err  error
+	}{
+		{s: "100-199", want: Range{From: 100, To: 199, Width: 3}},
+		{s: "0010-0019", want: Range{From: 10, To: 19, Width: 4}},
+		{s: "79001234567", want: Range{From: 79001234567, To: 79001234567, Width: 11}},
+		{s: "5-5", want: Range{From: 5, To: 5, Width: 1}},
+		{s: "199-100", err: InvalidRange},
+		{s: "10-100", err: InvalidRange},
+		{s: "1a-19", err: InvalidRange},
+		{s: "-", err: InvalidRange},
+		{s: "", err: InvalidRange},
+		{s: "1-2-3", err: InvalidRange},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRange(tt.s)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("%q: got (%+v, %v), want (%+v, %v)", tt.s, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestSequential(t *testing.T) {
+	dst := Sequential([]Range{{From: 8, To: 10, Width: 3}, {From: 5, To: 5, Width: 1}})
+	var got []string
+	for range 6 {
+		got = append(got, dst.Next())
+	}
+	want := []string{"008", "009", "010", "5", "008", "009"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	tests := []struct {
+		prefix string
+		length int
+	}{
+		{prefix: "7900", length: 11},
+		{prefix: "", length: 5},
+		{prefix: "12345", length: 3},
+	}
+
+	for _, tt := range tests {
+		addr := Random(tt.prefix, tt.length).Next()
+		if !strings.HasPrefix(addr, tt.prefix) || len(addr) != max(tt.length, len(tt.prefix)) {
+			t.Errorf("%q of %d: got %q", tt.prefix, tt.length, addr)
+		}
+		if strings.Trim(addr, "0123456789") != "" {
+			t.Errorf("%q of %d: got %q with non-digits", tt.prefix, tt.length, addr)
+		}
+	}
+}
+
+func TestMix(t *testing.T) {
+	if _, err := newMix([]MixEntry{{Weight: 1}, {Weight: 0}}); !errors.Is(err, InvalidMix) {
+		t.Fatalf("got %v, want %v", err, InvalidMix)
+	}
+	if _, err := newMix(nil); !errors.Is(err, InvalidMix) {
+		t.Fatalf("got %v, want %v", err, InvalidMix)
+	}
+
+	m, err := newMix([]MixEntry{{Length: 1, Weight: 1}, {Length: 2, Weight: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[int]int)
+	for range 4000 {
+		counts[m.pick().Length]++
+	}
+	if counts[1] < 800 || counts[1] > 1200 {
+		t.Fatalf("entry of weight 1 of 4 picked %d times of 4000", counts[1])
+	}
+}
+
+func TestMessageText(t *testing.T) {
+	for _, length := range []int{1, 12, 13, 160} {
+		if text := messageText(42, length); len(text) != length {
+			t.Errorf("length %d: got %q", length, text)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package loadtest submits messages over several sessions at a target rate
+// and reports throughput, response latency and delivery receipts.
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"smppizdez/account"
+	"smppizdez/sender"
+	"sync"
+	"time"
+)
+
+var InvalidConfig = errors.New("Sessions, TPS and duration must be positive")
+
+// BindError is returned by Run when a session fails to bind.
+type BindError struct {
+	// Session is the number of the session starting from 1.
+	Session int
+	Err     error
+}
+
+func (e *BindError) Error() string {
+	return fmt.Sprintf("session %d: %v", e.Session, e.Err)
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// maxInFlightPerSession limits goroutines waiting for Send when SMSC can't
+// keep up with the target rate.
+const maxInFlightPerSession = 1000
+
+type Config struct {
+	Account  *account.Account
+	Sessions int
+	// TPS is the target rate of messages over all sessions.
+	TPS      float64
+	Duration time.Duration
+	// Base is the request every message is made of. Destination, text,
+	// coding and split mode are set for every message.
+	Base         sender.Request
+	Destinations Destinations
+	Mix          []MixEntry
+	// ReceiptWait limits waiting for delivery receipts after the last
+	// message is submitted.
+	ReceiptWait time.Duration
+	// OnReport, if not nil, is called with a live report every
+	// ReportInterval.
+	OnReport       func(Report)
+	ReportInterval time.Duration
+	// OnClose is called when a session is closed because of an error.
+	OnClose     func(session int, err error)
+	OnReconnect func(session int, ev sender.ReconnectEvent)
+}
+
+// Run binds the sessions, submits messages until the duration expires or
+// ctx is done and returns the final report.
+func Run(ctx context.Context, s sender.Sender, cfg Config) (Report, error) {
+	if cfg.Sessions <= 0 || cfg.TPS <= 0 || cfg.Duration <= 0 {
+		return Report{}, InvalidConfig
+	}
+	mix, err := newMix(cfg.Mix)
+	if err != nil {
+		return Report{}, err
+	}
+
+	stats := newCollector()
+	sessions := make([]sender.Session, 0, cfg.Sessions)
+	defer func() {
+		var wg sync.WaitGroup
+		for _, session := range sessions {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				session.Close()
+			}()
+		}
+		wg.Wait()
+	}()
+	for i := range cfg.Sessions {
+		session, err := s.StartSession(
+			cfg.Account,
+			stats.handlePDU,
+			func(err error) {
+				if err != nil && cfg.OnClose != nil {
+					cfg.OnClose(i+1, err)
+				}
+			},
+			func(ev sender.ReconnectEvent) {
+				if cfg.OnReconnect != nil {
+					cfg.OnReconnect(i+1, ev)
+				}
+			},
+			func(sender.SessionState) {},
+		)
+		if err != nil {
+			return Report{}, &BindError{Session: i + 1, Err: err}
+		}
+		sessions = append(sessions, session)
+	}
+
+	// Rates are counted from the moment all sessions are bound.
+	stats.restart()
+
+	reportCtx, stopReports := context.WithCancel(ctx)
+	var reporter sync.WaitGroup
+	// OnReport isn't called after Run returns.
+	defer func() {
+		stopReports()
+		reporter.Wait()
+	}()
+	if cfg.OnReport != nil && cfg.ReportInterval > 0 {
+		reporter.Add(1)
+		go func() {
+			defer reporter.Done()
+			ticker := time.NewTicker(cfg.ReportInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					cfg.OnReport(stats.report(cfg.Sessions, cfg.TPS))
+				case <-reportCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	receipt := cfg.Base.RegisteredDelivery&sender.RdRequested != 0
+	slots := make(chan struct{}, maxInFlightPerSession*cfg.Sessions)
+	var wg sync.WaitGroup
+	runCtx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	interval := time.Duration(float64(time.Second) / cfg.TPS)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	next := time.Now()
+loop:
+	for n := 0; ; n++ {
+		timer.Reset(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-runCtx.Done():
+			break loop
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-runCtx.Done():
+			break loop
+		}
+		// Messages missed while stalled, e.g. with all slots taken, are not
+		// sent in a burst to catch up, it would exceed the target rate.
+		next = next.Add(interval)
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+
+		entry := mix.pick()
+		req := cfg.Base
+		req.Destination.Addr = cfg.Destinations.Next()
+		req.EffectiveCoding = entry.Coding
+		req.DeceptiveCoding = entry.Coding
+		req.SplitMode = entry.SplitMode
+		req.Message = messageText(n, entry.Length)
+		session := sessions[n%len(sessions)]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// In-flight messages are waited for past the duration.
+			result, err := session.Send(ctx, &req)
+			stats.sent(entry, result, err, receipt)
+			<-slots
+		}()
+	}
+	wg.Wait()
+	stats.finish()
+
+	if receipt {
+		waitReceipts(ctx, stats, cfg.ReceiptWait)
+	}
+	return stats.report(cfg.Sessions, cfg.TPS), nil
+}
+
+// waitReceipts polls for missing receipts until all arrive, ctx is done or
+// timeout expires.
+func waitReceipts(ctx context.Context, stats *collector, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for stats.pendingReceipts() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
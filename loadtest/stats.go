@@ -0,0 +1,276 @@
+package loadtest
+
+import (
+	"errors"
+	"smppizdez/sender"
+	"smppizdez/smpp"
+	"sync"
+	"time"
+)
+
+// Latency holds response latency percentiles in milliseconds.
+type Latency struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+type Receipts struct {
+	// Expected is the number of accepted segments that requested a
+	// receipt.
+	Expected int `json:"expected"`
+	Arrived  int `json:"arrived"`
+	// Ratio is the share of expected receipts that arrived.
+	Ratio float64 `json:"ratio"`
+	// PerSecond is the receipt arrival rate over the whole run.
+	PerSecond float64        `json:"perSecond"`
+	States    map[string]int `json:"states,omitempty"`
+	// Unmatched counts receipts with message IDs of no segment awaiting a
+	// receipt, e.g. left from earlier runs or repeated.
+	Unmatched int `json:"unmatched"`
+	// Untracked counts accepted segments whose receipts weren't awaited,
+	// since too many receipts were outstanding. They aren't expected.
+	Untracked int `json:"untracked,omitempty"`
+}
+
+// Report is a summary of a load test, either live or final.
+type Report struct {
+	Started   time.Time `json:"started"`
+	ElapsedS  float64   `json:"elapsedSeconds"`
+	Sessions  int       `json:"sessions"`
+	TargetTPS float64   `json:"targetTps"`
+	// Messages and Segments count submitted requests, AchievedTPS counts
+	// messages.
+	Messages    int     `json:"messages"`
+	Segments    int     `json:"segments"`
+	AchievedTPS float64 `json:"achievedTps"`
+	SegmentsTPS float64 `json:"segmentsTps"`
+	// Statuses counts responses by command status.
+	Statuses map[string]int `json:"statuses"`
+	// Errors counts segments that got no response or weren't submitted.
+	Errors   map[string]int `json:"errors,omitempty"`
+	Latency  Latency        `json:"latencyMs"`
+	Receipts Receipts       `json:"receipts"`
+	// Mix counts messages by kind.
+	Mix map[string]int `json:"mix"`
+}
+
+// maxEarlyReceipts bounds the number of receipts kept until the response with
+// their message ID is handled. Receipts past it are counted as unmatched.
+const maxEarlyReceipts = 10000
+
+// maxOutstandingReceipts bounds the number of message IDs awaiting a
+// receipt. Segments accepted past it are counted as untracked.
+const maxOutstandingReceipts = 100000
+
+type collector struct {
+	mu      sync.Mutex
+	started time.Time
+	// finished is set once all messages got their responses, rates of
+	// messages are counted up to it.
+	finished  time.Time
+	messages  int
+	segments  int
+	statuses  map[sender.CommandStatus]int
+	errors    map[string]int
+	latencies smpp.LatencySample
+	mix       map[string]int
+	// receipts holds message IDs of accepted segments awaiting a receipt.
+	receipts  map[string]struct{}
+	expected  int
+	untracked int
+	// early keeps receipts arrived before the response with their message
+	// ID was handled.
+	early map[string]string
+	// dropped counts receipts that didn't fit into early.
+	dropped int
+	arrived int
+	states  map[string]int
+}
+
+func newCollector() *collector {
+	return &collector{
+		started:  time.Now(),
+		statuses: make(map[sender.CommandStatus]int),
+		errors:   make(map[string]int),
+		mix:      make(map[string]int),
+		receipts: make(map[string]struct{}),
+		early:    make(map[string]string),
+		states:   make(map[string]int),
+	}
+}
+
+func (c *collector) restart() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.started = time.Now()
+}
+
+func (c *collector) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.finished = time.Now()
+}
+
+func (c *collector) sent(entry MixEntry, result sender.SendResult, err error, receipt bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.messages++
+	c.mix[entry.String()]++
+	if len(result.Segments) == 0 && err != nil {
+		c.errors[errorKind(err)]++
+		return
+	}
+
+	for _, seg := range result.Segments {
+		c.segments++
+		if seg.Err != nil {
+			c.errors[errorKind(seg.Err)]++
+			continue
+		}
+		c.statuses[seg.Status]++
+		c.latencies.Add(seg.Latency)
+		if !receipt || seg.Status != sender.ESME_ROK || seg.MessageID == "" {
+			continue
+		}
+
+		if state, ok := c.early[seg.MessageID]; ok {
+			delete(c.early, seg.MessageID)
+			c.expected++
+			c.receiptArrived(state)
+			continue
+		}
+		if len(c.receipts) >= maxOutstandingReceipts {
+			c.untracked++
+			continue
+		}
+		c.receipts[seg.MessageID] = struct{}{}
+		c.expected++
+	}
+}
+
+func errorKind(err error) string {
+	if errors.Is(err, smpp.NoResponse) {
+		return "no response"
+	}
+	return err.Error()
+}
+
+func (c *collector) handlePDU(dir sender.Direction, pd sender.PDU) {
+	dlv, ok := pd.(*sender.DeliverSMPDU)
+	if !ok || dir != sender.Inbound || dlv.MessageID == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, expected := c.receipts[dlv.MessageID]
+	switch {
+	case expected:
+		delete(c.receipts, dlv.MessageID)
+		c.receiptArrived(dlv.ReceiptState)
+	case len(c.early) < maxEarlyReceipts:
+		c.early[dlv.MessageID] = dlv.ReceiptState
+	default:
+		c.dropped++
+	}
+}
+
+func (c *collector) receiptArrived(state string) {
+	c.arrived++
+	if state != "" {
+		c.states[state]++
+	}
+}
+
+// pendingReceipts returns the number of expected receipts that haven't
+// arrived yet.
+func (c *collector) pendingReceipts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.receipts)
+}
+
+func (c *collector) report(sessions int, tps float64) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elapsed := time.Since(c.started).Seconds()
+	sending := elapsed
+	if !c.finished.IsZero() {
+		sending = c.finished.Sub(c.started).Seconds()
+	}
+	r := Report{
+		Started:   c.started,
+		ElapsedS:  elapsed,
+		Sessions:  sessions,
+		TargetTPS: tps,
+		Messages:  c.messages,
+		Segments:  c.segments,
+		Statuses:  make(map[string]int, len(c.statuses)),
+		Errors:    make(map[string]int, len(c.errors)),
+		Latency:   latency(&c.latencies),
+		Mix:       make(map[string]int, len(c.mix)),
+		Receipts: Receipts{
+			Expected: c.expected,
+			Arrived:  c.arrived,
+			States:   make(map[string]int, len(c.states)),
+			// Receipts still kept as early are reported as unmatched,
+			// though some of them may match a response yet.
+			Unmatched: len(c.early) + c.dropped,
+			Untracked: c.untracked,
+		},
+	}
+	if sending > 0 {
+		r.AchievedTPS = float64(c.messages) / sending
+		r.SegmentsTPS = float64(c.segments) / sending
+	}
+	if elapsed > 0 {
+		r.Receipts.PerSecond = float64(c.arrived) / elapsed
+	}
+	if r.Receipts.Expected > 0 {
+		r.Receipts.Ratio = float64(c.arrived) / float64(r.Receipts.Expected)
+	}
+	for status, count := range c.statuses {
+		r.Statuses[status.String()] = count
+	}
+	for kind, count := range c.errors {
+		r.Errors[kind] = count
+	}
+	for kind, count := range c.mix {
+		r.Mix[kind] = count
+	}
+	for state, count := range c.states {
+		r.Receipts.States[state] = count
+	}
+	return r
+}
+
+func latency(latencies *smpp.LatencySample) Latency {
+	if latencies.Count() == 0 {
+		return Latency{}
+	}
+
+	sorted := latencies.Sorted()
+	percentile := func(p int) float64 {
+		return ms(smpp.Percentile(sorted, p))
+	}
+	return Latency{
+		Min: ms(latencies.Min()),
+		Avg: ms(latencies.Avg()),
+		P50: percentile(50),
+		P90: percentile(90),
+		P95: percentile(95),
+		P99: percentile(99),
+		Max: ms(latencies.Max()),
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,109 @@
+package loadtest
+
+import (
+	"fmt"
+	"smppizdez/sender"
+	"smppizdez/smpp"
+	"testing"
+	"time"
+)
+
+func TestLatency(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		want      Latency
+	}{
+		{name: "none", want: Latency{}},
+		{
+			name:      "single",
+			latencies: []time.Duration{3 * time.Millisecond},
+			want:      Latency{Min: 3, Avg: 3, P50: 3, P90: 3, P95: 3, P99: 3, Max: 3},
+		},
+		{
+			name:      "unsorted",
+			latencies: []time.Duration{4 * time.Millisecond, time.Millisecond, 3 * time.Millisecond, 2 * time.Millisecond},
+			want:      Latency{Min: 1, Avg: 2.5, P50: 2, P90: 4, P95: 4, P99: 4, Max: 4},
+		},
+		{
+			name:      "hundred",
+			latencies: millis(100),
+			want:      Latency{Min: 1, Avg: 50.5, P50: 50, P90: 90, P95: 95, P99: 99, Max: 100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sample smpp.LatencySample
+			for _, l := range tt.latencies {
+				sample.Add(l)
+			}
+			if got := latency(&sample); got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// millis returns 1ms..n ms in reverse order.
+func millis(n int) []time.Duration {
+	l := make([]time.Duration, n)
+	for i := range l {
+		l[i] = time.Duration(n-i) * time.Millisecond
+	}
+	return l
+}
+
+func TestUnmatchedReceipts(t *testing.T) {
+	c := newCollector()
+	receipt := func(id string) {
+		c.handlePDU(sender.Inbound, &sender.DeliverSMPDU{MessageID: id, ReceiptState: "DELIVRD"})
+	}
+
+	receipt("early")
+	for i := range maxEarlyReceipts + 5 {
+		receipt(fmt.Sprintf("old%d", i))
+	}
+	if len(c.early) != maxEarlyReceipts {
+		t.Fatalf("%d receipt(s) kept, want %d", len(c.early), maxEarlyReceipts)
+	}
+
+	seg := sender.SegmentResult{Status: sender.ESME_ROK, MessageID: "early"}
+	c.sent(MixEntry{}, sender.SendResult{Segments: []sender.SegmentResult{seg}}, nil, true)
+	r := c.report(1, 1).Receipts
+	if r.Expected != 1 || r.Arrived != 1 {
+		t.Fatalf("%d/%d receipt(s) arrived, want 1/1", r.Arrived, r.Expected)
+	}
+	if want := maxEarlyReceipts + 5; r.Unmatched != want {
+		t.Fatalf("%d unmatched receipt(s), want %d", r.Unmatched, want)
+	}
+}
+
+func TestOutstandingReceipts(t *testing.T) {
+	c := newCollector()
+	accept := func(id string) {
+		seg := sender.SegmentResult{Status: sender.ESME_ROK, MessageID: id}
+		c.sent(MixEntry{}, sender.SendResult{Segments: []sender.SegmentResult{seg}}, nil, true)
+	}
+	receipt := func(id string) {
+		c.handlePDU(sender.Inbound, &sender.DeliverSMPDU{MessageID: id, ReceiptState: "DELIVRD"})
+	}
+
+	for i := range maxOutstandingReceipts + 2 {
+		accept(fmt.Sprintf("m%d", i))
+	}
+	if n := c.pendingReceipts(); n != maxOutstandingReceipts {
+		t.Fatalf("%d receipt(s) awaited, want %d", n, maxOutstandingReceipts)
+	}
+
+	receipt("m0")
+	receipt("m0")
+	if n := c.pendingReceipts(); n != maxOutstandingReceipts-1 {
+		t.Fatalf("%d receipt(s) awaited after one arrived, want %d", n, maxOutstandingReceipts-1)
+	}
+	r := c.report(1, 1).Receipts
+	want := Receipts{Expected: maxOutstandingReceipts, Arrived: 1, Unmatched: 1, Untracked: 2}
+	if r.Expected != want.Expected || r.Arrived != want.Arrived || r.Unmatched != want.Unmatched || r.Untracked != want.Untracked {
+		t.Fatalf("got %+v, want %+v", r, want)
+	}
+}
@@ -1,11 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"smppizdez/cli"
 	"smppizdez/glade"
 	"smppizdez/json_storage"
 	"smppizdez/smpp"
-	"time"
 
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
@@ -35,20 +36,24 @@ func activate(app *gtk.Application) {
 
 	mainWindowI, _ := builder.GetObject("main_window")
 	mainWindow = mainWindowI.(*gtk.Window)
-	initAccountsList(builder, accRepo)
+	initAccountsList(builder, accRepo, smpp.Sender{})
 
-	sender := smpp.Sender{
-		ReadTimeout:  time.Minute,
-		WriteTimeout: time.Minute,
-		EnquireLink:  30 * time.Second,
-	}
-	initSubmitSmForm(builder, sender)
+	initSessionsNotebook(builder, smpp.Sender{})
 
 	mainWindow.Present()
 	app.AddWindow(mainWindow)
 }
 
 func main() {
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		accRepo, err := json_storage.Open("data.json")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+			os.Exit(cli.ExitFailure)
+		}
+		os.Exit(cli.Run(os.Args[1:], accRepo, smpp.Sender{}))
+	}
+
 	const appID = "org.smppizdez"
 	application, err := gtk.ApplicationNew(appID, glib.APPLICATION_FLAGS_NONE)
 	if err != nil {
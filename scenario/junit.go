@@ -0,0 +1,90 @@
+package scenario
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	Skipped   *struct{}     `xml:"skipped"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes reports as JUnit XML, a test suite per scenario and a
+// test case per step.
+func WriteJUnit(w io.Writer, reports []Report) error {
+	var suites junitSuites
+	var total time.Duration
+	for _, report := range reports {
+		suite := junitSuite{
+			Name:      report.Name,
+			Tests:     len(report.Steps),
+			Failures:  report.Count(Failed),
+			Skipped:   report.Count(Skipped),
+			Time:      seconds(report.Duration),
+			Timestamp: report.Started.Format("2006-01-02T15:04:05"),
+		}
+		for _, step := range report.Steps {
+			c := junitCase{Name: step.Title, ClassName: report.Name, Time: seconds(step.Duration)}
+			switch step.Status {
+			case Failed:
+				c.Failure = &junitFailure{Message: step.Err.Error(), Type: step.Kind, Text: step.Err.Error()}
+			case Skipped:
+				c.Skipped = &struct{}{}
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+
+		suites.Suites = append(suites.Suites, suite)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+		total += report.Duration
+	}
+	suites.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,279 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"smppizdez/sender"
+	"sync"
+	"time"
+)
+
+var (
+	NotBound     = errors.New("Not bound, bind first")
+	AlreadyBound = errors.New("Already bound, unbind first")
+	NothingSent  = errors.New("No message was sent")
+)
+
+type Status int
+
+const (
+	Passed Status = iota + 1
+	Failed
+	Skipped
+)
+
+func (s Status) String() string {
+	switch s {
+	case Passed:
+		return "PASS"
+	case Failed:
+		return "FAIL"
+	case Skipped:
+		return "SKIP"
+	default:
+		return fmt.Sprintf("Unknown Status enum value (%d)", s)
+	}
+}
+
+type StepResult struct {
+	Title    string
+	Kind     string
+	Status   Status
+	Err      error
+	Duration time.Duration
+}
+
+type Report struct {
+	Name     string
+	Started  time.Time
+	Duration time.Duration
+	Steps    []StepResult
+}
+
+// Count returns the number of steps with the given status.
+func (r Report) Count(status Status) int {
+	n := 0
+	for _, step := range r.Steps {
+		if step.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// binding collects deliver_sm of one bound session.
+type binding struct {
+	session sender.Session
+
+	mu       sync.Mutex
+	inbox    []*sender.DeliverSMPDU
+	closed   bool
+	closeErr error
+	// changed is closed and replaced whenever a deliver_sm arrives or the
+	// session is closed.
+	changed chan struct{}
+}
+
+func (b *binding) handlePDU(dir sender.Direction, pd sender.PDU) {
+	dlv, ok := pd.(*sender.DeliverSMPDU)
+	if !ok || dir != sender.Inbound {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inbox = append(b.inbox, dlv)
+	b.notify()
+}
+
+func (b *binding) handleClose(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.closeErr = err
+	b.notify()
+}
+
+func (b *binding) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+type runner struct {
+	sender  sender.Sender
+	current *binding
+	// last is the result of the last send step.
+	last *sender.SendResult
+}
+
+// Run runs steps of sc in order. Once a step fails the rest are skipped.
+// If the scenario didn't unbind, the session is closed at the end and the
+// result is reported as an implicit unbind step.
+func Run(ctx context.Context, s sender.Sender, sc *Scenario) Report {
+	r := &runner{sender: s}
+	report := Report{Name: sc.Name, Started: time.Now()}
+
+	failed := false
+	for i := range sc.Steps {
+		step := &sc.Steps[i]
+		res := StepResult{Title: step.Title(i), Kind: step.Kind(), Status: Skipped}
+		if !failed {
+			start := time.Now()
+			res.Err = r.run(ctx, step)
+			res.Duration = time.Since(start)
+			res.Status = Passed
+			if res.Err != nil {
+				res.Status = Failed
+				failed = true
+			}
+		}
+		report.Steps = append(report.Steps, res)
+	}
+
+	if r.current != nil {
+		res := StepResult{Title: "implicit unbind", Kind: "unbind", Status: Passed}
+		start := time.Now()
+		res.Err = r.unbind()
+		res.Duration = time.Since(start)
+		if res.Err != nil {
+			res.Status = Failed
+		}
+		report.Steps = append(report.Steps, res)
+	}
+	report.Duration = time.Since(report.Started)
+	return report
+}
+
+func (r *runner) run(ctx context.Context, step *Step) error {
+	switch {
+	case step.Bind != nil:
+		return r.bind(step.Bind)
+	case step.Send != nil:
+		return r.send(ctx, step.Send)
+	case step.ExpectResp != nil:
+		return r.expectResp(step.ExpectResp)
+	case step.ExpectDeliver != nil:
+		return r.expectDeliver(ctx, step.ExpectDeliver)
+	case step.Wait != nil:
+		select {
+		case <-time.After(time.Duration(*step.Wait)):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case step.Unbind != nil:
+		return r.unbind()
+	default:
+		return InvalidStep
+	}
+}
+
+func (r *runner) bind(bind *Bind) error {
+	if r.current != nil {
+		return AlreadyBound
+	}
+	if bind.Resolved == nil {
+		return fmt.Errorf("Account %s isn't resolved", bind.Account)
+	}
+
+	b := &binding{changed: make(chan struct{})}
+	session, err := r.sender.StartSession(
+		bind.Resolved,
+		b.handlePDU,
+		b.handleClose,
+		func(sender.ReconnectEvent) {},
+		func(sender.SessionState) {},
+	)
+	if err != nil {
+		return err
+	}
+	b.session = session
+	r.current = b
+	return nil
+}
+
+func (r *runner) send(ctx context.Context, send *Send) error {
+	if r.current == nil {
+		return NotBound
+	}
+	if send.Request == nil {
+		return errors.New("Request isn't made of options")
+	}
+
+	res, err := r.current.session.Send(ctx, send.Request)
+	r.last = &res
+	return err
+}
+
+func (r *runner) expectResp(expect *ExpectResp) error {
+	if r.last == nil {
+		return NothingSent
+	}
+	segments := r.last.Segments
+	if expect.Segments > 0 && len(segments) != expect.Segments {
+		return fmt.Errorf("Got %d segment(s), expected %d", len(segments), expect.Segments)
+	}
+	for i, seg := range segments {
+		if seg.Err != nil {
+			return fmt.Errorf("Segment %d: %w", i+1, seg.Err)
+		}
+		if seg.Status != expect.status {
+			return fmt.Errorf("Segment %d: got %v, expected %v", i+1, seg.Status, expect.status)
+		}
+	}
+	return nil
+}
+
+func (r *runner) expectDeliver(ctx context.Context, expect *ExpectDeliver) error {
+	b := r.current
+	if b == nil {
+		return NotBound
+	}
+	var lastIDs []string
+	if r.last != nil {
+		for _, seg := range r.last.Segments {
+			lastIDs = append(lastIDs, seg.MessageID)
+		}
+	}
+
+	timeout := time.Duration(expect.Timeout)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		b.mu.Lock()
+		for i, dlv := range b.inbox {
+			if expect.match(dlv, lastIDs) {
+				b.inbox = append(b.inbox[:i], b.inbox[i+1:]...)
+				b.mu.Unlock()
+				return nil
+			}
+		}
+		unmatched, closed, closeErr, changed := len(b.inbox), b.closed, b.closeErr, b.changed
+		b.mu.Unlock()
+
+		if closed {
+			return fmt.Errorf("Session closed before deliver_sm matching %s arrived: %v", expect.describe(), closeErr)
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return fmt.Errorf(
+				"No deliver_sm matching %s within %v, %d other deliver_sm received",
+				expect.describe(),
+				timeout,
+				unmatched,
+			)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *runner) unbind() error {
+	if r.current == nil {
+		return NotBound
+	}
+	err := r.current.session.Close()
+	r.current = nil
+	return err
+}
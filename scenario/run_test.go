@@ -0,0 +1,137 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"smppizdez/account"
+	"smppizdez/sender"
+	"strings"
+	"testing"
+)
+
+// fakeSender starts sessions accepting every segment.
+type fakeSender struct {
+	sender.Sender
+	closeErr error
+	sessions []*fakeSession
+}
+
+func (s *fakeSender) StartSession(
+	acc *account.Account,
+	handler sender.PDUHandler,
+	onClose sender.CloseHandler,
+	onReconnect sender.ReconnectHandler,
+	onState sender.StateHandler,
+) (sender.Session, error) {
+	session := &fakeSession{closeErr: s.closeErr}
+	s.sessions = append(s.sessions, session)
+	return session, nil
+}
+
+type fakeSession struct {
+	sender.Session
+	closeErr error
+	closed   int
+}
+
+func (s *fakeSession) Send(ctx context.Context, req *sender.Request) (sender.SendResult, error) {
+	seg := sender.SegmentResult{Status: sender.ESME_ROK, MessageID: "m1"}
+	return sender.SendResult{Segments: []sender.SegmentResult{seg}}, nil
+}
+
+func (s *fakeSession) Close() error {
+	s.closed++
+	return s.closeErr
+}
+
+func parseScenario(t *testing.T, json string) *Scenario {
+	t.Helper()
+	sc, err := Parse(strings.NewReader(json))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range sc.Steps {
+		if bind := sc.Steps[i].Bind; bind != nil {
+			bind.Resolved = &account.Account{SystemID: bind.Account}
+		}
+		if send := sc.Steps[i].Send; send != nil {
+			send.Request = &sender.Request{}
+		}
+	}
+	return sc
+}
+
+func TestRun(t *testing.T) {
+	closeErr := errors.New("No unbind_resp")
+	tests := []struct {
+		name     string
+		json     string
+		closeErr error
+		want     []Status
+		// implicit is set if the last step is the implicit unbind.
+		implicit bool
+	}{
+		{
+			name: "unbound",
+			json: `{"steps": [{"bind": {"account": "a"}}, {"send": {}}, {"expectResp": {}}, {"unbind": {}}]}`,
+			want: []Status{Passed, Passed, Passed, Passed},
+		},
+		{
+			name:     "left bound",
+			json:     `{"steps": [{"bind": {"account": "a"}}, {"send": {}}]}`,
+			want:     []Status{Passed, Passed, Passed},
+			implicit: true,
+		},
+		{
+			name:     "left bound with close error",
+			json:     `{"steps": [{"bind": {"account": "a"}}]}`,
+			closeErr: closeErr,
+			want:     []Status{Passed, Failed},
+			implicit: true,
+		},
+		{
+			name:     "failed step",
+			json:     `{"steps": [{"bind": {"account": "a"}}, {"expectResp": {"status": "esme_rthrottled"}}, {"unbind": {}}]}`,
+			want:     []Status{Passed, Failed, Skipped, Passed},
+			implicit: true,
+		},
+		{
+			name: "not bound",
+			json: `{"steps": [{"send": {}}, {"bind": {"account": "a"}}]}`,
+			want: []Status{Failed, Skipped},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeSender{closeErr: tt.closeErr}
+			report := Run(context.Background(), s, parseScenario(t, tt.json))
+
+			var got []Status
+			for _, step := range report.Steps {
+				got = append(got, step.Status)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got statuses %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got statuses %v, want %v", got, tt.want)
+				}
+			}
+
+			last := report.Steps[len(report.Steps)-1]
+			if (last.Title == "implicit unbind") != tt.implicit {
+				t.Fatalf("last step is %q", last.Title)
+			}
+			if tt.implicit && !errors.Is(last.Err, tt.closeErr) {
+				t.Fatalf("implicit unbind error is %v, want %v", last.Err, tt.closeErr)
+			}
+			for i, session := range s.sessions {
+				if session.closed != 1 {
+					t.Fatalf("session %d closed %d time(s)", i, session.closed)
+				}
+			}
+		})
+	}
+}
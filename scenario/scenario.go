@@ -0,0 +1,269 @@
+// Package scenario runs scripted SMPP test cases: steps bind, submit
+// messages, check responses and deliver_sm and report pass or fail per step.
+package scenario
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"smppizdez/account"
+	"smppizdez/sender"
+	"strings"
+	"time"
+)
+
+var (
+	NoSteps     = errors.New("Scenario has no steps")
+	InvalidStep = errors.New("Step must have exactly one of bind, send, expectResp, expectDeliver, wait and unbind")
+)
+
+// Scenario is a sequence of steps run over one session at a time.
+type Scenario struct {
+	Name  string `json:"name"`
+	Steps []Step `json:"steps"`
+}
+
+// Step is one action or assertion. Exactly one of its kinds is set.
+type Step struct {
+	Name          string         `json:"name"`
+	Bind          *Bind          `json:"bind"`
+	Send          *Send          `json:"send"`
+	ExpectResp    *ExpectResp    `json:"expectResp"`
+	ExpectDeliver *ExpectDeliver `json:"expectDeliver"`
+	Wait          *Duration      `json:"wait"`
+	Unbind        *struct{}      `json:"unbind"`
+}
+
+type Bind struct {
+	Account string `json:"account"`
+	// Resolved is the account to bind with, it must be set by the caller.
+	Resolved *account.Account `json:"-"`
+}
+
+// Send submits a message and waits for its responses.
+type Send struct {
+	// Options describe the request, e.g. the send command flags.
+	Options map[string]any
+	// Request must be made of Options by the caller.
+	Request *sender.Request
+}
+
+func (s *Send) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &s.Options)
+}
+
+// ExpectResp checks responses to segments of the last sent message.
+type ExpectResp struct {
+	// Status every segment must be responded with, ESME_ROK by default.
+	Status string `json:"status"`
+	// Segments, if not zero, is the expected number of segments.
+	Segments int `json:"segments"`
+
+	status sender.CommandStatus
+}
+
+// ExpectDeliver waits for a deliver_sm matching all given fields. Every
+// deliver_sm matches at most one step.
+type ExpectDeliver struct {
+	Timeout     Duration `json:"timeout"`
+	Source      string   `json:"source"`
+	Destination string   `json:"destination"`
+	Text        string   `json:"text"`
+	// TextMatches is a regular expression the text must match.
+	TextMatches string `json:"textMatches"`
+	EsmClass    *int   `json:"esmClass"`
+	// Receipt requires a delivery receipt for a segment of the last sent
+	// message.
+	Receipt      bool   `json:"receipt"`
+	ReceiptState string `json:"receiptState"`
+
+	textRe *regexp.Regexp
+}
+
+// DefaultDeliverTimeout is used by expectDeliver steps without a timeout.
+const DefaultDeliverTimeout = 30 * time.Second
+
+// Duration is a time.Duration written as a string in JSON, e.g. "1.5s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Parse reads a scenario in JSON.
+func Parse(r io.Reader) (*Scenario, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var s Scenario
+	if err := dec.Decode(&s); err != nil {
+		return nil, err
+	}
+	if len(s.Steps) == 0 {
+		return nil, NoSteps
+	}
+
+	for i := range s.Steps {
+		if err := s.Steps[i].validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Steps[i].Title(i), err)
+		}
+	}
+	return &s, nil
+}
+
+// Kind returns the JSON name of the step kind.
+func (s *Step) Kind() string {
+	switch {
+	case s.Bind != nil:
+		return "bind"
+	case s.Send != nil:
+		return "send"
+	case s.ExpectResp != nil:
+		return "expectResp"
+	case s.ExpectDeliver != nil:
+		return "expectDeliver"
+	case s.Wait != nil:
+		return "wait"
+	case s.Unbind != nil:
+		return "unbind"
+	default:
+		return ""
+	}
+}
+
+// Title returns the step name, or its number and kind if it has none.
+func (s *Step) Title(idx int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("step %d %s", idx+1, s.Kind())
+}
+
+func (s *Step) validate() error {
+	kinds := 0
+	for _, set := range []bool{
+		s.Bind != nil,
+		s.Send != nil,
+		s.ExpectResp != nil,
+		s.ExpectDeliver != nil,
+		s.Wait != nil,
+		s.Unbind != nil,
+	} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return InvalidStep
+	}
+
+	switch {
+	case s.Bind != nil:
+		if s.Bind.Account == "" {
+			return errors.New("Account is required")
+		}
+	case s.ExpectResp != nil:
+		return s.ExpectResp.validate()
+	case s.ExpectDeliver != nil:
+		return s.ExpectDeliver.validate()
+	}
+	return nil
+}
+
+func (e *ExpectResp) validate() error {
+	if e.Status == "" {
+		e.status = sender.ESME_ROK
+		return nil
+	}
+	for status := sender.ESME_ROK; status <= sender.ESME_RUNKNOWNERR; status++ {
+		if strings.EqualFold(status.String(), e.Status) {
+			e.status = status
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown command status %s", e.Status)
+}
+
+func (e *ExpectDeliver) validate() error {
+	if e.Timeout == 0 {
+		e.Timeout = Duration(DefaultDeliverTimeout)
+	}
+	if e.TextMatches != "" {
+		re, err := regexp.Compile(e.TextMatches)
+		if err != nil {
+			return err
+		}
+		e.textRe = re
+	}
+	return nil
+}
+
+// match reports whether dlv matches the step, lastIDs are message IDs of
+// segments of the last sent message.
+func (e *ExpectDeliver) match(dlv *sender.DeliverSMPDU, lastIDs []string) bool {
+	switch {
+	case e.Source != "" && dlv.Source.Addr != e.Source,
+		e.Destination != "" && dlv.Destination.Addr != e.Destination,
+		e.Text != "" && dlv.Message != e.Text,
+		e.textRe != nil && !e.textRe.MatchString(dlv.Message),
+		e.EsmClass != nil && dlv.EsmClass != *e.EsmClass,
+		e.ReceiptState != "" && !strings.EqualFold(dlv.ReceiptState, e.ReceiptState):
+		return false
+	}
+	if e.Receipt {
+		for _, id := range lastIDs {
+			if id != "" && id == dlv.MessageID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// describe returns the fields the step matches for failure messages.
+func (e *ExpectDeliver) describe() string {
+	var fields []string
+	add := func(name string, value any) {
+		fields = append(fields, fmt.Sprintf("%s=%v", name, value))
+	}
+	if e.Source != "" {
+		add("source", e.Source)
+	}
+	if e.Destination != "" {
+		add("destination", e.Destination)
+	}
+	if e.Text != "" {
+		add("text", fmt.Sprintf("%q", e.Text))
+	}
+	if e.TextMatches != "" {
+		add("textMatches", e.TextMatches)
+	}
+	if e.EsmClass != nil {
+		add("esmClass", *e.EsmClass)
+	}
+	if e.Receipt {
+		add("receipt", true)
+	}
+	if e.ReceiptState != "" {
+		add("receiptState", e.ReceiptState)
+	}
+	if len(fields) == 0 {
+		return "any"
+	}
+	return strings.Join(fields, " ")
+}
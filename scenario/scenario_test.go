@@ -0,0 +1,134 @@
+package scenario
+
+import (
+	"errors"
+	"smppizdez/sender"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		kinds []string
+		err   string
+	}{
+		{
+			name: "all kinds",
+			json: `{"name": "all", "steps": [
+				{"bind": {"account": "test"}},
+				{"send": {"to": "123", "text": "hi", "receipt": "requested"}},
+				{"expectResp": {"status": "esme_rok", "segments": 1}},
+				{"expectDeliver": {"receipt": true, "textMatches": "^id:"}},
+				{"wait": "1.5s"},
+				{"unbind": {}}
+			]}`,
+			kinds: []string{"bind", "send", "expectResp", "expectDeliver", "wait", "unbind"},
+		},
+		{name: "no steps", json: `{"steps": []}`, err: NoSteps.Error()},
+		{name: "no kind", json: `{"steps": [{"name": "nothing"}]}`, err: "nothing: " + InvalidStep.Error()},
+		{name: "two kinds", json: `{"steps": [{"wait": "1s", "unbind": {}}]}`, err: InvalidStep.Error()},
+		{name: "unknown field", json: `{"steps": [{"sleep": "1s"}]}`, err: "unknown field"},
+		{name: "bind without account", json: `{"steps": [{"bind": {}}]}`, err: "Account is required"},
+		{name: "unknown status", json: `{"steps": [{"expectResp": {"status": "ok"}}]}`, err: "Unknown command status ok"},
+		{name: "invalid regexp", json: `{"steps": [{"expectDeliver": {"textMatches": "("}}]}`, err: "missing closing )"},
+		{name: "invalid duration", json: `{"steps": [{"wait": "soon"}]}`, err: "invalid duration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := Parse(strings.NewReader(tt.json))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kinds []string
+			for _, step := range sc.Steps {
+				kinds = append(kinds, step.Kind())
+			}
+			if strings.Join(kinds, ",") != strings.Join(tt.kinds, ",") {
+				t.Fatalf("got kinds %v, want %v", kinds, tt.kinds)
+			}
+		})
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	sc, err := Parse(strings.NewReader(`{"steps": [
+		{"send": {"to": ["1", "2"], "udh-ie": 5}},
+		{"expectResp": {}},
+		{"expectDeliver": {}},
+		{"wait": "250ms"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sc.Steps[0].Title(0); got != "step 1 send" {
+		t.Fatalf("got title %q", got)
+	}
+	if n := len(sc.Steps[0].Send.Options); n != 2 {
+		t.Fatalf("got %d send option(s), want 2", n)
+	}
+	if sc.Steps[1].ExpectResp.status != sender.ESME_ROK {
+		t.Fatalf("expectResp defaults to %v", sc.Steps[1].ExpectResp.status)
+	}
+	if sc.Steps[2].ExpectDeliver.Timeout != Duration(DefaultDeliverTimeout) {
+		t.Fatalf("expectDeliver timeout defaults to %v", time.Duration(sc.Steps[2].ExpectDeliver.Timeout))
+	}
+	if *sc.Steps[3].Wait != Duration(250*time.Millisecond) {
+		t.Fatalf("wait is %v", time.Duration(*sc.Steps[3].Wait))
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	started := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	reports := []Report{
+		{
+			Name:     "first",
+			Started:  started,
+			Duration: 1500 * time.Millisecond,
+			Steps: []StepResult{
+				{Title: "bind", Kind: "bind", Status: Passed, Duration: 250 * time.Millisecond},
+				{Title: "send <hi>", Kind: "send", Status: Failed, Err: errors.New("Got 2 segment(s) & more"), Duration: time.Second},
+				{Title: "step 3 unbind", Kind: "unbind", Status: Skipped},
+			},
+		},
+		{
+			Name:     "second",
+			Started:  started,
+			Duration: 500 * time.Millisecond,
+			Steps:    []StepResult{{Title: "wait", Kind: "wait", Status: Passed, Duration: 500 * time.Millisecond}},
+		},
+	}
+
+	var b strings.Builder
+	if err := WriteJUnit(&b, reports); err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="4" failures="1" skipped="1" time="2.000">
+  <testsuite name="first" tests="3" failures="1" skipped="1" time="1.500" timestamp="2024-05-06T07:08:09">
+    <testcase name="bind" classname="first" time="0.250"></testcase>
+    <testcase name="send &lt;hi&gt;" classname="first" time="1.000">
+      <failure message="Got 2 segment(s) &amp; more" type="send">Got 2 segment(s) &amp; more</failure>
+    </testcase>
+    <testcase name="step 3 unbind" classname="first" time="0.000">
+      <skipped></skipped>
+    </testcase>
+  </testsuite>
+  <testsuite name="second" tests="1" failures="0" skipped="0" time="0.500" timestamp="2024-05-06T07:08:09">
+    <testcase name="wait" classname="second" time="0.500"></testcase>
+  </testsuite>
+</testsuites>
+`
+	if got := b.String(); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -1,9 +1,12 @@
 package sender
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"smppizdez/account"
 	"smppizdez/coding"
+	"time"
 )
 
 type Request struct {
@@ -12,11 +15,20 @@ type Request struct {
 	ValidityPeriod     string
 	RegisteredDelivery RegisteredDelivery
 	Message            string
+	IsBinary           bool
+	BinaryMessage      []byte
 	DeceptiveCoding    coding.Coding
 	EffectiveCoding    coding.Coding
+	OverrideDataCoding bool
+	DataCoding         byte
 	SplitMode          SplitMode
+	ConcatIE           ConcatIE
+	RefMode            RefMode
+	Ref                uint16
 	Optional           []TLV
 	BytePerSegment     int
+	Ports              ApplicationPorts
+	InfoElements       []InfoElement
 }
 
 type Address struct {
@@ -163,11 +175,91 @@ func (s SplitMode) String() string {
 	}
 }
 
+type ConcatIE int
+
+const (
+	Concat8Bit ConcatIE = iota + 1
+	Concat16Bit
+)
+
+func (c ConcatIE) String() string {
+	switch c {
+	case Concat8Bit:
+		return "8-bit reference"
+	case Concat16Bit:
+		return "16-bit reference"
+	default:
+		return fmt.Sprintf("Unknown ConcatIE enum value (%d)", c)
+	}
+}
+
+type RefMode int
+
+const (
+	RefAuto RefMode = iota + 1
+	// RefPerDestination counts references for every destination address
+	// apart within a session.
+	RefPerDestination
+	RefExplicit
+)
+
+func (r RefMode) String() string {
+	switch r {
+	case RefAuto:
+		return "Auto"
+	case RefPerDestination:
+		return "Per destination"
+	case RefExplicit:
+		return "Explicit"
+	default:
+		return fmt.Sprintf("Unknown RefMode enum value (%d)", r)
+	}
+}
+
+type PortAddressing int
+
+const (
+	PortsNone PortAddressing = iota + 1
+	Ports8Bit
+	Ports16Bit
+)
+
+func (p PortAddressing) String() string {
+	switch p {
+	case PortsNone:
+		return "None"
+	case Ports8Bit:
+		return "8-bit"
+	case Ports16Bit:
+		return "16-bit"
+	default:
+		return fmt.Sprintf("Unknown PortAddressing enum value (%d)", p)
+	}
+}
+
+const (
+	PortWAPPush           uint16 = 2948
+	PortWAPConnectionless uint16 = 9200
+	PortVCard             uint16 = 9204
+	PortVCalendar         uint16 = 9205
+)
+
+type ApplicationPorts struct {
+	Addressing  PortAddressing
+	Source      uint16
+	Destination uint16
+}
+
 type TLV struct {
 	Tag   uint16
 	Value []byte
 }
 
+type InfoElement struct {
+	ID    byte
+	Value []byte
+}
+
 type CommandStatus int
 
 const (
@@ -405,6 +497,9 @@ type SubmitSMPDU struct {
 	Total          int
 	Seq            int
 	IsMultiSegment bool
+	// Retry is the number of times the segment was resubmitted after
+	// throttling.
+	Retry int
 }
 
 func (s *SubmitSMPDU) GetHeader() Header {
@@ -420,6 +515,17 @@ func (p *SubmitSMRespPDU) GetHeader() Header {
 	return p.Header
 }
 
+// NoResponsePDU is reported in place of the response to a request that got
+// none within response timeout.
+type NoResponsePDU struct {
+	Header
+	Timeout time.Duration
+}
+
+func (p *NoResponsePDU) GetHeader() Header {
+	return p.Header
+}
+
 type DeliverSMPDU struct {
 	Header
 	Source      Address
@@ -428,17 +534,116 @@ type DeliverSMPDU struct {
 	Coding      coding.Coding
 	Message     string
 	MessageID   string
+	// ReceiptState is the message state reported by delivery receipt, in
+	// the form used by receipt text (DELIVRD, UNDELIV, ...).
+	ReceiptState string
+	Optional     []TLV
 }
 
 func (p *DeliverSMPDU) GetHeader() Header {
 	return p.Header
 }
 
+// Interrupted is wrapped by the error of a segment submitted before sending
+// was cancelled and left without response, so SMSC may have accepted it.
+var Interrupted = errors.New("Sending interrupted before response")
+
+type SegmentResult struct {
+	Sequence  uint32
+	Ref       int
+	Total     int
+	Seq       int
+	Retries   int
+	Status    CommandStatus
+	MessageID string
+	Latency   time.Duration
+	// Err is set if the segment couldn't be submitted or got no response.
+	// Status and MessageID are meaningful only if Err is nil.
+	Err error
+}
+
+type SendResult struct {
+	Segments []SegmentResult
+}
+
+// Failed returns the number of segments that either got no response or were
+// rejected by SMSC.
+func (r SendResult) Failed() int {
+	failed := 0
+	for _, seg := range r.Segments {
+		if seg.Err != nil || seg.Status != ESME_ROK {
+			failed++
+		}
+	}
+	return failed
+}
+
+type ResponseStats struct {
+	Command Command
+	// Count is the number of responses received.
+	Count   int
+	Missing int
+	Min     time.Duration
+	Avg     time.Duration
+	P95     time.Duration
+	P99     time.Duration
+}
+
 type Session interface {
 	SendMessage(req *Request) error
+	// Send submits all segments of req and waits for their responses.
+	Send(ctx context.Context, req *Request) (SendResult, error)
+	// InFlight returns the number of submit_sm requests waiting for
+	// response and the window size (zero if unlimited).
+	InFlight() (int, int)
+	// Stats returns response times per request command.
+	Stats() []ResponseStats
+	// Binds returns status of every bind opened for the session.
+	Binds() []BindStatus
+	State() SessionState
 	Close() error
 }
 
+type SessionState int
+
+const (
+	StateConnecting SessionState = iota + 1
+	StateBound
+	StateUnbinding
+	StateClosed
+	StateReconnecting
+)
+
+func (s SessionState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateBound:
+		return "bound"
+	case StateUnbinding:
+		return "unbinding"
+	case StateClosed:
+		return "closed"
+	case StateReconnecting:
+		return "reconnecting"
+	default:
+		return fmt.Sprintf("SessionState(%d)", s)
+	}
+}
+
+type BindStatus struct {
+	State    SessionState
+	Sent     int
+	Received int
+	InFlight int
+	Window   int
+	// Endpoint is the SMSC endpoint of the last successful bind.
+	Endpoint string
+	// ReceiverDown is set while the receiver of a paired bind is
+	// reconnecting. The bind keeps sending over its transmitter.
+	ReceiverDown bool
+}
+
 type Direction int
 
 const (
@@ -461,11 +666,93 @@ type PDUHandler func(Direction, PDU)
 
 type CloseHandler func(err error)
 
+type ReconnectState int
+
+const (
+	Reconnecting ReconnectState = iota + 1
+	Reconnected
+)
+
+func (s ReconnectState) String() string {
+	switch s {
+	case Reconnecting:
+		return "Reconnecting"
+	case Reconnected:
+		return "Reconnected"
+	default:
+		return fmt.Sprintf("ReconnectState(%d)", s)
+	}
+}
+
+type ReconnectEvent struct {
+	// Bind is the number of the bind starting from 1 if the session has
+	// several binds, zero otherwise.
+	Bind        int
+	State       ReconnectState
+	Attempt     int
+	MaxAttempts int
+	Delay       time.Duration
+	Err         error
+	// Endpoint is set once reconnected.
+	Endpoint string
+	// ReceiveOnly is set for events of the receiver of a paired bind, which
+	// don't affect sending.
+	ReceiveOnly bool
+}
+
+type ReconnectHandler func(ReconnectEvent)
+
+// StateHandler is called on every session state change, in the order of
+// changes. It must not block.
+type StateHandler func(SessionState)
+
+type DiagnosticStage int
+
+const (
+	StageResolve DiagnosticStage = iota + 1
+	StageConnect
+	StageTLS
+	StageBind
+	StageUnbind
+)
+
+func (s DiagnosticStage) String() string {
+	switch s {
+	case StageResolve:
+		return "DNS resolution"
+	case StageConnect:
+		return "TCP connect"
+	case StageTLS:
+		return "TLS handshake"
+	case StageBind:
+		return "Bind"
+	case StageUnbind:
+		return "Unbind"
+	default:
+		return fmt.Sprintf("DiagnosticStage(%d)", s)
+	}
+}
+
+// DiagnosticStep is the result of a single stage of connection test. Stages
+// following the failed one are not run.
+type DiagnosticStep struct {
+	Endpoint string
+	Stage    DiagnosticStage
+	Duration time.Duration
+	Details  []string
+	Err      error
+}
+
 type Sender interface {
 	SupportedCodings() []coding.Coding
 	StartSession(
 		acc *account.Account,
 		handler PDUHandler,
 		onClose CloseHandler,
+		onReconnect ReconnectHandler,
+		onState StateHandler,
 	) (Session, error)
+	// Diagnose tests connection to every endpoint of acc stage by stage,
+	// from DNS resolution up to bind and unbind.
+	Diagnose(acc *account.Account) []DiagnosticStep
 }
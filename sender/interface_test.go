@@ -0,0 +1,46 @@
+package sender
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSendResultFailed(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []SegmentResult
+		want     int
+	}{
+		{name: "none", want: 0},
+		{name: "accepted", segments: []SegmentResult{{Status: ESME_ROK}, {Status: ESME_ROK}}, want: 0},
+		{
+			name:     "rejected and no response",
+			segments: []SegmentResult{{Status: ESME_ROK}, {Status: ESME_RTHROTTLED}, {Err: errors.New("No response")}},
+			want:     2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (SendResult{Segments: tt.segments}).Failed(); got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandNames(t *testing.T) {
+	// Commands are looked up by name, e.g. by the -command flag of listen.
+	seen := make(map[string]Command)
+	for cmd := BindTransceiver; cmd <= GenericNack; cmd++ {
+		name := cmd.String()
+		if prev, ok := seen[name]; ok {
+			t.Fatalf("commands %d and %d are both named %s", prev, cmd, name)
+		}
+		if strings.HasPrefix(name, "Command(") {
+			t.Fatalf("command %d has no name", cmd)
+		}
+		seen[name] = cmd
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"smppizdez/account"
+	"smppizdez/glade"
+	"smppizdez/sender"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+type sessionsContext struct {
+	sender   sender.Sender
+	notebook *gtk.Notebook
+}
+
+func initSessionsNotebook(builder *gtk.Builder, s sender.Sender) {
+	ctx := &sessionsContext{
+		sender:   s,
+		notebook: getNotebookById(builder, "sessions_notebook"),
+	}
+	submitSmStartSessionCallback = ctx.openSession
+}
+
+// openSession binds the account in a new tab with its own submit form and
+// logs, leaving sessions in other tabs untouched. The tab is added once
+// bound.
+func (ctx *sessionsContext) openSession(acc *account.Account) {
+	builder, err := gtk.BuilderNewFromString(glade.SessionSource)
+	if err != nil {
+		errorDialog("Failed to initialize GTK builder: %v", err)
+		return
+	}
+
+	page := getBoxById(builder, "session_page")
+	form := initSubmitSmForm(builder, ctx.sender)
+	title := fmt.Sprintf("%s@%s:%d", acc.SystemID, acc.Host, acc.Port)
+	form.startSession(acc, func(err error) {
+		if err != nil {
+			form.close()
+			errorDialog("Failed to start SMPP session: %v", err)
+			return
+		}
+		ctx.addTab(page, form, title)
+	})
+}
+
+func (ctx *sessionsContext) addTab(page *gtk.Box, form *submitSmContext, title string) {
+	tab, err := ctx.newTabLabel(title, func() {
+		form.close()
+		ctx.notebook.RemovePage(ctx.notebook.PageNum(page))
+	})
+	if err != nil {
+		form.close()
+		errorDialog("Failed to create session tab: %v", err)
+		return
+	}
+
+	idx := ctx.notebook.AppendPage(page, tab)
+	ctx.notebook.SetTabReorderable(page, true)
+	ctx.notebook.SetCurrentPage(idx)
+}
+
+func (ctx *sessionsContext) newTabLabel(title string, onClose func()) (*gtk.Box, error) {
+	box, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	label, err := gtk.LabelNew(title)
+	if err != nil {
+		return nil, err
+	}
+
+	closeBtn, err := gtk.ButtonNewFromIconName("window-close-symbolic", gtk.ICON_SIZE_MENU)
+	if err != nil {
+		return nil, err
+	}
+	closeBtn.SetRelief(gtk.RELIEF_NONE)
+	closeBtn.SetTooltipText("Unbind and close")
+	closeBtn.Connect("clicked", onClose)
+
+	box.PackStart(label, true, true, 0)
+	box.PackStart(closeBtn, false, false, 0)
+	box.ShowAll()
+	return box, nil
+}
@@ -0,0 +1,243 @@
+package smpp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"smppizdez/account"
+	"smppizdez/sender"
+	"strconv"
+	"time"
+
+	"github.com/linxGnu/gosmpp"
+	"github.com/linxGnu/gosmpp/pdu"
+)
+
+const defaultDiagnosticTimeout = 10 * time.Second
+
+func (s Sender) Diagnose(acc *account.Account) []sender.DiagnosticStep {
+	timeout := getTiming(acc).BindTimeout
+	if timeout <= 0 {
+		timeout = defaultDiagnosticTimeout
+	}
+
+	var tlsConfig *tls.Config
+	if acc.TLS {
+		var err error
+		tlsConfig, err = newTLSConfig(acc.TLSSettings)
+		if err != nil {
+			return []sender.DiagnosticStep{{Stage: sender.StageTLS, Err: err}}
+		}
+	}
+
+	var steps []sender.DiagnosticStep
+	for _, ep := range acc.Endpoints() {
+		d := diagnosis{
+			acc:       acc,
+			endpoint:  ep,
+			tlsConfig: tlsConfig,
+			timeout:   timeout,
+		}
+		d.run()
+		steps = append(steps, d.steps...)
+	}
+	return steps
+}
+
+type diagnosis struct {
+	acc       *account.Account
+	endpoint  account.Endpoint
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	steps     []sender.DiagnosticStep
+}
+
+// stage runs f and records its timing and result. It returns false if the
+// stage failed.
+func (d *diagnosis) stage(stage sender.DiagnosticStage, f func() ([]string, error)) bool {
+	start := time.Now()
+	details, err := f()
+	d.steps = append(d.steps, sender.DiagnosticStep{
+		Endpoint: d.endpoint.String(),
+		Stage:    stage,
+		Duration: time.Since(start),
+		Details:  details,
+		Err:      err,
+	})
+	return err == nil
+}
+
+func (d *diagnosis) run() {
+	var addrs []string
+	ok := d.stage(sender.StageResolve, func() ([]string, error) {
+		if d.acc.Proxy.Type != 0 {
+			addrs = []string{d.endpoint.Host}
+			return []string{"Resolved by proxy"}, nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+		defer cancel()
+
+		var err error
+		addrs, err = net.DefaultResolver.LookupHost(ctx, d.endpoint.Host)
+		return addrs, err
+	})
+	if !ok {
+		return
+	}
+
+	var conn net.Conn
+	ok = d.stage(sender.StageConnect, func() ([]string, error) {
+		dial := proxyDialer(d.acc.Proxy, d.timeout)
+		var errs []error
+		for _, addr := range addrs {
+			addr = net.JoinHostPort(addr, strconv.Itoa(int(d.endpoint.Port)))
+			c, err := dial(addr)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			conn = c
+			if d.acc.Proxy.Type != 0 {
+				return []string{fmt.Sprintf(
+					"Connected to %s via %v proxy %s",
+					addr,
+					d.acc.Proxy.Type,
+					d.acc.Proxy.Address(),
+				)}, nil
+			}
+			return []string{fmt.Sprintf("Connected to %s", addr)}, nil
+		}
+		return nil, errors.Join(errs...)
+	})
+	if !ok {
+		return
+	}
+	defer func() { conn.Close() }()
+
+	if d.tlsConfig != nil {
+		ok = d.stage(sender.StageTLS, func() ([]string, error) {
+			cfg := d.tlsConfig.Clone()
+			if cfg.ServerName == "" {
+				cfg.ServerName = d.endpoint.Host
+			}
+
+			tlsConn := tls.Client(conn, cfg)
+			tlsConn.SetDeadline(time.Now().Add(d.timeout))
+			if err := tlsConn.Handshake(); err != nil {
+				return nil, err
+			}
+			conn = tlsConn
+			return describeTLS(tlsConn.ConnectionState()), nil
+		})
+		if !ok {
+			return
+		}
+	}
+
+	smppConn := gosmpp.NewConnection(conn)
+	ok = d.stage(sender.StageBind, func() ([]string, error) {
+		return d.bind(smppConn)
+	})
+	if !ok {
+		return
+	}
+
+	d.stage(sender.StageUnbind, func() ([]string, error) {
+		_, err := d.roundTrip(smppConn, pdu.NewUnbind())
+		return nil, err
+	})
+}
+
+func (d *diagnosis) bind(conn *gosmpp.Connection) ([]string, error) {
+	var bindType pdu.BindingType
+	var details []string
+	switch d.acc.BindType {
+	case account.Transceiver:
+		bindType = pdu.Transceiver
+	case account.Receiver:
+		bindType = pdu.Receiver
+	case account.TransmitterReceiver:
+		bindType = pdu.Transmitter
+		details = append(details, "Only transmitter bind of the pair is tested")
+	default:
+		bindType = pdu.Transmitter
+	}
+
+	req := pdu.NewBindRequest(bindType)
+	req.SystemID = d.acc.SystemID
+	req.Password = d.acc.Password
+	req.SystemType = d.acc.SystemType
+
+	resp, err := d.roundTrip(conn, req)
+	if err != nil {
+		return details, err
+	}
+
+	if bindResp, ok := resp.(*pdu.BindResp); ok {
+		details = append(details, fmt.Sprintf("SMSC system ID: %s", bindResp.SystemID))
+	}
+	return details, nil
+}
+
+// roundTrip sends req and waits for its response, skipping other PDUs. The
+// response must have ESME_ROK status.
+func (d *diagnosis) roundTrip(conn *gosmpp.Connection, req pdu.PDU) (pdu.PDU, error) {
+	err := conn.SetDeadline(time.Now().Add(d.timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.WritePDU(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		resp, err := pdu.Parse(conn)
+		if err != nil {
+			return nil, err
+		}
+		if resp.GetSequenceNumber() != req.GetSequenceNumber() ||
+			!isResponse(resp.GetHeader().CommandID) {
+			continue
+		}
+
+		hdr, ok := getPduHeader(resp)
+		if !ok {
+			return nil, fmt.Errorf("unexpected response %v", resp.GetHeader().CommandID)
+		}
+		if hdr.Status != sender.ESME_ROK {
+			return nil, fmt.Errorf("%v: %v", hdr.Command, hdr.Status)
+		}
+		return resp, nil
+	}
+}
+
+func describeTLS(state tls.ConnectionState) []string {
+	details := []string{
+		fmt.Sprintf("Version: %s", tls.VersionName(state.Version)),
+		fmt.Sprintf("Cipher: %s", tls.CipherSuiteName(state.CipherSuite)),
+	}
+
+	now := time.Now()
+	for i, cert := range state.PeerCertificates {
+		days := int(cert.NotAfter.Sub(now).Hours() / 24)
+		expiry := fmt.Sprintf("expires %s (in %d days)", cert.NotAfter.Format(time.DateOnly), days)
+		if now.After(cert.NotAfter) {
+			expiry = fmt.Sprintf("expired %s", cert.NotAfter.Format(time.DateOnly))
+		}
+
+		details = append(details, fmt.Sprintf(
+			"Certificate %d: %s, issued by %s, %s",
+			i,
+			cert.Subject,
+			cert.Issuer,
+			expiry,
+		))
+	}
+	return details
+}
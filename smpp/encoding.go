@@ -1,30 +1,87 @@
 package smpp
 
 import (
+	"container/list"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"slices"
 	"smppizdez/coding"
 	"smppizdez/sender"
+	"sync"
 	"sync/atomic"
 
 	"github.com/linxGnu/gosmpp/data"
 	"github.com/linxGnu/gosmpp/pdu"
 )
 
-var MessageTooLong = errors.New("Message is too long")
+var (
+	MessageTooLong       = errors.New("Message is too long")
+	BinaryCodingRequired = errors.New("Binary message requires Octet1 or Octet2 effective coding")
+	UDHTooLong           = errors.New("User data header is too long")
+	RefOutOfRange        = errors.New("8-bit concatenation reference must be less than 256")
+	PortOutOfRange       = errors.New("8-bit application port must be less than 256")
+)
 
 var supportedCodings = map[coding.Coding]encoding{
-	coding.GSM7: data.GSM7BITPACKED.(encoding),
-	coding.GSM8: gsm8{},
-	coding.UCS2: ucs2f{},
+	coding.GSM7:   data.GSM7BITPACKED.(encoding),
+	coding.GSM8:   gsm8{},
+	coding.Octet1: octet{dataCoding: data.BINARY8BIT1Coding},
+	coding.Octet2: octet{dataCoding: data.BINARY8BIT2Coding},
+	coding.UCS2:   ucs2f{},
 }
 
 var ref uint32
 
+// maxRefDestinations bounds the number of destinations whose references are
+// counted apart. Past it the least recently used destination is forgotten and
+// its references start over.
+const maxRefDestinations = 10000
+
+// refCounter counts concatenation references per destination. It is shared
+// by all binds of a session.
+type refCounter struct {
+	mu    sync.Mutex
+	refs  map[sender.Address]*list.Element
+	order *list.List
+}
+
+type destRef struct {
+	dest sender.Address
+	ref  uint32
+}
+
+func newRefCounter() *refCounter {
+	return &refCounter{refs: make(map[sender.Address]*list.Element), order: list.New()}
+}
+
+func (c *refCounter) next(dest sender.Address) uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.refs[dest]; ok {
+		c.order.MoveToFront(e)
+		r := e.Value.(*destRef)
+		r.ref++
+		return r.ref
+	}
+
+	if c.order.Len() >= maxRefDestinations {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.refs, oldest.Value.(*destRef).dest)
+	}
+	c.refs[dest] = c.order.PushFront(&destRef{dest: dest, ref: 1})
+	return 1
+}
+
+const maxSegments = 255
+
 const (
-	udhSize     = 6
-	maxSegments = 255
+	ieiConcat8Bit  byte = 0x00
+	ieiPorts8Bit   byte = 0x04
+	ieiPorts16Bit  byte = 0x05
+	ieiConcat16Bit byte = 0x08
 )
 
 const (
@@ -72,8 +129,13 @@ type segment struct {
 	seq   byte
 }
 
-func getSegments(req *sender.Request) ([]segment, error) {
-	messages, enc, err := getSegmentMessages(req)
+func getSegments(req *sender.Request, refs *refCounter) ([]segment, error) {
+	udh, err := getUDH(req)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, enc, err := getSegmentMessages(req, udh)
 	if err != nil {
 		return nil, err
 	}
@@ -85,12 +147,27 @@ func getSegments(req *sender.Request) ([]segment, error) {
 
 	if len(messages) == 1 {
 		if req.SplitMode == sender.SplitMessagePayload {
+			payload := messages[0]
+			if len(udh) > 0 {
+				udhData, err := udh.MarshalBinary()
+				if err != nil {
+					return nil, err
+				}
+				payload = append(udhData, payload...)
+				pd.EsmClass |= data.SM_UDH_GSM
+			}
+
 			messagePayload := pdu.Field{
 				Tag:  pdu.TagMessagePayload,
-				Data: messages[0],
+				Data: payload,
 			}
 			pd.RegisterOptionalParam(messagePayload)
+			err = pd.Message.SetMessageDataWithEncoding([]byte{}, enc)
+			if err != nil {
+				return nil, err
+			}
 		} else {
+			setUDH(pd, udh)
 			err = pd.Message.SetMessageDataWithEncoding(messages[0], enc)
 			if err != nil {
 				return nil, err
@@ -102,27 +179,71 @@ func getSegments(req *sender.Request) ([]segment, error) {
 		return segments, nil
 	}
 
+	curRef, err := nextRef(req, refs)
+	if err != nil {
+		return nil, err
+	}
+
 	if req.SplitMode == sender.SplitUDH {
-		return getSegmentsUDH(pd, messages, enc)
+		return getSegmentsUDH(pd, udh, req.ConcatIE, curRef, messages, enc)
 	} else {
-		return getSegmentsSAR(pd, messages, enc)
+		return getSegmentsSAR(pd, udh, curRef, messages, enc)
 	}
 }
 
-func getSegmentsUDH(orig *pdu.SubmitSM, messages [][]byte, enc encoding) ([]segment, error) {
+func nextRef(req *sender.Request, refs *refCounter) (uint16, error) {
+	var curRef uint32
+	switch req.RefMode {
+	case sender.RefExplicit:
+		if req.SplitMode == sender.SplitUDH && req.ConcatIE != sender.Concat16Bit &&
+			req.Ref > 0xff {
+			return 0, RefOutOfRange
+		}
+		return req.Ref, nil
+	case sender.RefPerDestination:
+		curRef = refs.next(req.Destination)
+	default:
+		curRef = atomic.AddUint32(&ref, 1)
+	}
+
+	if req.SplitMode == sender.SplitUDH && req.ConcatIE != sender.Concat16Bit {
+		return uint16(byte(curRef)), nil
+	}
+	return uint16(curRef), nil
+}
+
+func newConcatIE(typ sender.ConcatIE, curRef uint16, total, seq byte) pdu.InfoElement {
+	if typ == sender.Concat16Bit {
+		return pdu.InfoElement{
+			ID:   ieiConcat16Bit,
+			Data: []byte{byte(curRef >> 8), byte(curRef), total, seq},
+		}
+	}
+	return pdu.InfoElement{
+		ID:   ieiConcat8Bit,
+		Data: []byte{byte(curRef), total, seq},
+	}
+}
+
+func getSegmentsUDH(
+	orig *pdu.SubmitSM,
+	udh pdu.UDH,
+	concatIE sender.ConcatIE,
+	curRef uint16,
+	messages [][]byte,
+	enc encoding,
+) ([]segment, error) {
 	total := byte(len(messages))
-	curRef := byte(atomic.AddUint32(&ref, 1))
 	seq := byte(1)
 
 	segments := make([]segment, 0, len(messages))
 	for _, message := range messages {
-		udh := pdu.NewIEConcatMessage(total, seq, curRef)
+		concat := newConcatIE(concatIE, curRef, total, seq)
 		pd := new(pdu.SubmitSM)
 		*pd = *orig
-		pd.EsmClass |= data.SM_UDH_GSM
 
 		pd.AssignSequenceNumber()
-		pd.Message.SetUDH([]pdu.InfoElement{udh})
+		setUDH(pd, append(slices.Clip(udh), concat))
 		err := pd.Message.SetMessageDataWithEncoding(message, enc)
 		if err != nil {
 			return nil, err
@@ -130,7 +251,7 @@ func getSegmentsUDH(orig *pdu.SubmitSM, messages [][]byte, enc encoding) ([]segm
 
 		seg := segment{
 			pd:    pd,
-			ref:   uint16(curRef),
+			ref:   curRef,
 			total: total,
 			seq:   seq,
 		}
@@ -142,9 +263,14 @@ func getSegmentsUDH(orig *pdu.SubmitSM, messages [][]byte, enc encoding) ([]segm
 	return segments, nil
 }
 
-func getSegmentsSAR(orig *pdu.SubmitSM, messages [][]byte, enc encoding) ([]segment, error) {
+func getSegmentsSAR(
+	orig *pdu.SubmitSM,
+	udh pdu.UDH,
+	curRef uint16,
+	messages [][]byte,
+	enc encoding,
+) ([]segment, error) {
 	var refData [2]byte
-	curRef := uint16(atomic.AddUint32(&ref, 1))
 	binary.BigEndian.PutUint16(refData[:], curRef)
 	refTLV := pdu.Field{
 		Tag:  pdu.TagSarMsgRefNum,
@@ -175,6 +301,7 @@ func getSegmentsSAR(orig *pdu.SubmitSM, messages [][]byte, enc encoding) ([]segm
 		pd.RegisterOptionalParam(totalTLV)
 		pd.RegisterOptionalParam(seqTLV)
 
+		setUDH(pd, udh)
 		err := pd.Message.SetMessageDataWithEncoding(message, enc)
 		if err != nil {
 			return nil, err
@@ -194,6 +321,45 @@ func getSegmentsSAR(orig *pdu.SubmitSM, messages [][]byte, enc encoding) ([]segm
 	return segments, nil
 }
 
+func getUDH(req *sender.Request) (pdu.UDH, error) {
+	var udh pdu.UDH
+
+	ports := req.Ports
+	switch ports.Addressing {
+	case sender.Ports8Bit:
+		if ports.Source > 0xff || ports.Destination > 0xff {
+			return nil, PortOutOfRange
+		}
+		udh = append(udh, pdu.InfoElement{
+			ID:   ieiPorts8Bit,
+			Data: []byte{byte(ports.Destination), byte(ports.Source)},
+		})
+	case sender.Ports16Bit:
+		portsData := make([]byte, 4)
+		binary.BigEndian.PutUint16(portsData[0:], ports.Destination)
+		binary.BigEndian.PutUint16(portsData[2:], ports.Source)
+		udh = append(udh, pdu.InfoElement{ID: ieiPorts16Bit, Data: portsData})
+	}
+
+	for _, ie := range req.InfoElements {
+		udh = append(udh, pdu.InfoElement{ID: ie.ID, Data: ie.Value})
+	}
+
+	if udh.UDHL() < 0 {
+		return nil, UDHTooLong
+	}
+
+	return udh, nil
+}
+
+func setUDH(pd *pdu.SubmitSM, udh pdu.UDH) {
+	if len(udh) == 0 {
+		return
+	}
+	pd.EsmClass |= data.SM_UDH_GSM
+	pd.Message.SetUDH(udh)
+}
+
 func submitSmFromRequest(req *sender.Request) (*pdu.SubmitSM, error) {
 	var err error
 
@@ -233,22 +399,31 @@ func submitSmFromRequest(req *sender.Request) (*pdu.SubmitSM, error) {
 	return pd, nil
 }
 
-func getSegmentMessages(req *sender.Request) ([][]byte, encoding, error) {
+func getSegmentMessages(req *sender.Request, udh pdu.UDH) ([][]byte, encoding, error) {
 	var enc encoding
 	effEnc, err := getCoding(req.EffectiveCoding)
 	if err != nil {
 		return nil, nil, err
 	}
-	decByte, err := getCodingByte(req.DeceptiveCoding)
-	if err != nil {
+	if req.OverrideDataCoding {
+		enc = deceptiveEncoding{deceptive: req.DataCoding, effective: effEnc}
+	} else if decByte, err := getCodingByte(req.DeceptiveCoding); err != nil {
 		enc = effEnc
 	} else {
 		enc = deceptiveEncoding{deceptive: decByte, effective: effEnc}
 	}
 
+	message := req.Message
+	if req.IsBinary {
+		if _, ok := effEnc.(octet); !ok {
+			return nil, nil, BinaryCodingRequired
+		}
+		message = string(req.BinaryMessage)
+	}
+
 	var messages [][]byte
 	if req.SplitMode == sender.SplitMessagePayload {
-		msg, err := enc.Encode(req.Message)
+		msg, err := enc.Encode(message)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -260,24 +435,32 @@ func getSegmentMessages(req *sender.Request) ([][]byte, encoding, error) {
 		}
 
 		return messages, enc, nil
-	} else if enc.ShouldSplit(req.Message, uint(req.BytePerSegment)) {
+	}
+
+	// Every segment needs room for at least one byte of the message.
+	bytesPerSegment := req.BytePerSegment - udh.UDHL()
+	if len(udh) > 0 && bytesPerSegment < 1 {
+		return nil, nil, UDHTooLong
+	}
+	if enc.ShouldSplit(message, uint(bytesPerSegment)) {
 		var bytesPerMultiSegment uint
 		switch req.SplitMode {
 		case sender.SplitUDH:
-			if req.BytePerSegment < udhSize+1 {
-				bytesPerMultiSegment = udhSize + 1
-			} else {
-				bytesPerMultiSegment = uint(req.BytePerSegment - udhSize)
+			concat := newConcatIE(req.ConcatIE, 0, 0, 0)
+			udhSize := pdu.UDH(append(slices.Clip(udh), concat)).UDHL()
+			if udhSize < 0 || req.BytePerSegment < udhSize+1 {
+				return nil, nil, UDHTooLong
 			}
+			bytesPerMultiSegment = uint(req.BytePerSegment - udhSize)
 		case sender.SplitNone:
 			return nil, nil, MessageTooLong
 		default:
-			bytesPerMultiSegment = uint(req.BytePerSegment)
+			bytesPerMultiSegment = uint(bytesPerSegment)
 		}
 
-		messages, err = enc.EncodeSplit(req.Message, bytesPerMultiSegment)
+		messages, err = enc.EncodeSplit(message, bytesPerMultiSegment)
 	} else {
-		msg, err := enc.Encode(req.Message)
+		msg, err := enc.Encode(message)
 		if err == nil {
 			messages = make([][]byte, 1)
 			messages[0] = msg
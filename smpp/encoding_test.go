@@ -0,0 +1,263 @@
+package smpp
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"smppizdez/coding"
+	"smppizdez/sender"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/linxGnu/gosmpp/pdu"
+)
+
+func TestGetUDH(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports sender.ApplicationPorts
+		ies   []sender.InfoElement
+		want  pdu.UDH
+		err   error
+	}{
+		{
+			name:  "none",
+			ports: sender.ApplicationPorts{Addressing: sender.PortsNone},
+		},
+		{
+			name:  "8-bit ports",
+			ports: sender.ApplicationPorts{Addressing: sender.Ports8Bit, Source: 0x10, Destination: 0xf0},
+			want:  pdu.UDH{{ID: ieiPorts8Bit, Data: []byte{0xf0, 0x10}}},
+		},
+		{
+			name:  "8-bit port out of range",
+			ports: sender.ApplicationPorts{Addressing: sender.Ports8Bit, Source: 0x100},
+			err:   PortOutOfRange,
+		},
+		{
+			name:  "16-bit ports",
+			ports: sender.ApplicationPorts{Addressing: sender.Ports16Bit, Source: 0x1234, Destination: 0x5678},
+			want:  pdu.UDH{{ID: ieiPorts16Bit, Data: []byte{0x56, 0x78, 0x12, 0x34}}},
+		},
+		{
+			name:  "custom after ports",
+			ports: sender.ApplicationPorts{Addressing: sender.Ports16Bit, Source: 1, Destination: 2},
+			ies:   []sender.InfoElement{{ID: 0x24, Value: []byte{1}}, {ID: 0x25, Value: nil}},
+			want: pdu.UDH{
+				{ID: ieiPorts16Bit, Data: []byte{0, 2, 0, 1}},
+				{ID: 0x24, Data: []byte{1}},
+				{ID: 0x25, Data: nil},
+			},
+		},
+		{
+			name:  "too long",
+			ports: sender.ApplicationPorts{Addressing: sender.PortsNone},
+			ies:   []sender.InfoElement{{ID: 0x24, Value: make([]byte, 200)}, {ID: 0x25, Value: make([]byte, 100)}},
+			err:   UDHTooLong,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			udh, err := getUDH(&sender.Request{Ports: tt.ports, InfoElements: tt.ies})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if !slices.EqualFunc(udh, tt.want, func(a, b pdu.InfoElement) bool {
+				return a.ID == b.ID && bytes.Equal(a.Data, b.Data)
+			}) {
+				t.Fatalf("got %v, want %v", udh, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextRef(t *testing.T) {
+	tests := []struct {
+		name     string
+		split    sender.SplitMode
+		concatIE sender.ConcatIE
+		ref      uint16
+		want     uint16
+		err      error
+	}{
+		{name: "8-bit", split: sender.SplitUDH, concatIE: sender.Concat8Bit, ref: 0xff, want: 0xff},
+		{name: "8-bit out of range", split: sender.SplitUDH, concatIE: sender.Concat8Bit, ref: 0x100, err: RefOutOfRange},
+		{name: "16-bit", split: sender.SplitUDH, concatIE: sender.Concat16Bit, ref: 0x1234, want: 0x1234},
+		{name: "SAR", split: sender.SplitSAR, concatIE: sender.Concat8Bit, ref: 0x1234, want: 0x1234},
+	}
+
+	for _, tt := range tests {
+		t.Run("explicit "+tt.name, func(t *testing.T) {
+			req := &sender.Request{SplitMode: tt.split, ConcatIE: tt.concatIE, RefMode: sender.RefExplicit, Ref: tt.ref}
+			got, err := nextRef(req, newRefCounter())
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Fatalf("got (%#x, %v), want (%#x, %v)", got, err, tt.want, tt.err)
+			}
+		})
+	}
+
+	t.Run("per destination", func(t *testing.T) {
+		req := func(ton sender.TON, addr string) *sender.Request {
+			return &sender.Request{
+				Destination: sender.Address{TON: ton, Addr: addr},
+				SplitMode:   sender.SplitUDH,
+				ConcatIE:    sender.Concat16Bit,
+				RefMode:     sender.RefPerDestination,
+			}
+		}
+		refs := newRefCounter()
+		a1, _ := nextRef(req(sender.TONInternational, "1"), refs)
+		b1, _ := nextRef(req(sender.TONInternational, "2"), refs)
+		a2, _ := nextRef(req(sender.TONInternational, "1"), refs)
+		a3, _ := nextRef(req(sender.TONInternational, "1"), refs)
+		b2, _ := nextRef(req(sender.TONInternational, "2"), refs)
+		// Refs of a destination are counted apart from others, including
+		// the same digits with another TON.
+		c1, _ := nextRef(req(sender.TONNational, "1"), refs)
+		if a1 != 1 || a2 != 2 || a3 != 3 || b1 != 1 || b2 != 2 || c1 != 1 {
+			t.Fatalf("got refs %d, %d, %d to a, %d, %d to b and %d to c", a1, a2, a3, b1, b2, c1)
+		}
+
+		// Other sessions count on their own.
+		if got, _ := nextRef(req(sender.TONInternational, "1"), newRefCounter()); got != 1 {
+			t.Fatalf("got ref %d in a new session, want 1", got)
+		}
+	})
+
+	t.Run("per destination forgets least recently used", func(t *testing.T) {
+		refs := newRefCounter()
+		dest := func(i int) sender.Address { return sender.Address{Addr: strconv.Itoa(i)} }
+		for i := range maxRefDestinations {
+			refs.next(dest(i))
+		}
+		// Destination 0 is used again, so 1 is the least recently used one.
+		if got := refs.next(dest(0)); got != 2 {
+			t.Fatalf("got ref %d to a known destination, want 2", got)
+		}
+		refs.next(dest(maxRefDestinations))
+		if n := len(refs.refs); n != maxRefDestinations {
+			t.Fatalf("%d destinations counted, want %d", n, maxRefDestinations)
+		}
+		if got := refs.next(dest(1)); got != 1 {
+			t.Fatalf("got ref %d to a forgotten destination, want 1", got)
+		}
+		if got := refs.next(dest(0)); got != 3 {
+			t.Fatalf("got ref %d to a recently used destination, want 3", got)
+		}
+	})
+
+	t.Run("auto 8-bit wraps", func(t *testing.T) {
+		req := &sender.Request{SplitMode: sender.SplitUDH, ConcatIE: sender.Concat8Bit, RefMode: sender.RefAuto}
+		for range 300 {
+			if got, _ := nextRef(req, newRefCounter()); got > 0xff {
+				t.Fatalf("got 8-bit ref %#x", got)
+			}
+		}
+	})
+}
+
+func TestGetSegmentMessages(t *testing.T) {
+	ports8 := sender.ApplicationPorts{Addressing: sender.Ports8Bit, Source: 1, Destination: 2}
+	noPorts := sender.ApplicationPorts{Addressing: sender.PortsNone}
+
+	tests := []struct {
+		name     string
+		split    sender.SplitMode
+		concatIE sender.ConcatIE
+		ports    sender.ApplicationPorts
+		ies      []sender.InfoElement
+		segBytes int
+		size     int
+		// want is the length of each segment.
+		want []int
+		err  error
+	}{
+		{name: "single", split: sender.SplitUDH, concatIE: sender.Concat8Bit, ports: noPorts, segBytes: 140, size: 140, want: []int{140}},
+		{name: "8-bit concat", split: sender.SplitUDH, concatIE: sender.Concat8Bit, ports: noPorts, segBytes: 140, size: 141, want: []int{134, 7}},
+		{name: "16-bit concat", split: sender.SplitUDH, concatIE: sender.Concat16Bit, ports: noPorts, segBytes: 140, size: 141, want: []int{133, 8}},
+		// Ports take 5 bytes of every segment including the single one.
+		{name: "ports single", split: sender.SplitUDH, concatIE: sender.Concat8Bit, ports: ports8, segBytes: 140, size: 135, want: []int{135}},
+		{name: "ports and concat", split: sender.SplitUDH, concatIE: sender.Concat8Bit, ports: ports8, segBytes: 140, size: 136, want: []int{130, 6}},
+		{
+			name:     "custom IE and 16-bit concat",
+			split:    sender.SplitUDH,
+			concatIE: sender.Concat16Bit,
+			ports:    noPorts,
+			ies:      []sender.InfoElement{{ID: 0x24, Value: []byte{1, 2}}},
+			segBytes: 140,
+			size:     200,
+			want:     []int{129, 71},
+		},
+		{name: "SAR", split: sender.SplitSAR, concatIE: sender.Concat8Bit, ports: noPorts, segBytes: 140, size: 141, want: []int{140, 1}},
+		{name: "SAR with ports", split: sender.SplitSAR, concatIE: sender.Concat8Bit, ports: ports8, segBytes: 140, size: 141, want: []int{135, 6}},
+		{name: "payload", split: sender.SplitMessagePayload, concatIE: sender.Concat8Bit, ports: noPorts, segBytes: 140, size: 1000, want: []int{1000}},
+		{name: "no split", split: sender.SplitNone, concatIE: sender.Concat8Bit, ports: noPorts, segBytes: 140, size: 141, err: MessageTooLong},
+		{name: "too many segments", split: sender.SplitUDH, concatIE: sender.Concat8Bit, ports: noPorts, segBytes: 140, size: 134*255 + 1, err: MessageTooLong},
+		// Ports and 8-bit concat take 10 bytes with the UDH length.
+		{name: "no room with concat", split: sender.SplitUDH, concatIE: sender.Concat8Bit, ports: ports8, segBytes: 10, size: 20, err: UDHTooLong},
+		{name: "no room in single", split: sender.SplitUDH, concatIE: sender.Concat8Bit, ports: ports8, segBytes: 5, size: 1, err: UDHTooLong},
+		{name: "no room with SAR", split: sender.SplitSAR, concatIE: sender.Concat8Bit, ports: ports8, segBytes: 5, size: 20, err: UDHTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &sender.Request{
+				IsBinary:        true,
+				BinaryMessage:   bytes.Repeat([]byte{'x'}, tt.size),
+				EffectiveCoding: coding.Octet1,
+				DeceptiveCoding: coding.Octet1,
+				SplitMode:       tt.split,
+				ConcatIE:        tt.concatIE,
+				BytePerSegment:  tt.segBytes,
+				Ports:           tt.ports,
+				InfoElements:    tt.ies,
+			}
+			udh, err := getUDH(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages, _, err := getSegmentMessages(req, udh)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			got := make([]int, len(messages))
+			for i, m := range messages {
+				got[i] = len(m)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got segments of %v bytes, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSegmentMessagesGSM7(t *testing.T) {
+	tests := []struct {
+		length int
+		want   int
+	}{
+		{length: 160, want: 1},
+		{length: 161, want: 2},
+		{length: 153 * 2, want: 2},
+		{length: 153*2 + 1, want: 3},
+	}
+
+	for _, tt := range tests {
+		req := testRequest(strings.Repeat("a", tt.length))
+		messages, _, err := getSegmentMessages(req, nil)
+		if err != nil || len(messages) != tt.want {
+			t.Errorf("%d characters: got %d segment(s) and error %v, want %d", tt.length, len(messages), err, tt.want)
+		}
+	}
+}
+
+func TestGetSegmentMessagesBinaryCoding(t *testing.T) {
+	req := testRequest("")
+	req.IsBinary = true
+	req.BinaryMessage = []byte{1}
+	if _, _, err := getSegmentMessages(req, nil); !errors.Is(err, BinaryCodingRequired) {
+		t.Fatalf("got %v, want %v", err, BinaryCodingRequired)
+	}
+}
@@ -0,0 +1,161 @@
+package smpp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"smppizdez/account"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/linxGnu/gosmpp"
+	"github.com/linxGnu/gosmpp/pdu"
+)
+
+// failoverConnector tries account endpoints in order until one of them is
+// bound. Every A/AAAA record of an endpoint is tried, starting from the next
+// one on each connect, so that load is spread across them.
+type failoverConnector struct {
+	endpoints []account.Endpoint
+	bindType  account.BindType
+	auth      gosmpp.Auth
+	// dialer returns the dialer for endpoint host, which TLS needs to
+	// verify the server name.
+	dialer  func(host string) gosmpp.Dialer
+	timeout time.Duration
+	// proxied skips local resolving, since the proxy resolves host names
+	// itself.
+	proxied bool
+
+	mu    sync.Mutex
+	next  []int
+	bound string
+}
+
+func newFailoverConnector(
+	endpoints []account.Endpoint,
+	bindType account.BindType,
+	auth gosmpp.Auth,
+	dialer func(host string) gosmpp.Dialer,
+	timeout time.Duration,
+) *failoverConnector {
+	return &failoverConnector{
+		endpoints: endpoints,
+		bindType:  bindType,
+		auth:      auth,
+		dialer:    dialer,
+		timeout:   timeout,
+		next:      make([]int, len(endpoints)),
+	}
+}
+
+func (c *failoverConnector) Connect() (*gosmpp.Connection, error) {
+	var errs []error
+	for i, ep := range c.endpoints {
+		addrs, err := c.resolve(i, ep.Host)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", ep, err))
+			continue
+		}
+
+		port := strconv.Itoa(int(ep.Port))
+		for _, addr := range addrs {
+			addr = net.JoinHostPort(addr, port)
+			conn, err := c.connect(ep.Host, addr)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", describeEndpoint(ep, addr), err))
+				continue
+			}
+
+			c.mu.Lock()
+			c.bound = describeEndpoint(ep, addr)
+			c.mu.Unlock()
+			return conn, nil
+		}
+	}
+
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, errors.Join(errs...)
+}
+
+// describeEndpoint adds resolved address to ep, unless it is an IP address
+// itself.
+func describeEndpoint(ep account.Endpoint, addr string) string {
+	if ep.String() == addr {
+		return addr
+	}
+	return fmt.Sprintf("%v (%s)", ep, addr)
+}
+
+// resolve returns addresses of host rotated by one on every call.
+func (c *failoverConnector) resolve(idx int, host string) ([]string, error) {
+	if c.proxied {
+		return []string{host}, nil
+	}
+
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	offset := c.next[idx] % len(addrs)
+	c.next[idx]++
+	c.mu.Unlock()
+
+	return slices.Concat(addrs[offset:], addrs[:offset]), nil
+}
+
+func (c *failoverConnector) connect(host string, addr string) (*gosmpp.Connection, error) {
+	auth := c.auth
+	auth.SMSC = addr
+
+	dialer := c.dialer(host)
+	if c.timeout > 0 {
+		dialer = withBindTimeout(dialer, c.timeout)
+	}
+
+	var connector gosmpp.Connector
+	switch c.bindType {
+	case account.Transceiver:
+		connector = gosmpp.TRXConnector(dialer, auth)
+	case account.Transmitter:
+		connector = gosmpp.TXConnector(dialer, auth)
+	default:
+		connector = gosmpp.RXConnector(dialer, auth)
+	}
+	if c.timeout > 0 {
+		connector = bindTimeoutConnector{Connector: connector, timeout: c.timeout}
+	}
+	return connector.Connect()
+}
+
+func (c *failoverConnector) GetBindType() pdu.BindingType {
+	switch c.bindType {
+	case account.Transceiver:
+		return pdu.Transceiver
+	case account.Transmitter:
+		return pdu.Transmitter
+	default:
+		return pdu.Receiver
+	}
+}
+
+// boundEndpoint returns the endpoint of the last successful bind.
+func (c *failoverConnector) boundEndpoint() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bound
+}
@@ -0,0 +1,179 @@
+package smpp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"smppizdez/sender"
+	"sync"
+	"time"
+
+	"github.com/linxGnu/gosmpp"
+	"github.com/linxGnu/gosmpp/pdu"
+)
+
+// bindTimeoutConnector limits the time spent on dialing and waiting for
+// bind_resp. The deadline is set by the dialer returned from
+// withBindTimeout and is cleared once the bind is complete, so that regular
+// read/write timeouts take over.
+type bindTimeoutConnector struct {
+	gosmpp.Connector
+	timeout time.Duration
+}
+
+func (c bindTimeoutConnector) Connect() (*gosmpp.Connection, error) {
+	conn, err := c.Connector.Connect()
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = fmt.Errorf("bind timed out after %v: %w", c.timeout, err)
+		}
+		return nil, err
+	}
+
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func withBindTimeout(dialer gosmpp.Dialer, timeout time.Duration) gosmpp.Dialer {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dialer(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		err = conn.SetDeadline(time.Now().Add(timeout))
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// keepAlive sends enquire_link requests over a single connection and
+// reports failure after threshold requests in a row were left unanswered.
+type keepAlive struct {
+	tr        gosmpp.Transmitter
+	tracker   *tracker
+	handler   sender.PDUHandler
+	interval  time.Duration
+	timeout   time.Duration
+	threshold int
+	onFail    func(error)
+	stop      chan struct{}
+
+	mu       sync.Mutex
+	pending  map[int32]struct{}
+	failures int
+}
+
+func newKeepAlive(
+	tr gosmpp.Transmitter,
+	tracker *tracker,
+	handler sender.PDUHandler,
+	interval time.Duration,
+	timeout time.Duration,
+	threshold int,
+	onFail func(error),
+) *keepAlive {
+	if timeout <= 0 {
+		timeout = interval
+	}
+
+	return &keepAlive{
+		tr:        tr,
+		tracker:   tracker,
+		handler:   handler,
+		interval:  interval,
+		timeout:   timeout,
+		threshold: threshold,
+		onFail:    onFail,
+		stop:      make(chan struct{}),
+		pending:   make(map[int32]struct{}),
+	}
+}
+
+func (k *keepAlive) run() {
+	ticker := time.NewTicker(k.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-ticker.C:
+			k.send()
+		}
+	}
+}
+
+func (k *keepAlive) close() {
+	close(k.stop)
+}
+
+func (k *keepAlive) send() {
+	p := pdu.NewEnquireLink()
+	seq := p.GetSequenceNumber()
+
+	k.mu.Lock()
+	k.pending[seq] = struct{}{}
+	k.mu.Unlock()
+	k.tracker.track(sender.EnquireLink, seq, time.Now())
+
+	// Submit errors are reported through OnSubmitError and close the
+	// connection on their own.
+	if err := k.tr.Submit(p); err != nil {
+		k.tracker.forget(seq)
+		k.mu.Lock()
+		delete(k.pending, seq)
+		k.mu.Unlock()
+		return
+	}
+	k.handler(sender.Outbound, &sender.GenericPDU{
+		Header: sender.Header{
+			Command:  sender.EnquireLink,
+			Status:   sender.ESME_ROK,
+			Sequence: uint32(seq),
+		},
+	})
+
+	time.AfterFunc(k.timeout, func() { k.expire(seq) })
+}
+
+func (k *keepAlive) ack(seq int32) {
+	k.mu.Lock()
+	delete(k.pending, seq)
+	k.failures = 0
+	k.mu.Unlock()
+}
+
+func (k *keepAlive) expire(seq int32) {
+	k.mu.Lock()
+	if _, ok := k.pending[seq]; !ok {
+		k.mu.Unlock()
+		return
+	}
+	delete(k.pending, seq)
+	k.failures++
+	failures := k.failures
+	k.mu.Unlock()
+
+	select {
+	case <-k.stop:
+		return
+	default:
+	}
+
+	if k.threshold > 0 && failures == k.threshold {
+		k.onFail(fmt.Errorf(
+			"%d enquire_link request(s) in a row left without response within %v",
+			failures,
+			k.timeout,
+		))
+	}
+}
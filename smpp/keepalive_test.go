@@ -0,0 +1,58 @@
+package smpp
+
+import (
+	"smppizdez/sender"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveReportsEnquireLink(t *testing.T) {
+	smsc := startTestSMSC(t)
+	acc := smsc.account()
+	acc.Timing.EnquireLink = 20 * time.Millisecond
+
+	var mu sync.Mutex
+	var requests, responses []uint32
+	handler := func(dir sender.Direction, pd sender.PDU) {
+		hdr := pd.GetHeader()
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case dir == sender.Outbound && hdr.Command == sender.EnquireLink:
+			requests = append(requests, hdr.Sequence)
+		case dir == sender.Inbound && hdr.Command == sender.EnquireLinkResp:
+			responses = append(responses, hdr.Sequence)
+		}
+	}
+
+	session, err := startSession(
+		&acc,
+		acc.BindType,
+		newSessionTracker(acc.Timing, handler),
+		newRefCounter(),
+		handler,
+		func(error) {},
+		func(sender.ReconnectEvent) {},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	session.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) < 2 {
+		t.Fatalf("got %d outbound enquire_link, want several", len(requests))
+	}
+	for _, seq := range responses {
+		found := false
+		for _, req := range requests {
+			found = found || req == seq
+		}
+		if !found {
+			t.Fatalf("enquire_link_resp %d has no enquire_link reported before it", seq)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package smpp
+
+import (
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// latencySampleSize bounds the memory taken by latencies of a long session.
+const latencySampleSize = 10000
+
+// LatencySample keeps exact count, sum, minimum and maximum of latencies and
+// a uniform random sample of them for percentiles.
+type LatencySample struct {
+	count  int
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+	sample []time.Duration
+}
+
+func (s *LatencySample) Add(d time.Duration) {
+	s.count++
+	s.sum += d
+	if s.count == 1 || d < s.min {
+		s.min = d
+	}
+	if d > s.max {
+		s.max = d
+	}
+
+	if len(s.sample) < latencySampleSize {
+		s.sample = append(s.sample, d)
+		return
+	}
+	// Reservoir sampling keeps every latency with equal probability.
+	if i := rand.IntN(s.count); i < latencySampleSize {
+		s.sample[i] = d
+	}
+}
+
+func (s *LatencySample) Count() int {
+	return s.count
+}
+
+func (s *LatencySample) Min() time.Duration {
+	return s.min
+}
+
+func (s *LatencySample) Max() time.Duration {
+	return s.max
+}
+
+func (s *LatencySample) Avg() time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	return s.sum / time.Duration(s.count)
+}
+
+// Sorted returns a sorted copy of the sample, to be passed to Percentile.
+func (s *LatencySample) Sorted() []time.Duration {
+	sorted := slices.Clone(s.sample)
+	slices.Sort(sorted)
+	return sorted
+}
+
+// Percentile uses nearest-rank method on sorted latencies.
+func Percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
@@ -0,0 +1,71 @@
+package smpp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name   string
+		sorted []time.Duration
+		p      int
+		want   time.Duration
+	}{
+		{name: "empty", sorted: nil, p: 50, want: 0},
+		{name: "single", sorted: []time.Duration{7}, p: 99, want: 7},
+		{name: "zero", sorted: []time.Duration{1, 2, 3}, p: 0, want: 1},
+		{name: "median of odd", sorted: []time.Duration{1, 2, 3}, p: 50, want: 2},
+		{name: "median of even", sorted: []time.Duration{1, 2, 3, 4}, p: 50, want: 2},
+		{name: "p95 of 20", sorted: seq(20), p: 95, want: 19},
+		{name: "p95 of 100", sorted: seq(100), p: 95, want: 95},
+		{name: "p99 of 100", sorted: seq(100), p: 99, want: 99},
+		{name: "p99 of 1000", sorted: seq(1000), p: 99, want: 990},
+		{name: "max", sorted: seq(10), p: 100, want: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Percentile(tt.sorted, tt.p); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// seq returns 1..n.
+func seq(n int) []time.Duration {
+	s := make([]time.Duration, n)
+	for i := range s {
+		s[i] = time.Duration(i + 1)
+	}
+	return s
+}
+
+func TestLatencySample(t *testing.T) {
+	var s LatencySample
+	if s.Count() != 0 || s.Avg() != 0 || len(s.Sorted()) != 0 {
+		t.Fatal("empty sample isn't empty")
+	}
+
+	n := 5 * latencySampleSize
+	for i := n; i > 0; i-- {
+		s.Add(time.Duration(i) * time.Microsecond)
+	}
+	if s.Count() != n || s.Min() != time.Microsecond || s.Max() != time.Duration(n)*time.Microsecond {
+		t.Fatalf("got count %d, min %v, max %v", s.Count(), s.Min(), s.Max())
+	}
+	if want := time.Duration(n+1) * time.Microsecond / 2; s.Avg() != want {
+		t.Fatalf("got avg %v, want %v", s.Avg(), want)
+	}
+
+	sorted := s.Sorted()
+	if len(sorted) != latencySampleSize {
+		t.Fatalf("sample holds %d latencies, want %d", len(sorted), latencySampleSize)
+	}
+	// The sample is uniform, so its median is close to the real one.
+	median := Percentile(sorted, 50)
+	if want := time.Duration(n/2) * time.Microsecond; median < want*9/10 || median > want*11/10 {
+		t.Fatalf("sample median %v is far from %v", median, want)
+	}
+}
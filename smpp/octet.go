@@ -0,0 +1,40 @@
+package smpp
+
+type octet struct {
+	dataCoding byte
+}
+
+func (c octet) DataCoding() byte {
+	return c.dataCoding
+}
+
+func (octet) Encode(str string) ([]byte, error) {
+	return []byte(str), nil
+}
+
+func (octet) Decode(buf []byte) (string, error) {
+	return string(buf), nil
+}
+
+func (octet) ShouldSplit(text string, octetLimit uint) bool {
+	return uint(len(text)) > octetLimit
+}
+
+func (octet) EncodeSplit(text string, octetLimit uint) ([][]byte, error) {
+	if octetLimit == 0 {
+		octetLimit = 140
+	}
+
+	buf := []byte(text)
+	segments := make([][]byte, 0, (uint(len(buf))+octetLimit-1)/octetLimit)
+	for uint(len(buf)) > octetLimit {
+		segments = append(segments, buf[:octetLimit])
+		buf = buf[octetLimit:]
+	}
+
+	if len(buf) > 0 {
+		segments = append(segments, buf)
+	}
+
+	return segments, nil
+}
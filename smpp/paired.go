@@ -0,0 +1,154 @@
+package smpp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"smppizdez/account"
+	"smppizdez/sender"
+	"sync"
+	"time"
+)
+
+const (
+	legTX = iota
+	legRX
+)
+
+var legNames = [2]string{"transmitter", "receiver"}
+
+// pairedSession presents transmitter and receiver binds of a single account
+// as one session. Requests go over the transmitter, while deliver_sm arrive
+// on the receiver. Once either bind is closed for good, the other one is
+// closed too, and the session is reported closed only once.
+type pairedSession struct {
+	onClose     sender.CloseHandler
+	onReconnect sender.ReconnectHandler
+
+	mu       sync.Mutex
+	legs     [2]*Session
+	finished bool
+	// silent suppresses onClose when the session failed to start.
+	silent bool
+}
+
+func startPairedSession(
+	acc *account.Account,
+	t *tracker,
+	refs *refCounter,
+	handler sender.PDUHandler,
+	onClose sender.CloseHandler,
+	onReconnect sender.ReconnectHandler,
+) (*pairedSession, error) {
+	p := &pairedSession{onClose: onClose, onReconnect: onReconnect}
+
+	tx, err := startSession(
+		acc,
+		account.Transmitter,
+		t,
+		refs,
+		handler,
+		func(err error) { p.legClosed(legTX, err) },
+		func(ev sender.ReconnectEvent) { p.legReconnect(legTX, ev) },
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s bind: %w", legNames[legTX], err)
+	}
+	p.mu.Lock()
+	p.legs[legTX] = tx
+	p.mu.Unlock()
+
+	rx, err := startSession(
+		acc,
+		account.Receiver,
+		t,
+		refs,
+		handler,
+		func(err error) { p.legClosed(legRX, err) },
+		func(ev sender.ReconnectEvent) { p.legReconnect(legRX, ev) },
+	)
+	if err != nil {
+		p.mu.Lock()
+		p.silent = true
+		p.mu.Unlock()
+		tx.Close()
+		return nil, fmt.Errorf("%s bind: %w", legNames[legRX], err)
+	}
+	p.mu.Lock()
+	p.legs[legRX] = rx
+	p.mu.Unlock()
+
+	return p, nil
+}
+
+func (p *pairedSession) legClosed(leg int, err error) {
+	p.mu.Lock()
+	if p.finished {
+		p.mu.Unlock()
+		return
+	}
+	p.finished = true
+	other := p.legs[1-leg]
+	silent := p.silent
+	p.mu.Unlock()
+
+	if other != nil {
+		other.Close()
+	}
+	if silent {
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("%s bind: %w", legNames[leg], err)
+	}
+	p.onClose(err)
+}
+
+// legReconnect reports reconnection of either bind. Requests go over the
+// transmitter only, so events of the receiver are marked receive only and
+// don't stop sending.
+func (p *pairedSession) legReconnect(leg int, ev sender.ReconnectEvent) {
+	ev.ReceiveOnly = leg == legRX
+	if ev.Err != nil {
+		ev.Err = fmt.Errorf("%s bind: %w", legNames[leg], ev.Err)
+	}
+	p.onReconnect(ev)
+}
+
+func (p *pairedSession) SendMessage(req *sender.Request) error {
+	return p.legs[legTX].SendMessage(req)
+}
+
+func (p *pairedSession) Send(ctx context.Context, req *sender.Request) (sender.SendResult, error) {
+	return p.legs[legTX].Send(ctx, req)
+}
+
+func (p *pairedSession) Endpoint() string {
+	return fmt.Sprintf(
+		"%s %s, %s %s",
+		legNames[legTX],
+		p.legs[legTX].Endpoint(),
+		legNames[legRX],
+		p.legs[legRX].Endpoint(),
+	)
+}
+
+func (p *pairedSession) InFlight() (int, int) {
+	return p.legs[legTX].InFlight()
+}
+
+func (p *pairedSession) Close() error {
+	return p.closeBy(time.Now().Add(p.legs[legTX].timing.UnbindTimeout))
+}
+
+func (p *pairedSession) closeBy(deadline time.Time) error {
+	var rxErr error
+	done := make(chan struct{})
+	go func() {
+		rxErr = p.legs[legRX].closeBy(deadline)
+		close(done)
+	}()
+	txErr := p.legs[legTX].closeBy(deadline)
+	<-done
+	return errors.Join(txErr, rxErr)
+}
@@ -1,13 +1,16 @@
 package smpp
 
 import (
-	"crypto/tls"
+	"cmp"
+	"context"
 	"encoding/base64"
-	"fmt"
-	"net"
+	"errors"
+	"slices"
 	"smppizdez/account"
 	"smppizdez/coding"
 	"smppizdez/sender"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/linxGnu/gosmpp"
@@ -86,120 +89,260 @@ var (
 	}
 )
 
-type Sender struct {
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-	EnquireLink  time.Duration
-}
+type Sender struct{}
 
 type Session struct {
 	handler       sender.PDUHandler
+	onClose       sender.CloseHandler
+	onReconnect   sender.ReconnectHandler
 	defaultCoding coding.Coding
-	conn          *gosmpp.Session
-	tr            gosmpp.Transmitter
-	lastErr       error
+	connector     *failoverConnector
+	settings      gosmpp.Settings
+	reconnect     account.ReconnectPolicy
+	timing        account.SessionTiming
+	window        *window
+	tracker       *tracker
+	refs          *refCounter
+	throughput    account.Throughput
+	throttle      *throttle
+	state         *stateMachine
+	done          chan struct{}
+	// unbound is closed once unbind_resp arrives or the connection is
+	// closed for good.
+	unbound    chan struct{}
+	unbindOnce sync.Once
+
+	mu         sync.Mutex
+	conn       *gosmpp.Session
+	tr         gosmpp.Transmitter
+	link       *keepAlive
+	waiters    map[int32]chan submitResp
+	outgoing   map[int32]*outgoing
+	pending    map[int32]pendingSubmit
+	generation int
+	lastErr    error
 }
 
+var (
+	SessionNotBound  = errors.New("Session is not bound")
+	SessionUnbinding = errors.New("Session is unbinding")
+	NoUnbindResponse = errors.New("No unbind_resp within unbind timeout")
+)
+
 func (s *Session) SendMessage(req *sender.Request) error {
-	segments, err := getSegments(req)
+	segments, err := getSegments(req, s.refs)
 	if err != nil {
 		return err
 	}
 
+	s.mu.Lock()
+	tr := s.tr
+	s.mu.Unlock()
+	if tr == nil {
+		return SessionNotBound
+	}
+
 	isMultiSegment := len(segments) > 1
 	for _, seg := range segments {
-		err = s.tr.Submit(seg.pd)
+		out := &outgoing{seg: seg, isMultiSegment: isMultiSegment}
+		_, err = s.submit(context.Background(), tr, out)
 		if err != nil {
 			return err
 		}
-
-		pduInfo := &sender.SubmitSMPDU{
-			Header: sender.Header{
-				Command:  sender.SubmitSM,
-				Status:   sender.ESME_ROK,
-				Sequence: uint32(seg.pd.SequenceNumber),
-			},
-			Ref:            int(seg.ref),
-			Total:          int(seg.total),
-			Seq:            int(seg.seq),
-			IsMultiSegment: isMultiSegment,
-		}
-		s.handler(sender.Outbound, pduInfo)
 	}
 
 	return nil
 }
 
+// Endpoint returns the endpoint the session is bound to.
+func (s *Session) Endpoint() string {
+	return s.connector.boundEndpoint()
+}
+
+func (s *Session) InFlight() (int, int) {
+	return s.window.count(), s.window.size
+}
+
+// Close sends unbind and waits for unbind_resp up to unbind timeout before
+// closing the connection. Outstanding requests are drained by poolSession
+// beforehand.
 func (s *Session) Close() error {
-	return s.conn.Close()
+	return s.closeBy(time.Now().Add(s.timing.UnbindTimeout))
+}
+
+func (s *Session) closeBy(deadline time.Time) error {
+	if _, ok := s.state.transition(sender.StateUnbinding); !ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	conn := s.conn
+	tr := s.tr
+	s.mu.Unlock()
+
+	close(s.done)
+	if conn == nil {
+		return nil
+	}
+	return errors.Join(s.unbind(tr, deadline), conn.Close())
+}
+
+func (s *Session) setUnbound() {
+	s.unbindOnce.Do(func() { close(s.unbound) })
+}
+
+func (s *Session) unbind(tr gosmpp.Transmitter, deadline time.Time) error {
+	// gosmpp sends unbind on close anyway, without waiting for response.
+	if s.timing.UnbindTimeout <= 0 {
+		return nil
+	}
+
+	p := pdu.NewUnbind()
+	seq := p.GetSequenceNumber()
+	s.tracker.track(sender.Unbind, seq, time.Now())
+	err := tr.Submit(p)
+	if err != nil {
+		s.tracker.forget(seq)
+		return err
+	}
+	s.handler(sender.Outbound, &sender.GenericPDU{
+		Header: sender.Header{
+			Command:  sender.Unbind,
+			Status:   sender.ESME_ROK,
+			Sequence: uint32(seq),
+		},
+	})
+
+	select {
+	case <-s.unbound:
+		return nil
+	case <-time.After(time.Until(deadline)):
+		return NoUnbindResponse
+	}
 }
 
 func (s Sender) StartSession(
 	acc *account.Account,
 	handler sender.PDUHandler,
 	onClose sender.CloseHandler,
+	onReconnect sender.ReconnectHandler,
+	onState sender.StateHandler,
 ) (sender.Session, error) {
+	session, err := startPool(acc, handler, onClose, onReconnect, onState)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func getTiming(acc *account.Account) account.SessionTiming {
+	if acc.Timing == (account.SessionTiming{}) {
+		return account.DefaultSessionTiming
+	}
+	return acc.Timing
+}
+
+// newSessionTracker creates tracker shared by all binds of a session, so
+// that their statistics are reported together.
+func newSessionTracker(timing account.SessionTiming, handler sender.PDUHandler) *tracker {
+	return newTracker(timing.ResponseTimeout, func(cmd sender.Command, seq int32) {
+		handler(sender.Inbound, &sender.NoResponsePDU{
+			Header: sender.Header{
+				Command:  cmd,
+				Sequence: uint32(seq),
+			},
+			Timeout: timing.ResponseTimeout,
+		})
+	})
+}
+
+// startSession opens a single bind of acc with bindType.
+func startSession(
+	acc *account.Account,
+	bindType account.BindType,
+	t *tracker,
+	refs *refCounter,
+	handler sender.PDUHandler,
+	onClose sender.CloseHandler,
+	onReconnect sender.ReconnectHandler,
+) (*Session, error) {
 	auth := gosmpp.Auth{
-		SMSC:       fmt.Sprintf("%s:%d", acc.Host, acc.Port),
 		SystemID:   acc.SystemID,
 		Password:   acc.Password,
 		SystemType: acc.SystemType,
 	}
 
-	var dialer gosmpp.Dialer
+	timing := getTiming(acc)
+	base := proxyDialer(acc.Proxy, timing.BindTimeout)
+	dialer := func(string) gosmpp.Dialer { return base }
 	if acc.TLS {
-		dialer = tlsDialer
-	} else {
-		dialer = gosmpp.NonTLSDialer
-	}
-
-	var connector gosmpp.Connector
-	switch acc.BindType {
-	case account.Transceiver:
-		connector = gosmpp.TRXConnector(dialer, auth)
-	case account.Transmitter:
-		connector = gosmpp.TXConnector(dialer, auth)
-	default:
-		connector = gosmpp.RXConnector(dialer, auth)
+		cfg, err := newTLSConfig(acc.TLSSettings)
+		if err != nil {
+			return nil, err
+		}
+		dialer = func(host string) gosmpp.Dialer { return tlsDialer(base, cfg, host, timing.BindTimeout) }
 	}
 
 	session := &Session{
 		handler:       handler,
+		onClose:       onClose,
+		onReconnect:   onReconnect,
 		defaultCoding: acc.DefaultCoding,
+		reconnect:     acc.Reconnect,
+		timing:        timing,
+		tracker:       t,
+		refs:          refs,
+		state:         newStateMachine(nil),
+		done:          make(chan struct{}),
+		unbound:       make(chan struct{}),
+		waiters:       make(map[int32]chan submitResp),
+		outgoing:      make(map[int32]*outgoing),
+		pending:       make(map[int32]pendingSubmit),
+		throughput:    acc.Throughput,
+		throttle: newThrottle(
+			acc.Throughput.TPS,
+			acc.Throughput.Burst,
+			acc.Throughput.RetryDelay,
+		),
+		window: newWindow(
+			acc.Window.Size,
+			acc.Window.BlockWhenFull,
+			timing.ResponseTimeout,
+		),
 	}
 
-	settings := gosmpp.Settings{
-		ReadTimeout:  s.ReadTimeout,
-		WriteTimeout: s.WriteTimeout,
-		EnquireLink:  s.EnquireLink,
+	session.connector = newFailoverConnector(
+		acc.Endpoints(),
+		bindType,
+		auth,
+		dialer,
+		timing.BindTimeout,
+	)
+	session.connector.proxied = acc.Proxy.Type != 0
+
+	// enquire_link is sent by keepAlive instead of gosmpp, since the latter
+	// never checks whether it was answered.
+	session.settings = gosmpp.Settings{
+		ReadTimeout:  timing.ReadTimeout,
+		WriteTimeout: timing.WriteTimeout,
 		OnAllPDU:     session.pduHandler,
 
-		OnReceivingError: func(err error) {
-			session.lastErr = err
-		},
+		OnReceivingError: session.setLastErr,
 		OnSubmitError: func(_ pdu.PDU, err error) {
-			session.lastErr = err
-		},
-		OnClosed: func(st gosmpp.State) {
-			onClose(session.lastErr)
+			session.setLastErr(err)
 		},
 	}
 
-	var err error
-	session.conn, err = gosmpp.NewSession(connector, settings, -1)
+	conn, gen, err := session.dial()
 	if err != nil {
+		session.state.transition(sender.StateClosed)
 		return nil, err
 	}
+	session.bind(conn, gen)
 
-	session.tr = session.conn.Transmitter()
 	return session, nil
 }
 
-func tlsDialer(addr string) (net.Conn, error) {
-	cfg := tls.Config{MinVersion: tls.VersionTLS12}
-	return tls.Dial("tcp", addr, &cfg)
-}
-
 func (s Sender) SupportedCodings() []coding.Coding {
 	result := make([]coding.Coding, 0, len(supportedCodings))
 	for cod := range supportedCodings {
@@ -289,6 +432,11 @@ func getCodingByByte(defaultCoding coding.Coding, codingByte byte) (coding.Codin
 	}
 }
 
+// isResponse reports whether id is a response, including generic_nack.
+func isResponse(id data.CommandIDType) bool {
+	return id&data.GENERIC_NACK != 0
+}
+
 func getPduHeader(pd pdu.PDU) (sender.Header, bool) {
 	var hdr sender.Header
 	var ok bool
@@ -313,9 +461,23 @@ func (s *Session) pduHandler(pd pdu.PDU) (pdu.PDU, bool) {
 		response = pd.GetResponse()
 	}
 
+	if isResponse(pd.GetHeader().CommandID) {
+		s.tracker.resolve(pd.GetSequenceNumber(), time.Now())
+	}
+
 	_, shouldClose = pd.(*pdu.Unbind)
-	if !shouldClose {
-		_, shouldClose = pd.(*pdu.UnbindResp)
+	if _, ok := pd.(*pdu.UnbindResp); ok {
+		shouldClose = true
+		s.setUnbound()
+	}
+
+	if _, ok := pd.(*pdu.EnquireLinkResp); ok {
+		s.mu.Lock()
+		link := s.link
+		s.mu.Unlock()
+		if link != nil {
+			link.ack(pd.GetSequenceNumber())
+		}
 	}
 
 	hdr, ok := getPduHeader(pd)
@@ -330,13 +492,24 @@ func (s *Session) pduHandler(pd pdu.PDU) (pdu.PDU, bool) {
 			Header:    hdr,
 			MessageID: req.MessageID,
 		}
+		s.handleSubmitResp(req.SequenceNumber, hdr.Status, req.MessageID)
+	case *pdu.GenericNack:
+		pduInfo = &sender.GenericPDU{
+			Header: hdr,
+		}
+		s.handleSubmitResp(req.SequenceNumber, hdr.Status, "")
 
 	case *pdu.DeliverSM:
 		cod, dec := getCodingByByte(s.defaultCoding, req.Message.Encoding().DataCoding())
 
-		var messageID, message string
+		var messageID, message, state string
 		if field, ok := req.OptionalParameters[pdu.TagReceiptedMessageID]; ok {
-			messageID = string(field.Data)
+			messageID = strings.TrimRight(string(field.Data), "\x00")
+		}
+		if field, ok := req.OptionalParameters[pdu.TagMessageStateOption]; ok && len(field.Data) > 0 {
+			if int(field.Data[0]) < len(receiptStates) {
+				state = receiptStates[field.Data[0]]
+			}
 		}
 
 		if dec != nil {
@@ -350,14 +523,35 @@ func (s *Session) pduHandler(pd pdu.PDU) (pdu.PDU, bool) {
 			}
 		}
 
+		isReceipt := req.EsmClass&data.SM_SMSC_DLV_RCPT_TYPE != 0
+		if isReceipt && messageID == "" {
+			messageID = receiptField(message, "id")
+		}
+		if isReceipt && state == "" {
+			state = receiptField(message, "stat")
+		}
+		if isReceipt && messageID != "" {
+			s.tracker.receiptArrived(messageID)
+		}
+
+		optional := make([]sender.TLV, 0, len(req.OptionalParameters))
+		for tag, field := range req.OptionalParameters {
+			optional = append(optional, sender.TLV{Tag: uint16(tag), Value: field.Data})
+		}
+		slices.SortFunc(optional, func(a, b sender.TLV) int {
+			return cmp.Compare(a.Tag, b.Tag)
+		})
+
 		pduInfo = &sender.DeliverSMPDU{
-			Header:      hdr,
-			Source:      pduAddressToSender(req.SourceAddr),
-			Destination: pduAddressToSender(req.DestAddr),
-			EsmClass:    int(req.EsmClass),
-			Coding:      cod,
-			MessageID:   messageID,
-			Message:     message,
+			Header:       hdr,
+			Source:       pduAddressToSender(req.SourceAddr),
+			Destination:  pduAddressToSender(req.DestAddr),
+			EsmClass:     int(req.EsmClass),
+			Coding:       cod,
+			MessageID:    messageID,
+			Message:      message,
+			ReceiptState: state,
+			Optional:     optional,
 		}
 	default:
 		pduInfo = &sender.GenericPDU{
@@ -377,3 +571,28 @@ func (s *Session) pduHandler(pd pdu.PDU) (pdu.PDU, bool) {
 
 	return response, shouldClose
 }
+
+// receiptStates maps message_state TLV values to the states used by receipt
+// text.
+var receiptStates = []string{
+	"",
+	"ENROUTE",
+	"DELIVRD",
+	"EXPIRED",
+	"DELETED",
+	"UNDELIV",
+	"ACCEPTD",
+	"UNKNOWN",
+	"REJECTD",
+}
+
+// receiptField extracts a field from the text of delivery receipt in the
+// format suggested by SMPP 3.4 Appendix B ("id:IIIIIIIIII sub:SSS ...").
+func receiptField(text, name string) string {
+	for _, field := range strings.Fields(text) {
+		if value, ok := strings.CutPrefix(field, name+":"); ok {
+			return value
+		}
+	}
+	return ""
+}
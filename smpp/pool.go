@@ -0,0 +1,397 @@
+package smpp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"smppizdez/account"
+	"smppizdez/sender"
+	"sync"
+	"time"
+)
+
+const drainInterval = 50 * time.Millisecond
+
+var (
+	DrainTimeout      = errors.New("Unbind timeout expired before all responses arrived")
+	ReceiptsAbandoned = errors.New("Session closed before all delivery receipts arrived")
+)
+
+// member is a single bind of a pool, either Session or pairedSession.
+type member interface {
+	SendMessage(req *sender.Request) error
+	Send(ctx context.Context, req *sender.Request) (sender.SendResult, error)
+	InFlight() (int, int)
+	Endpoint() string
+	Close() error
+	// closeBy unbinds waiting for unbind_resp up to deadline.
+	closeBy(deadline time.Time) error
+}
+
+type poolBind struct {
+	session  member
+	state    sender.SessionState
+	sent     int
+	received int
+	// receiverDown is set while the receiver of a paired bind is
+	// reconnecting, the bind keeps its state.
+	receiverDown bool
+}
+
+// poolSession spreads messages across several binds of the same account.
+// It is bound while any of its binds is bound and is reported closed once
+// all of them are closed.
+type poolSession struct {
+	balancing   account.Balancing
+	timing      account.SessionTiming
+	receives    bool
+	tracker     *tracker
+	refs        *refCounter
+	onClose     sender.CloseHandler
+	onReconnect sender.ReconnectHandler
+	state       *stateMachine
+
+	mu    sync.Mutex
+	binds []*poolBind
+	next  int
+	open  int
+	errs  []error
+	// silent suppresses onClose when the session failed to start.
+	silent bool
+}
+
+func startPool(
+	acc *account.Account,
+	handler sender.PDUHandler,
+	onClose sender.CloseHandler,
+	onReconnect sender.ReconnectHandler,
+	onState sender.StateHandler,
+) (*poolSession, error) {
+	count := max(acc.Binds.Count, 1)
+	timing := getTiming(acc)
+	p := &poolSession{
+		balancing:   acc.Binds.Balancing,
+		timing:      timing,
+		receives:    acc.BindType != account.Transmitter,
+		tracker:     newSessionTracker(timing, handler),
+		refs:        newRefCounter(),
+		onClose:     onClose,
+		onReconnect: onReconnect,
+		state:       newStateMachine(onState),
+		binds:       make([]*poolBind, count),
+		open:        count,
+	}
+	for i := range p.binds {
+		p.binds[i] = &poolBind{state: sender.StateBound}
+	}
+
+	for i := range p.binds {
+		session, err := p.startBind(acc, i, handler)
+		if err != nil {
+			p.mu.Lock()
+			p.silent = true
+			p.mu.Unlock()
+			p.closeBinds(time.Now().Add(timing.UnbindTimeout))
+			p.tracker.clear()
+			return nil, p.bindError(i, err)
+		}
+
+		p.mu.Lock()
+		p.binds[i].session = session
+		p.mu.Unlock()
+	}
+
+	p.state.transition(sender.StateBound)
+	// Binds lost while the rest were starting are not reflected yet.
+	p.updateState()
+	return p, nil
+}
+
+func (p *poolSession) startBind(
+	acc *account.Account,
+	idx int,
+	handler sender.PDUHandler,
+) (member, error) {
+	b := p.binds[idx]
+	countingHandler := func(dir sender.Direction, pd sender.PDU) {
+		p.mu.Lock()
+		if dir == sender.Inbound {
+			b.received++
+		} else {
+			b.sent++
+		}
+		p.mu.Unlock()
+		handler(dir, pd)
+	}
+	onClose := func(err error) { p.bindClosed(idx, err) }
+	onReconnect := func(ev sender.ReconnectEvent) { p.bindReconnect(idx, ev) }
+
+	if acc.BindType == account.TransmitterReceiver {
+		session, err := startPairedSession(acc, p.tracker, p.refs, countingHandler, onClose, onReconnect)
+		if err != nil {
+			return nil, err
+		}
+		return session, nil
+	}
+
+	session, err := startSession(acc, acc.BindType, p.tracker, p.refs, countingHandler, onClose, onReconnect)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (p *poolSession) bindError(idx int, err error) error {
+	if len(p.binds) == 1 {
+		return err
+	}
+	return fmt.Errorf("bind %d: %w", idx+1, err)
+}
+
+func (p *poolSession) bindClosed(idx int, err error) {
+	p.mu.Lock()
+	p.binds[idx].state = sender.StateClosed
+	p.open--
+	if err != nil {
+		p.errs = append(p.errs, p.bindError(idx, err))
+	}
+	last := p.open == 0
+	silent := p.silent
+	closeErr := errors.Join(p.errs...)
+	p.mu.Unlock()
+
+	if silent {
+		return
+	}
+	if !last {
+		p.updateState()
+		return
+	}
+
+	// Errors of binds lost earlier are visible in their status and are not
+	// reported once the session is closed on request.
+	if prev, _ := p.state.transition(sender.StateClosed); prev == sender.StateUnbinding {
+		closeErr = nil
+	}
+	p.tracker.clear()
+	p.onClose(closeErr)
+}
+
+func (p *poolSession) bindReconnect(idx int, ev sender.ReconnectEvent) {
+	p.mu.Lock()
+	switch {
+	case ev.ReceiveOnly:
+		p.binds[idx].receiverDown = ev.State == sender.Reconnecting
+	case ev.State == sender.Reconnecting:
+		p.binds[idx].state = sender.StateReconnecting
+	default:
+		p.binds[idx].state = sender.StateBound
+	}
+	p.mu.Unlock()
+
+	if len(p.binds) > 1 {
+		ev.Bind = idx + 1
+	}
+	p.onReconnect(ev)
+	p.updateState()
+}
+
+// updateState moves the session to bound while any bind is bound, and to
+// reconnecting while the rest are reconnecting. Closing is handled by
+// bindClosed and Close.
+func (p *poolSession) updateState() {
+	p.mu.Lock()
+	state := sender.StateClosed
+	for _, b := range p.binds {
+		if b.state == sender.StateBound {
+			state = sender.StateBound
+			break
+		}
+		if b.state == sender.StateReconnecting {
+			state = sender.StateReconnecting
+		}
+	}
+	p.mu.Unlock()
+
+	if state != sender.StateClosed && !p.state.is(sender.StateConnecting) {
+		p.state.transition(state)
+	}
+}
+
+// pick chooses a bound bind to send the next message over.
+func (p *poolSession) pick() (member, error) {
+	switch p.state.get() {
+	case sender.StateUnbinding:
+		return nil, SessionUnbinding
+	case sender.StateClosed:
+		return nil, SessionClosed
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best member
+	bestLoad := 0
+	for i := range len(p.binds) {
+		b := p.binds[(p.next+i)%len(p.binds)]
+		if b.state != sender.StateBound || b.session == nil {
+			continue
+		}
+
+		if p.balancing != account.LeastLoaded {
+			p.next += i + 1
+			return b.session, nil
+		}
+
+		load, _ := b.session.InFlight()
+		if best == nil || load < bestLoad {
+			best = b.session
+			bestLoad = load
+		}
+	}
+
+	if best == nil {
+		return nil, SessionNotBound
+	}
+	p.next++
+	return best, nil
+}
+
+func (p *poolSession) SendMessage(req *sender.Request) error {
+	session, err := p.pick()
+	if err != nil {
+		return err
+	}
+	return session.SendMessage(req)
+}
+
+func (p *poolSession) Send(ctx context.Context, req *sender.Request) (sender.SendResult, error) {
+	session, err := p.pick()
+	if err != nil {
+		return sender.SendResult{}, err
+	}
+	return session.Send(ctx, req)
+}
+
+func (p *poolSession) InFlight() (int, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var inFlight, size int
+	for _, b := range p.binds {
+		if b.session == nil || b.state == sender.StateClosed {
+			continue
+		}
+		n, s := b.session.InFlight()
+		inFlight += n
+		size += s
+	}
+	return inFlight, size
+}
+
+func (p *poolSession) Stats() []sender.ResponseStats {
+	return p.tracker.report()
+}
+
+func (p *poolSession) Binds() []sender.BindStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make([]sender.BindStatus, len(p.binds))
+	for i, b := range p.binds {
+		result[i] = sender.BindStatus{
+			State:        b.state,
+			Sent:         b.sent,
+			Received:     b.received,
+			ReceiverDown: b.receiverDown,
+		}
+		if b.session != nil {
+			result[i].InFlight, result[i].Window = b.session.InFlight()
+			result[i].Endpoint = b.session.Endpoint()
+		}
+	}
+	return result
+}
+
+func (p *poolSession) State() sender.SessionState {
+	return p.state.get()
+}
+
+// Close stops accepting new messages and waits for responses to the
+// submitted ones, then unbinds every bind. Draining and unbinding share one
+// unbind timeout. Responses still missing and delivery receipts never
+// received are reported in the returned error.
+func (p *poolSession) Close() error {
+	if _, ok := p.state.transition(sender.StateUnbinding); !ok {
+		return nil
+	}
+	deadline := time.Now().Add(p.timing.UnbindTimeout)
+	drainErr := p.drain(deadline)
+	var receiptsErr error
+	if p.receives {
+		if n := p.tracker.pendingReceipts(); n > 0 {
+			receiptsErr = fmt.Errorf("%w: %d delivery receipt(s) abandoned", ReceiptsAbandoned, n)
+		}
+	}
+	return errors.Join(drainErr, receiptsErr, p.closeBinds(deadline))
+}
+
+// drain waits up to deadline for responses to submitted messages. Delivery
+// receipts may take much longer than unbind timeout, so they aren't waited
+// for.
+func (p *poolSession) drain(deadline time.Time) error {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+
+	for {
+		responses, _ := p.InFlight()
+		if responses == 0 {
+			return nil
+		}
+
+		// Nothing arrives once every bind is lost.
+		if !time.Now().Before(deadline) || !p.bound() {
+			return fmt.Errorf("%w: %d submit_sm without response", DrainTimeout, responses)
+		}
+		<-ticker.C
+	}
+}
+
+func (p *poolSession) bound() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.ContainsFunc(p.binds, func(b *poolBind) bool {
+		return b.state == sender.StateBound
+	})
+}
+
+// closeBinds unbinds all binds at once, so that their unbind timeouts don't
+// add up.
+func (p *poolSession) closeBinds(deadline time.Time) error {
+	p.mu.Lock()
+	sessions := make([]member, len(p.binds))
+	for i, b := range p.binds {
+		sessions[i] = b.session
+	}
+	p.mu.Unlock()
+
+	errs := make([]error, len(sessions))
+	var wg sync.WaitGroup
+	for i, session := range sessions {
+		if session == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := session.closeBy(deadline); err != nil {
+				errs[i] = p.bindError(i, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,220 @@
+package smpp
+
+import (
+	"context"
+	"errors"
+	"smppizdez/account"
+	"smppizdez/sender"
+	"testing"
+	"time"
+
+	"github.com/linxGnu/gosmpp/pdu"
+)
+
+func TestPoolCloseAbandonsReceipts(t *testing.T) {
+	smsc := startTestSMSC(t)
+	acc := smsc.account()
+	acc.Timing.UnbindTimeout = time.Second
+
+	session, err := startPool(
+		&acc,
+		func(sender.Direction, sender.PDU) {},
+		func(error) {},
+		func(sender.ReconnectEvent) {},
+		func(sender.SessionState) {},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := testRequest("hello")
+	req.RegisteredDelivery = sender.RdRequested
+	if _, err := session.Send(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = session.Close()
+	if !errors.Is(err, ReceiptsAbandoned) || errors.Is(err, DrainTimeout) {
+		t.Fatalf("got %v, want only abandoned receipts reported", err)
+	}
+	// The SMSC answers unbind at once, so nothing waits for the receipt.
+	if elapsed := time.Since(start); elapsed > acc.Timing.UnbindTimeout/2 {
+		t.Fatalf("closed in %v, waiting for the receipt", elapsed)
+	}
+}
+
+func TestPoolCloseSharesUnbindTimeout(t *testing.T) {
+	smsc := startTestSMSC(t)
+	// Never answer submit_sm, so that draining takes the whole timeout.
+	smsc.silent = true
+	acc := smsc.account()
+	acc.Timing.ResponseTimeout = time.Minute
+	acc.Timing.UnbindTimeout = time.Second
+
+	session, err := startPool(
+		&acc,
+		func(sender.Direction, sender.PDU) {},
+		func(error) {},
+		func(sender.ReconnectEvent) {},
+		func(sender.SessionState) {},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.SendMessage(testRequest("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = session.Close()
+	if !errors.Is(err, DrainTimeout) {
+		t.Fatalf("got %v, want %v", err, DrainTimeout)
+	}
+	// gosmpp takes up to 200ms more to stop reading.
+	if elapsed := time.Since(start); elapsed > acc.Timing.UnbindTimeout*3/2 {
+		t.Fatalf("closed in %v, over one unbind timeout", elapsed)
+	}
+}
+
+func TestPairedReceiverLossKeepsSending(t *testing.T) {
+	smsc := startTestSMSC(t)
+	acc := smsc.account()
+	acc.BindType = account.TransmitterReceiver
+	acc.Reconnect = account.ReconnectPolicy{Enabled: true, Delay: 200 * time.Millisecond, MaxDelay: time.Second}
+
+	events := make(chan sender.ReconnectEvent, 4)
+	session, err := startPool(
+		&acc,
+		func(sender.Direction, sender.PDU) {},
+		func(error) {},
+		func(ev sender.ReconnectEvent) { events <- ev },
+		func(sender.SessionState) {},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	smsc.dropBinds(pdu.Receiver)
+	select {
+	case ev := <-events:
+		if ev.State != sender.Reconnecting || !ev.ReceiveOnly {
+			t.Fatalf("got %+v, want receiver reconnecting", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("receiver loss not reported")
+	}
+
+	// The receiver is still waiting to reconnect.
+	if state := session.State(); state != sender.StateBound {
+		t.Fatalf("session is %v, want %v", state, sender.StateBound)
+	}
+	bind := session.Binds()[0]
+	if bind.State != sender.StateBound || !bind.ReceiverDown {
+		t.Fatalf("bind is %+v, want bound with receiver down", bind)
+	}
+	res, err := session.Send(context.Background(), testRequest("hello"))
+	if err != nil || res.Segments[0].Status != sender.ESME_ROK {
+		t.Fatalf("send while receiver reconnects: %v, %+v", err, res)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.State != sender.Reconnected || !ev.ReceiveOnly {
+			t.Fatalf("got %+v, want receiver reconnected", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("receiver didn't reconnect")
+	}
+	if bind := session.Binds()[0]; bind.ReceiverDown {
+		t.Fatal("receiver is still down after reconnecting")
+	}
+}
+
+// loadedMember is a bind with a fixed number of requests in flight.
+type loadedMember struct {
+	member
+	inFlight int
+}
+
+func (m *loadedMember) InFlight() (int, int) { return m.inFlight, 10 }
+
+func TestPoolPick(t *testing.T) {
+	tests := []struct {
+		name      string
+		balancing account.Balancing
+		loads     []int
+		states    []sender.SessionState
+		want      []int
+	}{
+		{
+			name:      "round robin",
+			balancing: account.RoundRobin,
+			loads:     []int{5, 0, 0},
+			states:    []sender.SessionState{sender.StateBound, sender.StateBound, sender.StateBound},
+			want:      []int{0, 1, 2, 0},
+		},
+		{
+			name:      "round robin skips lost binds",
+			balancing: account.RoundRobin,
+			loads:     []int{0, 0, 0},
+			states:    []sender.SessionState{sender.StateBound, sender.StateReconnecting, sender.StateBound},
+			want:      []int{0, 2, 0, 2},
+		},
+		{
+			name:      "least loaded",
+			balancing: account.LeastLoaded,
+			loads:     []int{5, 1, 3},
+			states:    []sender.SessionState{sender.StateBound, sender.StateBound, sender.StateBound},
+			want:      []int{1, 1, 1},
+		},
+		{
+			name:      "least loaded skips lost binds",
+			balancing: account.LeastLoaded,
+			loads:     []int{5, 1, 3},
+			states:    []sender.SessionState{sender.StateBound, sender.StateClosed, sender.StateBound},
+			want:      []int{2, 2},
+		},
+		{
+			name:      "least loaded ties rotate",
+			balancing: account.LeastLoaded,
+			loads:     []int{2, 2, 2},
+			states:    []sender.SessionState{sender.StateBound, sender.StateBound, sender.StateBound},
+			want:      []int{0, 1, 2, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &poolSession{balancing: tt.balancing, state: newStateMachine(func(sender.SessionState) {})}
+			p.state.transition(sender.StateBound)
+			members := make([]*loadedMember, len(tt.loads))
+			for i, load := range tt.loads {
+				members[i] = &loadedMember{inFlight: load}
+				p.binds = append(p.binds, &poolBind{session: members[i], state: tt.states[i]})
+			}
+
+			for i, want := range tt.want {
+				got, err := p.pick()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != members[want] {
+					t.Fatalf("pick %d chose a wrong bind, want bind %d", i, want)
+				}
+			}
+		})
+	}
+
+	p := &poolSession{state: newStateMachine(func(sender.SessionState) {})}
+	p.state.transition(sender.StateBound)
+	p.binds = []*poolBind{{session: &loadedMember{}, state: sender.StateReconnecting}}
+	if _, err := p.pick(); !errors.Is(err, SessionNotBound) {
+		t.Fatalf("got %v with no bound binds, want %v", err, SessionNotBound)
+	}
+	p.state.transition(sender.StateUnbinding)
+	if _, err := p.pick(); !errors.Is(err, SessionUnbinding) {
+		t.Fatalf("got %v while unbinding, want %v", err, SessionUnbinding)
+	}
+}
@@ -0,0 +1,242 @@
+package smpp
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"smppizdez/account"
+	"strconv"
+	"time"
+
+	"github.com/linxGnu/gosmpp"
+)
+
+var ProxyAuthFailed = errors.New("Proxy authentication failed")
+
+// proxyDialer dials SMSC either directly or through the proxy. Host names
+// are passed to the proxy as is and resolved by it.
+func proxyDialer(proxy account.Proxy, timeout time.Duration) gosmpp.Dialer {
+	d := net.Dialer{Timeout: timeout}
+	if proxy.Type == 0 {
+		return func(addr string) (net.Conn, error) {
+			return d.Dial("tcp", addr)
+		}
+	}
+
+	return func(addr string) (net.Conn, error) {
+		conn, err := d.Dial("tcp", proxy.Address())
+		if err != nil {
+			return nil, fmt.Errorf("%v proxy %s: %w", proxy.Type, proxy.Address(), err)
+		}
+
+		if timeout > 0 {
+			conn.SetDeadline(time.Now().Add(timeout))
+		}
+		switch proxy.Type {
+		case account.SOCKS5:
+			err = socks5Connect(conn, proxy, addr)
+		case account.HTTPConnect:
+			conn, err = httpConnect(conn, proxy, addr)
+		default:
+			err = fmt.Errorf("unsupported proxy type %v", proxy.Type)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%v proxy %s: %w", proxy.Type, proxy.Address(), err)
+		}
+
+		err = conn.SetDeadline(time.Time{})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+const (
+	socks5Version      = 5
+	socks5NoAuth       = 0
+	socks5UserPassAuth = 2
+	socks5NoAcceptable = 0xff
+	socks5CmdConnect   = 1
+	socks5IPv4         = 1
+	socks5Domain       = 3
+	socks5IPv6         = 4
+)
+
+var socks5Replies = []string{
+	"succeeded",
+	"general SOCKS server failure",
+	"connection not allowed by ruleset",
+	"network unreachable",
+	"host unreachable",
+	"connection refused",
+	"TTL expired",
+	"command not supported",
+	"address type not supported",
+}
+
+// socks5Connect performs SOCKS5 handshake (RFC 1928) with optional
+// username/password authentication (RFC 1929).
+func socks5Connect(conn net.Conn, proxy account.Proxy, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %s", portStr)
+	}
+
+	methods := []byte{socks5NoAuth}
+	if proxy.Username != "" {
+		methods = append(methods, socks5UserPassAuth)
+	}
+	_, err = conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...))
+	if err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("unexpected SOCKS version %d", reply[0])
+	}
+
+	switch reply[1] {
+	case socks5NoAuth:
+	case socks5UserPassAuth:
+		if err = socks5Auth(conn, proxy); err != nil {
+			return err
+		}
+	case socks5NoAcceptable:
+		return ProxyAuthFailed
+	default:
+		return fmt.Errorf("unsupported SOCKS authentication method %d", reply[1])
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("host name %s is too long", host)
+		}
+		req = append(req, socks5Domain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, socks5IPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, socks5IPv6)
+		req = append(req, ip...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err = conn.Write(req); err != nil {
+		return err
+	}
+
+	reply = make([]byte, 4)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		if int(reply[1]) < len(socks5Replies) {
+			return errors.New(socks5Replies[reply[1]])
+		}
+		return fmt.Errorf("SOCKS request failed with code %d", reply[1])
+	}
+
+	// Skip the bound address, it is of no use for us.
+	var skip int
+	switch reply[3] {
+	case socks5IPv4:
+		skip = net.IPv4len
+	case socks5IPv6:
+		skip = net.IPv6len
+	case socks5Domain:
+		size := make([]byte, 1)
+		if _, err = io.ReadFull(conn, size); err != nil {
+			return err
+		}
+		skip = int(size[0])
+	default:
+		return fmt.Errorf("unexpected SOCKS address type %d", reply[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+func socks5Auth(conn net.Conn, proxy account.Proxy) error {
+	if len(proxy.Username) > 255 || len(proxy.Password) > 255 {
+		return errors.New("proxy username or password is too long")
+	}
+
+	req := []byte{1, byte(len(proxy.Username))}
+	req = append(req, proxy.Username...)
+	req = append(req, byte(len(proxy.Password)))
+	req = append(req, proxy.Password...)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		return ProxyAuthFailed
+	}
+	return nil
+}
+
+// bufferedConn keeps data read ahead while parsing proxy response.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// httpConnect opens a tunnel with HTTP CONNECT request.
+func httpConnect(conn net.Conn, proxy account.Proxy, addr string) (net.Conn, error) {
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", addr, addr)
+	if proxy.Username != "" {
+		credentials := base64.StdEncoding.EncodeToString(
+			[]byte(proxy.Username + ":" + proxy.Password),
+		)
+		req += fmt.Sprintf("Proxy-Authorization: Basic %s\r\n", credentials)
+	}
+	req += "\r\n"
+	if _, err := io.WriteString(conn, req); err != nil {
+		return conn, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return conn, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusProxyAuthRequired:
+		return conn, ProxyAuthFailed
+	default:
+		return conn, fmt.Errorf("CONNECT failed: %s", resp.Status)
+	}
+
+	if r.Buffered() > 0 {
+		return bufferedConn{Conn: conn, r: r}, nil
+	}
+	return conn, nil
+}
@@ -0,0 +1,435 @@
+package smpp
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"smppizdez/account"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// listen starts serving connections of a local listener with handle.
+func listen(t *testing.T, handle func(net.Conn)) *net.TCPAddr {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(c)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr)
+}
+
+func echo(c net.Conn) {
+	defer c.Close()
+	io.Copy(c, c)
+}
+
+// pipe copies data both ways until either side is closed.
+func pipe(a, b net.Conn) {
+	defer a.Close()
+	defer b.Close()
+	go io.Copy(a, b)
+	io.Copy(b, a)
+}
+
+func checkEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := io.WriteString(conn, "ping\n"); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 5)
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "ping\n" {
+		t.Fatalf("echo returned %q", got)
+	}
+}
+
+// socks5Proxy is a stand-in SOCKS5 proxy requiring username and password
+// if username is set.
+type socks5Proxy struct {
+	username string
+	password string
+
+	mu     sync.Mutex
+	target string
+}
+
+func (p *socks5Proxy) lastTarget() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.target
+}
+
+func (p *socks5Proxy) handle(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return
+	}
+
+	method := byte(socks5NoAuth)
+	if p.username != "" {
+		method = socks5UserPassAuth
+	}
+	if !strings.Contains(string(methods), string([]byte{method})) {
+		c.Write([]byte{socks5Version, socks5NoAcceptable})
+		return
+	}
+	c.Write([]byte{socks5Version, method})
+
+	if method == socks5UserPassAuth {
+		readString := func() string {
+			size, _ := r.ReadByte()
+			b := make([]byte, size)
+			io.ReadFull(r, b)
+			return string(b)
+		}
+		r.ReadByte()
+		username := readString()
+		password := readString()
+		if username != p.username || password != p.password {
+			c.Write([]byte{1, 1})
+			return
+		}
+		c.Write([]byte{1, 0})
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(r, req); err != nil {
+		return
+	}
+	var host string
+	switch req[3] {
+	case socks5IPv4:
+		ip := make([]byte, net.IPv4len)
+		io.ReadFull(r, ip)
+		host = net.IP(ip).String()
+	case socks5Domain:
+		size, _ := r.ReadByte()
+		name := make([]byte, size)
+		io.ReadFull(r, name)
+		host = string(name)
+	}
+	port := make([]byte, 2)
+	io.ReadFull(r, port)
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	p.mu.Lock()
+	p.target = target
+	p.mu.Unlock()
+
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		c.Write([]byte{socks5Version, 5, 0, socks5IPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	c.Write([]byte{socks5Version, 0, 0, socks5IPv4, 127, 0, 0, 1, 0, 0})
+	pipe(bufferedConn{Conn: c, r: r}, upstream)
+}
+
+// httpProxy is a stand-in HTTP CONNECT proxy.
+type httpProxy struct {
+	// authorization, if set, is the required Proxy-Authorization header.
+	authorization string
+	// status, if set, is returned instead of connecting.
+	status int
+	// early is sent right after the response header, in the same write.
+	early string
+}
+
+func (p *httpProxy) handle(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	req, err := http.ReadRequest(r)
+	if err != nil || req.Method != http.MethodConnect {
+		return
+	}
+
+	switch {
+	case p.status != 0:
+		fmt.Fprintf(c, "HTTP/1.1 %d %s\r\n\r\n", p.status, http.StatusText(p.status))
+		return
+	case p.authorization != "" && req.Header.Get("Proxy-Authorization") != p.authorization:
+		fmt.Fprintf(c, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		return
+	}
+
+	upstream, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		fmt.Fprintf(c, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n"+p.early)
+	pipe(bufferedConn{Conn: c, r: r}, upstream)
+}
+
+func proxyAccount(typ account.ProxyType, addr *net.TCPAddr, username, password string) account.Proxy {
+	return account.Proxy{
+		Type:     typ,
+		Host:     addr.IP.String(),
+		Port:     uint16(addr.Port),
+		Username: username,
+		Password: password,
+	}
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	target := listen(t, echo)
+	open := &socks5Proxy{}
+	openAddr := listen(t, open.handle)
+	auth := &socks5Proxy{username: "user", password: "secret"}
+	authAddr := listen(t, auth.handle)
+
+	tests := []struct {
+		name     string
+		proxy    *socks5Proxy
+		addr     *net.TCPAddr
+		username string
+		password string
+		target   string
+		wantErr  error
+	}{
+		{name: "no auth", proxy: open, addr: openAddr, target: target.String()},
+		{
+			name:   "host name resolved by proxy",
+			proxy:  open,
+			addr:   openAddr,
+			target: net.JoinHostPort("localhost", strconv.Itoa(target.Port)),
+		},
+		{name: "auth", proxy: auth, addr: authAddr, username: "user", password: "secret", target: target.String()},
+		{
+			name:     "wrong password",
+			proxy:    auth,
+			addr:     authAddr,
+			username: "user",
+			password: "wrong",
+			target:   target.String(),
+			wantErr:  ProxyAuthFailed,
+		},
+		{name: "auth required", proxy: auth, addr: authAddr, target: target.String(), wantErr: ProxyAuthFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := proxyAccount(account.SOCKS5, tt.addr, tt.username, tt.password)
+			conn, err := proxyDialer(proxy, time.Second)(tt.target)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			checkEcho(t, conn)
+			if got := tt.proxy.lastTarget(); got != tt.target {
+				t.Errorf("proxy was asked for %s, want %s", got, tt.target)
+			}
+		})
+	}
+}
+
+func TestHTTPConnectProxy(t *testing.T) {
+	target := listen(t, echo)
+	credentials := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+
+	tests := []struct {
+		name     string
+		proxy    *httpProxy
+		username string
+		password string
+		wantErr  error
+		wantText string
+	}{
+		{name: "200", proxy: &httpProxy{}},
+		{name: "auth", proxy: &httpProxy{authorization: credentials}, username: "user", password: "secret"},
+		{
+			name:     "407",
+			proxy:    &httpProxy{authorization: credentials},
+			username: "user",
+			password: "wrong",
+			wantErr:  ProxyAuthFailed,
+		},
+		{name: "403", proxy: &httpProxy{status: http.StatusForbidden}, wantText: "403 Forbidden"},
+		{name: "bytes after 200", proxy: &httpProxy{early: "early"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := listen(t, tt.proxy.handle)
+			proxy := proxyAccount(account.HTTPConnect, addr, tt.username, tt.password)
+			conn, err := proxyDialer(proxy, time.Second)(target.String())
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			case tt.wantText != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantText) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.wantText)
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if tt.proxy.early != "" {
+				got := make([]byte, len(tt.proxy.early))
+				conn.SetDeadline(time.Now().Add(time.Second))
+				if _, err := io.ReadFull(conn, got); err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.proxy.early {
+					t.Fatalf("got %q right after the response, want %q", got, tt.proxy.early)
+				}
+			}
+			checkEcho(t, conn)
+		})
+	}
+}
+
+// testCertificate returns a self-signed certificate for 127.0.0.1.
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTLSOverProxy(t *testing.T) {
+	cert := testCertificate(t)
+	serverCfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	target := listen(t, func(c net.Conn) { echo(tls.Server(c, serverCfg)) })
+	sum := sha256.Sum256(cert.Certificate[0])
+	pin := hex.EncodeToString(sum[:])
+
+	socks := &socks5Proxy{username: "user", password: "secret"}
+	proxies := []account.Proxy{
+		proxyAccount(account.SOCKS5, listen(t, socks.handle), "user", "secret"),
+		proxyAccount(account.HTTPConnect, listen(t, (&httpProxy{}).handle), "", ""),
+	}
+	tests := []struct {
+		name     string
+		settings account.TLSSettings
+		wantErr  error
+	}{
+		{name: "pinned", settings: account.TLSSettings{InsecureSkipVerify: true, PinnedSHA256: []string{pin}}},
+		{
+			name:     "pin mismatch",
+			settings: account.TLSSettings{InsecureSkipVerify: true, PinnedSHA256: []string{strings.Repeat("00", sha256.Size)}},
+			wantErr:  PinMismatch,
+		},
+	}
+
+	for _, proxy := range proxies {
+		for _, tt := range tests {
+			t.Run(proxy.Type.String()+"/"+tt.name, func(t *testing.T) {
+				cfg, err := newTLSConfig(tt.settings)
+				if err != nil {
+					t.Fatal(err)
+				}
+				dial := tlsDialer(proxyDialer(proxy, time.Second), cfg, "127.0.0.1", time.Second)
+				conn, err := dial(target.String())
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("got error %v, want %v", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				checkEcho(t, conn)
+			})
+		}
+	}
+
+	t.Run("verified", func(t *testing.T) {
+		roots := x509.NewCertPool()
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots.AddCert(leaf)
+		dial := tlsDialer(proxyDialer(proxies[1], time.Second), &tls.Config{RootCAs: roots}, "127.0.0.1", time.Second)
+		conn, err := dial(target.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		checkEcho(t, conn)
+	})
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	// The server accepts connections and never answers the handshake.
+	stalled := make(chan struct{})
+	t.Cleanup(func() { close(stalled) })
+	target := listen(t, func(c net.Conn) {
+		defer c.Close()
+		<-stalled
+	})
+
+	dial := tlsDialer(proxyDialer(account.Proxy{}, time.Second), &tls.Config{}, "127.0.0.1", 100*time.Millisecond)
+	start := time.Now()
+	conn, err := dial(target.String())
+	if err == nil {
+		conn.Close()
+		t.Fatal("handshake with stalled server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("handshake failed after %v, want about 100ms", elapsed)
+	}
+}
@@ -0,0 +1,223 @@
+package smpp
+
+import (
+	"errors"
+	"fmt"
+	"smppizdez/sender"
+	"time"
+
+	"github.com/linxGnu/gosmpp"
+	"github.com/linxGnu/gosmpp/data"
+)
+
+const (
+	defaultReconnectDelay = time.Second
+	defaultMaxDelay       = time.Minute
+)
+
+// fatalBindStatuses are bind_resp statuses that won't change on retry, so
+// reconnecting after them only hammers the SMSC with bad credentials.
+var fatalBindStatuses = []data.CommandStatusType{
+	data.ESME_RINVPASWD,
+	data.ESME_RINVSYSID,
+	data.ESME_RINVSYSTYP,
+}
+
+func (s *Session) setLastErr(err error) {
+	s.mu.Lock()
+	s.lastErr = err
+	s.mu.Unlock()
+}
+
+// dial opens a new gosmpp session. Close notifications of the returned
+// session are tagged with its generation, so callbacks from connections that
+// have already been replaced are ignored.
+func (s *Session) dial() (*gosmpp.Session, int, error) {
+	s.mu.Lock()
+	s.generation++
+	gen := s.generation
+	s.mu.Unlock()
+
+	settings := s.settings
+	settings.OnClosed = func(gosmpp.State) {
+		s.closedHandler(gen)
+	}
+
+	conn, err := gosmpp.NewSession(s.connector, settings, -1)
+	return conn, gen, err
+}
+
+// bind installs conn as the active connection. It returns false if the
+// connection was lost or the session was closed while dialing.
+func (s *Session) bind(conn *gosmpp.Session, gen int) bool {
+	s.mu.Lock()
+	if s.generation != gen {
+		s.mu.Unlock()
+		return false
+	}
+
+	// Close moves to unbinding before it takes the connection, so either
+	// it sees conn or the transition fails here.
+	if _, ok := s.state.transition(sender.StateBound); !ok {
+		s.mu.Unlock()
+		conn.Close()
+		return false
+	}
+
+	s.conn = conn
+	s.tr = conn.Transmitter()
+	s.lastErr = nil
+	if s.timing.EnquireLink > 0 {
+		s.link = newKeepAlive(
+			s.tr,
+			s.tracker,
+			s.handler,
+			s.timing.EnquireLink,
+			s.timing.ResponseTimeout,
+			s.timing.EnquireLinkFailures,
+			func(err error) { s.linkFailed(gen, err) },
+		)
+		go s.link.run()
+	}
+	s.mu.Unlock()
+	return true
+}
+
+// linkFailed drops the connection that stopped answering enquire_link. The
+// session itself stays open, so closedHandler may reconnect it.
+func (s *Session) linkFailed(gen int, err error) {
+	s.mu.Lock()
+	if gen != s.generation || s.conn == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.lastErr = err
+	conn := s.conn
+	s.mu.Unlock()
+
+	conn.Close()
+}
+
+func (s *Session) closedHandler(gen int) {
+	s.mu.Lock()
+	if gen != s.generation {
+		s.mu.Unlock()
+		return
+	}
+
+	s.generation++
+	s.conn = nil
+	s.tr = nil
+	if s.link != nil {
+		s.link.close()
+		s.link = nil
+	}
+	s.window.releaseAll()
+	clear(s.pending)
+	err := s.lastErr
+	// Close moves to unbinding beforehand, so gosmpp.ExplicitClosing alone
+	// doesn't mean that the session should stay closed: the connection may
+	// have been dropped by linkFailed. Reconnecting is reachable only from
+	// bound.
+	shouldReconnect := false
+	if s.reconnect.Enabled {
+		_, shouldReconnect = s.state.transition(sender.StateReconnecting)
+	}
+	if !shouldReconnect {
+		s.state.transition(sender.StateClosed)
+	}
+	s.mu.Unlock()
+
+	if shouldReconnect {
+		go s.reconnectLoop(err)
+	} else {
+		s.finish(err)
+	}
+}
+
+func (s *Session) reconnectLoop(cause error) {
+	delay := s.reconnect.Delay
+	if delay <= 0 {
+		delay = defaultReconnectDelay
+	}
+
+	maxDelay := s.reconnect.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxDelay
+	}
+	maxDelay = max(maxDelay, delay)
+
+	attempts := 0
+	for s.reconnect.MaxAttempts <= 0 || attempts < s.reconnect.MaxAttempts {
+		select {
+		case <-s.done:
+			s.state.transition(sender.StateClosed)
+			s.finish(nil)
+			return
+		default:
+		}
+
+		attempts++
+		s.onReconnect(sender.ReconnectEvent{
+			State:       sender.Reconnecting,
+			Attempt:     attempts,
+			MaxAttempts: s.reconnect.MaxAttempts,
+			Delay:       delay,
+			Err:         cause,
+		})
+
+		select {
+		case <-s.done:
+			s.state.transition(sender.StateClosed)
+			s.finish(nil)
+			return
+		case <-time.After(delay):
+		}
+
+		conn, gen, err := s.dial()
+		if err == nil {
+			if s.bind(conn, gen) {
+				s.onReconnect(sender.ReconnectEvent{
+					State:       sender.Reconnected,
+					Attempt:     attempts,
+					MaxAttempts: s.reconnect.MaxAttempts,
+					Endpoint:    s.Endpoint(),
+				})
+			}
+			return
+		}
+
+		cause = err
+		if isFatalBindError(err) {
+			break
+		}
+		delay = min(delay*2, maxDelay)
+	}
+
+	prev, _ := s.state.transition(sender.StateClosed)
+	if prev == sender.StateUnbinding {
+		s.finish(nil)
+	} else {
+		s.finish(fmt.Errorf("reconnect failed after %d attempt(s): %w", attempts, cause))
+	}
+}
+
+// finish reports that the session is closed for good.
+func (s *Session) finish(err error) {
+	s.setUnbound()
+	s.onClose(err)
+}
+
+func isFatalBindError(err error) bool {
+	var bindErr gosmpp.BindError
+	if !errors.As(err, &bindErr) {
+		return false
+	}
+
+	for _, status := range fatalBindStatuses {
+		if bindErr.CommandStatus == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,352 @@
+package smpp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"smppizdez/sender"
+	"time"
+
+	"github.com/linxGnu/gosmpp"
+	"github.com/linxGnu/gosmpp/data"
+)
+
+var NoResponse = errors.New("No response within response timeout")
+
+// outgoing is a segment submitted to SMSC, kept until its response arrives so
+// that it can be retried after throttling.
+type outgoing struct {
+	seg            segment
+	isMultiSegment bool
+	retries        int
+	sentAt         time.Time
+}
+
+// pendingSubmit is kept for every submit_sm until its response arrives,
+// whether or not it may be retried.
+type pendingSubmit struct {
+	sentAt  time.Time
+	receipt bool
+}
+
+func (o *outgoing) pduInfo() *sender.SubmitSMPDU {
+	return &sender.SubmitSMPDU{
+		Header: sender.Header{
+			Command:  sender.SubmitSM,
+			Status:   sender.ESME_ROK,
+			Sequence: uint32(o.seg.pd.SequenceNumber),
+		},
+		Ref:            int(o.seg.ref),
+		Total:          int(o.seg.total),
+		Seq:            int(o.seg.seq),
+		IsMultiSegment: o.isMultiSegment,
+		Retry:          o.retries,
+	}
+}
+
+// submitResp is delivered to a waiter of a segment. Besides the final
+// response it is sent with retrying set when the segment is queued for retry
+// (with zero at) and when it is sent again.
+type submitResp struct {
+	sequence  int32
+	retries   int
+	retrying  bool
+	status    sender.CommandStatus
+	messageID string
+	// sentAt is the time of the last submission, if the segment was
+	// tracked for retries.
+	sentAt time.Time
+	at     time.Time
+	err    error
+}
+
+func (s *Session) Send(ctx context.Context, req *sender.Request) (sender.SendResult, error) {
+	segments, err := getSegments(req, s.refs)
+	if err != nil {
+		return sender.SendResult{}, err
+	}
+
+	s.mu.Lock()
+	tr := s.tr
+	s.mu.Unlock()
+	if tr == nil {
+		return sender.SendResult{}, SessionNotBound
+	}
+
+	result := sender.SendResult{Segments: make([]sender.SegmentResult, len(segments))}
+	waiters := make([]chan submitResp, len(segments))
+	sentAt := make([]time.Time, len(segments))
+	for i, seg := range segments {
+		result.Segments[i] = sender.SegmentResult{
+			Sequence: uint32(seg.pd.SequenceNumber),
+			Ref:      int(seg.ref),
+			Total:    int(seg.total),
+			Seq:      int(seg.seq),
+		}
+	}
+	defer s.dropWaiters(waiters)
+
+	isMultiSegment := len(segments) > 1
+	for i, seg := range segments {
+		err = ctx.Err()
+		if err == nil {
+			waiters[i] = s.addWaiter(seg.pd.SequenceNumber)
+			out := &outgoing{seg: seg, isMultiSegment: isMultiSegment}
+			sentAt[i], err = s.submit(ctx, tr, out)
+		}
+		if err != nil {
+			failSegments(result.Segments[:i], fmt.Errorf("%w: %w", sender.Interrupted, err))
+			failSegments(result.Segments[i:], err)
+			return result, err
+		}
+	}
+
+	for i := range segments {
+		res := &result.Segments[i]
+		resp, err := s.waitResponse(ctx, waiters[i], sentAt[i])
+		if err == nil {
+			err = resp.err
+		}
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				failSegments(result.Segments[i:], fmt.Errorf("%w: %w", sender.Interrupted, ctxErr))
+				return result, ctxErr
+			}
+			res.Err = err
+			continue
+		}
+
+		res.Sequence = uint32(resp.sequence)
+		res.Retries = resp.retries
+		res.Status = resp.status
+		res.MessageID = resp.messageID
+		if resp.sentAt.IsZero() {
+			resp.sentAt = sentAt[i]
+		}
+		res.Latency = resp.at.Sub(resp.sentAt)
+	}
+
+	return result, nil
+}
+
+// submit sends a segment once the throughput limit allows it and there is a
+// free slot in the outstanding window. It returns the time the segment was
+// sent at.
+func (s *Session) submit(ctx context.Context, tr gosmpp.Transmitter, out *outgoing) (time.Time, error) {
+	err := s.throttle.wait(ctx, s.done)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	seq := out.seg.pd.SequenceNumber
+	err = s.window.acquire(ctx, s.done, seq)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	sentAt := time.Now()
+	out.sentAt = sentAt
+	receipt := out.seg.pd.RegisteredDelivery&data.SM_SMSC_RECEIPT_MASK == data.SM_SMSC_RECEIPT_REQUESTED
+	s.mu.Lock()
+	if s.throughput.MaxRetries > 0 {
+		s.outgoing[seq] = out
+	}
+	s.pending[seq] = pendingSubmit{sentAt: sentAt, receipt: receipt}
+	s.mu.Unlock()
+
+	info := out.pduInfo()
+	s.tracker.track(sender.SubmitSM, seq, sentAt)
+	err = tr.Submit(out.seg.pd)
+	if err != nil {
+		s.tracker.forget(seq)
+		s.window.release(seq)
+		s.mu.Lock()
+		delete(s.outgoing, seq)
+		delete(s.pending, seq)
+		s.mu.Unlock()
+		return time.Time{}, err
+	}
+
+	s.handler(sender.Outbound, info)
+	return sentAt, nil
+}
+
+// handleSubmitResp processes submit_sm_resp and generic_nack to submit_sm.
+// Segments rejected due to throttling are resubmitted after backoff.
+func (s *Session) handleSubmitResp(seq int32, status sender.CommandStatus, messageID string) {
+	now := time.Now()
+	s.window.release(seq)
+
+	s.mu.Lock()
+	out, ok := s.outgoing[seq]
+	delete(s.outgoing, seq)
+	submitted := s.pending[seq]
+	delete(s.pending, seq)
+	tr := s.tr
+	s.mu.Unlock()
+
+	if submitted.receipt && status == sender.ESME_ROK && messageID != "" {
+		s.tracker.expectReceipt(messageID)
+	}
+
+	retries := 0
+	var sentAt time.Time
+	if ok {
+		retries = out.retries
+		sentAt = out.sentAt
+	}
+
+	if !isThrottlingStatus(status) {
+		s.throttle.recovered()
+	} else {
+		s.throttle.throttled(submitted.sentAt)
+		if ok && tr != nil && out.retries < s.throughput.MaxRetries {
+			go s.retry(tr, out)
+			return
+		}
+	}
+
+	s.resolveWaiter(seq, submitResp{
+		sequence:  seq,
+		retries:   retries,
+		status:    status,
+		messageID: messageID,
+		sentAt:    sentAt,
+		at:        now,
+	})
+}
+
+func (s *Session) retry(tr gosmpp.Transmitter, out *outgoing) {
+	// The previous submission may still be referenced by gosmpp, so the
+	// retry gets its own copy of PDU with a new sequence number.
+	pd := *out.seg.pd
+	pd.AssignSequenceNumber()
+	next := &outgoing{
+		seg:            out.seg,
+		isMultiSegment: out.isMultiSegment,
+		retries:        out.retries + 1,
+	}
+	next.seg.pd = &pd
+	oldSeq := out.seg.pd.SequenceNumber
+	newSeq := pd.SequenceNumber
+
+	s.mu.Lock()
+	waiter, ok := s.waiters[oldSeq]
+	if ok {
+		delete(s.waiters, oldSeq)
+		s.waiters[newSeq] = waiter
+	}
+	s.mu.Unlock()
+
+	notify := func(resp submitResp) {
+		if !ok {
+			return
+		}
+		select {
+		case waiter <- resp:
+		default:
+		}
+	}
+
+	// The waiter's response timer is paused until the segment is sent again,
+	// since backoff may take longer than response timeout.
+	notify(submitResp{sequence: newSeq, retries: next.retries, retrying: true})
+	sentAt, err := s.submit(context.Background(), tr, next)
+	if err != nil {
+		s.mu.Lock()
+		delete(s.waiters, newSeq)
+		s.mu.Unlock()
+		notify(submitResp{sequence: newSeq, retries: next.retries, at: time.Now(), err: err})
+		return
+	}
+	notify(submitResp{sequence: newSeq, retries: next.retries, retrying: true, at: sentAt})
+}
+
+func (s *Session) waitResponse(
+	ctx context.Context,
+	waiter chan submitResp,
+	sentAt time.Time,
+) (submitResp, error) {
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	if s.timing.ResponseTimeout > 0 {
+		timer = time.NewTimer(time.Until(sentAt.Add(s.timing.ResponseTimeout)))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		// Events that are already queued take priority over the timer, which
+		// may have expired while earlier segments were awaited.
+		var resp submitResp
+		select {
+		case resp = <-waiter:
+		default:
+			select {
+			case resp = <-waiter:
+			case <-timeout:
+				return submitResp{}, NoResponse
+			case <-ctx.Done():
+				return submitResp{}, ctx.Err()
+			}
+		}
+
+		if !resp.retrying {
+			return resp, nil
+		}
+		if timer == nil {
+			continue
+		}
+		if resp.at.IsZero() {
+			timer.Stop()
+		} else {
+			timer.Reset(time.Until(resp.at.Add(s.timing.ResponseTimeout)))
+		}
+	}
+}
+
+func failSegments(segments []sender.SegmentResult, err error) {
+	for i := range segments {
+		segments[i].Err = err
+	}
+}
+
+func (s *Session) addWaiter(seq int32) chan submitResp {
+	// Room for every retry notification and the final response, so that
+	// notifying never blocks the receiving goroutine.
+	waiter := make(chan submitResp, 2*s.throughput.MaxRetries+1)
+	s.mu.Lock()
+	s.waiters[seq] = waiter
+	s.mu.Unlock()
+	return waiter
+}
+
+func (s *Session) resolveWaiter(seq int32, resp submitResp) {
+	s.mu.Lock()
+	waiter, ok := s.waiters[seq]
+	delete(s.waiters, seq)
+	s.mu.Unlock()
+
+	if ok {
+		select {
+		case waiter <- resp:
+		default:
+		}
+	}
+}
+
+// dropWaiters removes waiters by identity, since retried segments are
+// registered under new sequence numbers.
+func (s *Session) dropWaiters(waiters []chan submitResp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for seq, waiter := range s.waiters {
+		for _, w := range waiters {
+			if waiter == w {
+				delete(s.waiters, seq)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package smpp
+
+import (
+	"context"
+	"errors"
+	"smppizdez/sender"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendInterrupted(t *testing.T) {
+	smsc := startTestSMSC(t)
+	smsc.silent = true
+	acc := smsc.account()
+	acc.Timing.ResponseTimeout = time.Minute
+
+	session, err := startSession(
+		&acc,
+		acc.BindType,
+		newSessionTracker(acc.Timing, func(sender.Direction, sender.PDU) {}),
+		newRefCounter(),
+		func(sender.Direction, sender.PDU) {},
+		func(error) {},
+		func(sender.ReconnectEvent) {},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req := testRequest(strings.Repeat("a", 200))
+	res, err := session.Send(ctx, req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if len(res.Segments) != 2 {
+		t.Fatalf("got %d segment(s), want 2", len(res.Segments))
+	}
+	for i, seg := range res.Segments {
+		if !errors.Is(seg.Err, sender.Interrupted) || !errors.Is(seg.Err, context.DeadlineExceeded) {
+			t.Fatalf("segment %d error is %v, want interrupted", i, seg.Err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package smpp
+
+import (
+	"fmt"
+	"net"
+	"smppizdez/account"
+	"smppizdez/coding"
+	"smppizdez/sender"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linxGnu/gosmpp"
+	"github.com/linxGnu/gosmpp/data"
+	"github.com/linxGnu/gosmpp/pdu"
+)
+
+// testSMSC is an in-process SMSC answering bind, enquire_link, unbind and
+// submit_sm.
+type testSMSC struct {
+	ln net.Listener
+	// status, if not nil, returns the status of the nth submit_sm.
+	status func(n int) data.CommandStatusType
+	// receiptState, if not empty, makes every accepted submit_sm followed
+	// by a delivery receipt with this state.
+	receiptState string
+	// silent makes submit_sm and unbind go unanswered.
+	silent bool
+	// delay, if not nil, returns how long the response to the nth
+	// submit_sm is held back.
+	delay func(n int) time.Duration
+
+	mu      sync.Mutex
+	conns   []net.Conn
+	binds   map[net.Conn]pdu.BindingType
+	submits int
+}
+
+func startTestSMSC(t *testing.T) *testSMSC {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSMSC{ln: ln, binds: make(map[net.Conn]pdu.BindingType)}
+	t.Cleanup(func() {
+		ln.Close()
+		s.dropConnections()
+	})
+	go s.serve()
+	return s
+}
+
+func (s *testSMSC) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, c)
+		s.mu.Unlock()
+		go s.handle(c)
+	}
+}
+
+func (s *testSMSC) handle(c net.Conn) {
+	defer c.Close()
+	conn := gosmpp.NewConnection(c)
+	var writeMu sync.Mutex
+	write := func(p pdu.PDU) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.WritePDU(p)
+	}
+
+	for {
+		p, err := pdu.Parse(c)
+		if err != nil {
+			return
+		}
+		switch p := p.(type) {
+		case *pdu.BindRequest:
+			s.mu.Lock()
+			s.binds[c] = p.BindingType
+			s.mu.Unlock()
+			write(p.GetResponse())
+		case *pdu.EnquireLink:
+			write(p.GetResponse())
+		case *pdu.Unbind:
+			if s.silent {
+				continue
+			}
+			write(p.GetResponse())
+			return
+		case *pdu.SubmitSM:
+			if s.silent {
+				continue
+			}
+			s.mu.Lock()
+			s.submits++
+			n := s.submits
+			s.mu.Unlock()
+
+			resp := p.GetResponse().(*pdu.SubmitSMResp)
+			if s.status != nil {
+				resp.CommandStatus = s.status(n)
+			}
+			id := fmt.Sprintf("m%d", n)
+			resp.MessageID = id
+			respond := func() {
+				write(resp)
+				if s.receiptState != "" && resp.CommandStatus == data.ESME_ROK {
+					d := pdu.NewDeliverSM().(*pdu.DeliverSM)
+					d.EsmClass = data.SM_SMSC_DLV_RCPT_TYPE
+					text := fmt.Sprintf("id:%s sub:001 dlvrd:001 stat:%s err:000", id, s.receiptState)
+					d.Message.SetMessageWithEncoding(text, data.GSM7BITPACKED)
+					write(d)
+				}
+			}
+			if s.delay == nil {
+				respond()
+				continue
+			}
+			go func() {
+				time.Sleep(s.delay(n))
+				respond()
+			}()
+		}
+	}
+}
+
+// dropBinds closes connections bound as typ.
+func (s *testSMSC) dropBinds(typ pdu.BindingType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c, bound := range s.binds {
+		if bound == typ {
+			c.Close()
+			delete(s.binds, c)
+		}
+	}
+}
+
+// dropConnections closes every connection accepted so far.
+func (s *testSMSC) dropConnections() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = nil
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+func (s *testSMSC) account() account.Account {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return account.Account{
+		Host:          "127.0.0.1",
+		Port:          uint16(addr.Port),
+		SystemID:      "test",
+		Password:      "test",
+		BindType:      account.Transceiver,
+		DefaultCoding: coding.GSM7,
+		Timing: account.SessionTiming{
+			ReadTimeout:     time.Minute,
+			WriteTimeout:    time.Minute,
+			BindTimeout:     time.Second,
+			ResponseTimeout: time.Second,
+			UnbindTimeout:   200 * time.Millisecond,
+		},
+	}
+}
+
+// testRequest returns a GSM7 request with the given text.
+func testRequest(text string) *sender.Request {
+	return &sender.Request{
+		Source:          sender.Address{TON: sender.TONUnknown, NPI: sender.NPIUnknown, Addr: "1"},
+		Destination:     sender.Address{TON: sender.TONUnknown, NPI: sender.NPIUnknown, Addr: "2"},
+		Message:         text,
+		EffectiveCoding: coding.GSM7,
+		DeceptiveCoding: coding.GSM7,
+		SplitMode:       sender.SplitUDH,
+		ConcatIE:        sender.Concat8Bit,
+		RefMode:         sender.RefAuto,
+		BytePerSegment:  140,
+		Ports:           sender.ApplicationPorts{Addressing: sender.PortsNone},
+	}
+}
@@ -0,0 +1,76 @@
+package smpp
+
+import (
+	"slices"
+	"smppizdez/sender"
+	"sync"
+)
+
+// stateTransitions lists states reachable from every state. Closed is
+// final.
+var stateTransitions = map[sender.SessionState][]sender.SessionState{
+	sender.StateConnecting: {
+		sender.StateBound,
+		sender.StateUnbinding,
+		sender.StateClosed,
+	},
+	sender.StateBound: {
+		sender.StateUnbinding,
+		sender.StateReconnecting,
+		sender.StateClosed,
+	},
+	sender.StateReconnecting: {
+		sender.StateBound,
+		sender.StateUnbinding,
+		sender.StateClosed,
+	},
+	sender.StateUnbinding: {
+		sender.StateClosed,
+	},
+}
+
+// stateMachine holds session state. Transitions are atomic and reported to
+// onChange in the order they were made.
+type stateMachine struct {
+	onChange sender.StateHandler
+
+	// notify is held while onChange runs, so that reports are not reordered.
+	notify sync.Mutex
+	mu     sync.Mutex
+	state  sender.SessionState
+}
+
+func newStateMachine(onChange sender.StateHandler) *stateMachine {
+	return &stateMachine{onChange: onChange, state: sender.StateConnecting}
+}
+
+func (m *stateMachine) get() sender.SessionState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// is reports whether the current state is one of states.
+func (m *stateMachine) is(states ...sender.SessionState) bool {
+	return slices.Contains(states, m.get())
+}
+
+// transition moves to state to, if it is reachable from the current one. It
+// returns the state it moved from and whether the transition was made.
+func (m *stateMachine) transition(to sender.SessionState) (sender.SessionState, bool) {
+	m.notify.Lock()
+	defer m.notify.Unlock()
+
+	m.mu.Lock()
+	from := m.state
+	ok := slices.Contains(stateTransitions[from], to)
+	if ok {
+		m.state = to
+	}
+	m.mu.Unlock()
+
+	if ok && m.onChange != nil {
+		m.onChange(to)
+	}
+	return from, ok
+}
@@ -0,0 +1,190 @@
+package smpp
+
+import (
+	"math/rand/v2"
+	"slices"
+	"smppizdez/account"
+	"smppizdez/sender"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stateRecorder collects states published by a state machine.
+type stateRecorder struct {
+	mu     sync.Mutex
+	states []sender.SessionState
+}
+
+func (r *stateRecorder) add(state sender.SessionState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, state)
+}
+
+func (r *stateRecorder) get() []sender.SessionState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.states)
+}
+
+// checkStates fails unless states is a path of legal transitions from
+// initial, with closed published at most once and last.
+func checkStates(t *testing.T, initial sender.SessionState, states []sender.SessionState) {
+	t.Helper()
+	from := initial
+	for i, to := range states {
+		if !slices.Contains(stateTransitions[from], to) {
+			t.Fatalf("illegal transition %v -> %v at %d in %v", from, to, i, states)
+		}
+		from = to
+	}
+	if idx := slices.Index(states, sender.StateClosed); idx >= 0 && idx != len(states)-1 {
+		t.Fatalf("closed is not the last state in %v", states)
+	}
+}
+
+func TestStateMachineTransition(t *testing.T) {
+	tests := []struct {
+		from sender.SessionState
+		to   sender.SessionState
+		ok   bool
+	}{
+		{sender.StateConnecting, sender.StateBound, true},
+		{sender.StateConnecting, sender.StateReconnecting, false},
+		{sender.StateConnecting, sender.StateClosed, true},
+		{sender.StateBound, sender.StateBound, false},
+		{sender.StateBound, sender.StateReconnecting, true},
+		{sender.StateBound, sender.StateUnbinding, true},
+		{sender.StateReconnecting, sender.StateBound, true},
+		{sender.StateReconnecting, sender.StateReconnecting, false},
+		{sender.StateUnbinding, sender.StateBound, false},
+		{sender.StateUnbinding, sender.StateReconnecting, false},
+		{sender.StateUnbinding, sender.StateClosed, true},
+		{sender.StateClosed, sender.StateBound, false},
+		{sender.StateClosed, sender.StateReconnecting, false},
+		{sender.StateClosed, sender.StateClosed, false},
+	}
+
+	for _, tt := range tests {
+		var rec stateRecorder
+		m := newStateMachine(rec.add)
+		m.state = tt.from
+
+		prev, ok := m.transition(tt.to)
+		if prev != tt.from || ok != tt.ok {
+			t.Errorf("%v -> %v: got (%v, %v), want (%v, %v)", tt.from, tt.to, prev, ok, tt.from, tt.ok)
+		}
+		want := tt.from
+		var published []sender.SessionState
+		if tt.ok {
+			want = tt.to
+			published = []sender.SessionState{tt.to}
+		}
+		if got := m.get(); got != want {
+			t.Errorf("%v -> %v: state is %v, want %v", tt.from, tt.to, got, want)
+		}
+		if got := rec.get(); !slices.Equal(got, published) {
+			t.Errorf("%v -> %v: published %v, want %v", tt.from, tt.to, got, published)
+		}
+	}
+}
+
+func TestStateMachineConcurrentTransitions(t *testing.T) {
+	targets := []sender.SessionState{
+		sender.StateBound,
+		sender.StateReconnecting,
+		sender.StateUnbinding,
+		sender.StateClosed,
+	}
+
+	for range 50 {
+		var rec stateRecorder
+		m := newStateMachine(rec.add)
+		made := make([]int, len(targets))
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 200 {
+					i := rand.IntN(len(targets))
+					if _, ok := m.transition(targets[i]); ok {
+						mu.Lock()
+						made[i]++
+						mu.Unlock()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		states := rec.get()
+		checkStates(t, sender.StateConnecting, states)
+		// Every transition made is published exactly once.
+		for i, target := range targets {
+			published := 0
+			for _, state := range states {
+				if state == target {
+					published++
+				}
+			}
+			if published != made[i] {
+				t.Fatalf("%v made %d time(s), published %d time(s)", target, made[i], published)
+			}
+		}
+	}
+}
+
+// TestSessionCloseRace closes a session while the SMSC drops its
+// connection, so that Close races closedHandler, reconnectLoop and bind.
+func TestSessionCloseRace(t *testing.T) {
+	smsc := startTestSMSC(t)
+	acc := smsc.account()
+	acc.Reconnect = account.ReconnectPolicy{Enabled: true, Delay: 5 * time.Millisecond, MaxDelay: 20 * time.Millisecond}
+
+	for i := range 30 {
+		// Buffered, so that a duplicate close doesn't block and is counted.
+		closed := make(chan error, 4)
+		onClose := func(err error) { closed <- err }
+
+		session, err := startSession(
+			&acc,
+			acc.BindType,
+			newSessionTracker(acc.Timing, func(sender.Direction, sender.PDU) {}),
+			newRefCounter(),
+			func(sender.Direction, sender.PDU) {},
+			onClose,
+			func(sender.ReconnectEvent) {},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rec stateRecorder
+		session.state.notify.Lock()
+		session.state.onChange = rec.add
+		session.state.notify.Unlock()
+
+		go smsc.dropConnections()
+		time.Sleep(time.Duration(i) * time.Millisecond)
+		session.Close()
+
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("iteration %d: session not closed, states %v", i, rec.get())
+		}
+		// Give a late duplicate close a chance to show up.
+		time.Sleep(20 * time.Millisecond)
+
+		states := rec.get()
+		checkStates(t, sender.StateBound, states)
+		if len(states) == 0 || states[len(states)-1] != sender.StateClosed {
+			t.Fatalf("iteration %d: session didn't end closed: %v", i, states)
+		}
+		if n := len(closed); n > 0 {
+			t.Fatalf("iteration %d: onClose called %d more time(s)", i, n)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package smpp
+
+import (
+	"slices"
+	"smppizdez/sender"
+	"sync"
+	"time"
+)
+
+type pendingRequest struct {
+	command sender.Command
+	sentAt  time.Time
+	timer   *time.Timer
+}
+
+type commandStats struct {
+	latencies LatencySample
+	missing   int
+}
+
+// tracker follows outbound requests until their responses arrive, collecting
+// response times and reporting requests left without response. It also
+// keeps message IDs of submitted messages awaiting delivery receipt.
+type tracker struct {
+	timeout   time.Duration
+	onMissing func(sender.Command, int32)
+
+	mu       sync.Mutex
+	pending  map[int32]*pendingRequest
+	stats    map[sender.Command]*commandStats
+	receipts map[string]struct{}
+}
+
+func newTracker(timeout time.Duration, onMissing func(sender.Command, int32)) *tracker {
+	return &tracker{
+		timeout:   timeout,
+		onMissing: onMissing,
+		pending:   make(map[int32]*pendingRequest),
+		stats:     make(map[sender.Command]*commandStats),
+		receipts:  make(map[string]struct{}),
+	}
+}
+
+func (t *tracker) track(cmd sender.Command, seq int32, sentAt time.Time) {
+	req := &pendingRequest{command: cmd, sentAt: sentAt}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timeout > 0 {
+		req.timer = time.AfterFunc(t.timeout, func() { t.expire(seq, req) })
+	}
+	t.pending[seq] = req
+}
+
+// forget drops a request that failed to be sent.
+func (t *tracker) forget(seq int32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if req, ok := t.pending[seq]; ok {
+		delete(t.pending, seq)
+		if req.timer != nil {
+			req.timer.Stop()
+		}
+	}
+}
+
+// clear drops all pending requests and receipts without reporting them,
+// once the session is closed.
+func (t *tracker) clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for seq, req := range t.pending {
+		delete(t.pending, seq)
+		if req.timer != nil {
+			req.timer.Stop()
+		}
+	}
+	clear(t.receipts)
+}
+
+func (t *tracker) expectReceipt(messageID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.receipts[messageID] = struct{}{}
+}
+
+func (t *tracker) receiptArrived(messageID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.receipts, messageID)
+}
+
+func (t *tracker) pendingReceipts() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.receipts)
+}
+
+func (t *tracker) resolve(seq int32, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	req, ok := t.pending[seq]
+	if !ok {
+		return
+	}
+	delete(t.pending, seq)
+	if req.timer != nil {
+		req.timer.Stop()
+	}
+
+	stats := t.commandStats(req.command)
+	stats.latencies.Add(at.Sub(req.sentAt))
+}
+
+func (t *tracker) expire(seq int32, req *pendingRequest) {
+	t.mu.Lock()
+	if t.pending[seq] != req {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.pending, seq)
+	t.commandStats(req.command).missing++
+	t.mu.Unlock()
+
+	t.onMissing(req.command, seq)
+}
+
+func (t *tracker) commandStats(cmd sender.Command) *commandStats {
+	stats, ok := t.stats[cmd]
+	if !ok {
+		stats = &commandStats{}
+		t.stats[cmd] = stats
+	}
+	return stats
+}
+
+func (t *tracker) report() []sender.ResponseStats {
+	t.mu.Lock()
+	result := make([]sender.ResponseStats, 0, len(t.stats))
+	samples := make([][]time.Duration, 0, len(t.stats))
+	for cmd, stats := range t.stats {
+		result = append(result, sender.ResponseStats{
+			Command: cmd,
+			Count:   stats.latencies.Count(),
+			Missing: stats.missing,
+			Min:     stats.latencies.Min(),
+			Avg:     stats.latencies.Avg(),
+		})
+		samples = append(samples, stats.latencies.Sorted())
+	}
+	t.mu.Unlock()
+
+	for i, sorted := range samples {
+		result[i].P95 = Percentile(sorted, 95)
+		result[i].P99 = Percentile(sorted, 99)
+	}
+
+	slices.SortFunc(result, func(a, b sender.ResponseStats) int {
+		return int(a.Command) - int(b.Command)
+	})
+	return result
+}
@@ -0,0 +1,79 @@
+package smpp
+
+import (
+	"smppizdez/sender"
+	"testing"
+	"time"
+)
+
+func TestTrackerReport(t *testing.T) {
+	missing := make(chan int32, 1)
+	tr := newTracker(20*time.Millisecond, func(cmd sender.Command, seq int32) {
+		if cmd != sender.EnquireLink {
+			t.Errorf("got missing %v, want enquire_link", cmd)
+		}
+		missing <- seq
+	})
+
+	now := time.Now()
+	tr.track(sender.SubmitSM, 1, now)
+	tr.track(sender.SubmitSM, 2, now)
+	tr.track(sender.EnquireLink, 3, now)
+	tr.track(sender.SubmitSM, 4, now)
+	tr.resolve(1, now.Add(2*time.Millisecond))
+	tr.resolve(2, now.Add(4*time.Millisecond))
+	tr.forget(4)
+
+	select {
+	case seq := <-missing:
+		if seq != 3 {
+			t.Fatalf("got missing response to %d, want 3", seq)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("missing response wasn't reported")
+	}
+	// Responses arriving after response timeout aren't counted.
+	tr.resolve(3, time.Now())
+
+	got := tr.report()
+	want := []sender.ResponseStats{
+		{Command: sender.SubmitSM, Count: 2, Min: 2 * time.Millisecond, Avg: 3 * time.Millisecond, P95: 4 * time.Millisecond, P99: 4 * time.Millisecond},
+		{Command: sender.EnquireLink, Missing: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %+v, want %+v", got[i], want[i])
+		}
+	}
+
+	select {
+	case seq := <-missing:
+		t.Fatalf("got missing response to %d, which was resolved or forgotten", seq)
+	case <-time.After(40 * time.Millisecond):
+	}
+}
+
+func TestTrackerClear(t *testing.T) {
+	tr := newTracker(10*time.Millisecond, func(cmd sender.Command, seq int32) {
+		t.Errorf("got missing response to %d after clear", seq)
+	})
+	tr.track(sender.SubmitSM, 1, time.Now())
+	tr.expectReceipt("m1")
+	tr.expectReceipt("m2")
+	tr.receiptArrived("m1")
+	if n := tr.pendingReceipts(); n != 1 {
+		t.Fatalf("got %d pending receipt(s), want 1", n)
+	}
+
+	tr.clear()
+	if n := tr.pendingReceipts(); n != 0 {
+		t.Fatalf("got %d pending receipt(s) after clear, want 0", n)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if stats := tr.report(); len(stats) != 0 {
+		t.Fatalf("got %+v after clear, want nothing", stats)
+	}
+}
@@ -0,0 +1,121 @@
+package smpp
+
+import (
+	"context"
+	"smppizdez/sender"
+	"sync"
+	"time"
+)
+
+const (
+	// minThrottleBackoff keeps zero retry delay from resubmitting throttled
+	// messages right away to the SMSC that asked to slow down.
+	minThrottleBackoff = 100 * time.Millisecond
+	maxThrottleBackoff = time.Minute
+)
+
+// throttle is a token bucket limiting the rate of submit_sm requests. It is
+// also paused for an exponentially growing period whenever SMSC reports
+// throttling.
+type throttle struct {
+	rate       float64
+	burst      float64
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu      sync.Mutex
+	tokens  float64
+	last    time.Time
+	backoff time.Duration
+	// pausedAt is when the last pause started, until is when it ends.
+	pausedAt time.Time
+	until    time.Time
+}
+
+func newThrottle(tps int, burst int, retryDelay time.Duration) *throttle {
+	burst = max(burst, 1)
+	return &throttle{
+		rate:       float64(tps),
+		burst:      float64(burst),
+		minBackoff: max(retryDelay, minThrottleBackoff),
+		maxBackoff: max(retryDelay, maxThrottleBackoff),
+		tokens:     float64(burst),
+		last:       time.Now(),
+	}
+}
+
+func (t *throttle) wait(ctx context.Context, done <-chan struct{}) error {
+	for {
+		delay := t.reserve()
+		if delay <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-done:
+			timer.Stop()
+			return SessionClosed
+		}
+	}
+}
+
+// reserve takes a token and returns zero, or returns how long to wait before
+// trying again.
+func (t *throttle) reserve() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(t.until) {
+		return t.until.Sub(now)
+	}
+	if t.rate <= 0 {
+		return 0
+	}
+
+	t.tokens = min(t.burst, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+	t.last = now
+	if t.tokens >= 1 {
+		t.tokens--
+		return 0
+	}
+	return time.Duration((1 - t.tokens) / t.rate * float64(time.Second))
+}
+
+// throttled pauses sending after a throttling response to a request sent at
+// sentAt, which is zero if unknown. Responses arriving during the pause or to
+// requests sent before it started, even if they arrive after it ended, don't
+// prolong it, so a burst of throttling responses counts only once.
+func (t *throttle) throttled(sentAt time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(t.until) || (!sentAt.IsZero() && sentAt.Before(t.pausedAt)) {
+		return max(t.until.Sub(now), 0)
+	}
+
+	if t.backoff == 0 {
+		t.backoff = t.minBackoff
+	} else {
+		t.backoff = min(t.backoff*2, t.maxBackoff)
+	}
+	t.pausedAt = now
+	t.until = now.Add(t.backoff)
+	return t.backoff
+}
+
+func (t *throttle) recovered() {
+	t.mu.Lock()
+	t.backoff = 0
+	t.mu.Unlock()
+}
+
+func isThrottlingStatus(status sender.CommandStatus) bool {
+	return status == sender.ESME_RTHROTTLED || status == sender.ESME_RMSGQFUL
+}
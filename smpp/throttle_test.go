@@ -0,0 +1,203 @@
+package smpp
+
+import (
+	"context"
+	"smppizdez/account"
+	"smppizdez/sender"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linxGnu/gosmpp/data"
+)
+
+func TestThrottleBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryDelay time.Duration
+		want       []time.Duration
+	}{
+		{
+			name:       "zero delay",
+			retryDelay: 0,
+			want:       []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond},
+		},
+		{
+			name:       "doubles up to max",
+			retryDelay: 20 * time.Second,
+			want:       []time.Duration{20 * time.Second, 40 * time.Second, time.Minute, time.Minute},
+		},
+		{
+			name:       "delay over max",
+			retryDelay: 2 * time.Minute,
+			want:       []time.Duration{2 * time.Minute, 2 * time.Minute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := newThrottle(0, 1, tt.retryDelay)
+			for i, want := range tt.want {
+				// Let the previous pause expire.
+				th.until = time.Time{}
+				if got := th.throttled(time.Now()); got != want {
+					t.Fatalf("backoff %d is %v, want %v", i, got, want)
+				}
+			}
+
+			th.recovered()
+			th.until = time.Time{}
+			if got := th.throttled(time.Now()); got != tt.want[0] {
+				t.Fatalf("backoff after recovery is %v, want %v", got, tt.want[0])
+			}
+		})
+	}
+}
+
+func TestThrottleBurstDoesntProlongPause(t *testing.T) {
+	th := newThrottle(0, 1, time.Second)
+	first := th.throttled(time.Now())
+	second := th.throttled(time.Now())
+	if first != time.Second || second > first {
+		t.Fatalf("pauses are %v and %v, want 1s and at most 1s", first, second)
+	}
+	if delay := th.reserve(); delay <= 0 {
+		t.Fatal("token reserved while paused")
+	}
+}
+
+func TestThrottleLateResponseDoesntProlongPause(t *testing.T) {
+	th := newThrottle(0, 1, time.Second)
+	sentAt := time.Now()
+	if got := th.throttled(sentAt); got != time.Second {
+		t.Fatalf("first pause is %v, want 1s", got)
+	}
+
+	// The pause has ended by the time a response to a request sent before
+	// it arrives.
+	th.until = time.Now()
+	if got := th.throttled(sentAt); got != 0 {
+		t.Fatalf("late response paused sending for %v", got)
+	}
+	if got := th.throttled(time.Time{}); got != 2*time.Second {
+		t.Fatalf("pause without send time is %v, want 2s", got)
+	}
+}
+
+func TestThrottleRate(t *testing.T) {
+	tests := []struct {
+		name  string
+		tps   int
+		burst int
+		// free is the number of tokens available at once.
+		free int
+	}{
+		{name: "unlimited", tps: 0, burst: 1, free: 100},
+		{name: "burst of one", tps: 10, burst: 1, free: 1},
+		{name: "burst of five", tps: 10, burst: 5, free: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := newThrottle(tt.tps, tt.burst, time.Second)
+			for i := range tt.free {
+				if delay := th.reserve(); delay != 0 {
+					t.Fatalf("token %d delayed by %v", i, delay)
+				}
+			}
+			if tt.tps == 0 {
+				return
+			}
+			delay := th.reserve()
+			if interval := time.Second / time.Duration(tt.tps); delay <= 0 || delay > interval {
+				t.Fatalf("token over burst delayed by %v, want up to %v", delay, interval)
+			}
+		})
+	}
+}
+
+func TestThrottledSegmentRetriedAfterBackoff(t *testing.T) {
+	smsc := startTestSMSC(t)
+	smsc.status = func(n int) data.CommandStatusType {
+		if n <= 2 {
+			return data.ESME_RTHROTTLED
+		}
+		return data.ESME_ROK
+	}
+	acc := smsc.account()
+	acc.Throughput = account.Throughput{Burst: 1, MaxRetries: 3}
+
+	session, err := startSession(
+		&acc,
+		acc.BindType,
+		newSessionTracker(acc.Timing, func(sender.Direction, sender.PDU) {}),
+		newRefCounter(),
+		func(sender.Direction, sender.PDU) {},
+		func(error) {},
+		func(sender.ReconnectEvent) {},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	start := time.Now()
+	res, err := session.Send(context.Background(), testRequest("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seg := res.Segments[0]
+	if seg.Err != nil || seg.Status != sender.ESME_ROK || seg.Retries != 2 {
+		t.Fatalf("got status %v after %d retries (error %v), want ESME_ROK after 2", seg.Status, seg.Retries, seg.Err)
+	}
+	// Backoff of 100ms and 200ms with zero retry delay.
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Fatalf("retried within %v, faster than the minimum backoff", elapsed)
+	}
+}
+
+func TestLateThrottledResponseWithoutRetries(t *testing.T) {
+	smsc := startTestSMSC(t)
+	smsc.status = func(int) data.CommandStatusType { return data.ESME_RTHROTTLED }
+	// The second response arrives after the pause started by the first one
+	// is over.
+	smsc.delay = func(n int) time.Duration {
+		if n == 1 {
+			return 50 * time.Millisecond
+		}
+		return 300 * time.Millisecond
+	}
+	acc := smsc.account()
+	acc.Throughput = account.Throughput{Burst: 2}
+
+	session, err := startSession(
+		&acc,
+		acc.BindType,
+		newSessionTracker(acc.Timing, func(sender.Direction, sender.PDU) {}),
+		newRefCounter(),
+		func(sender.Direction, sender.PDU) {},
+		func(error) {},
+		func(sender.ReconnectEvent) {},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session.Send(context.Background(), testRequest("hello"))
+		}()
+	}
+	wg.Wait()
+
+	session.throttle.mu.Lock()
+	backoff := session.throttle.backoff
+	session.throttle.mu.Unlock()
+	if backoff != minThrottleBackoff {
+		t.Fatalf("backoff is %v, want %v", backoff, minThrottleBackoff)
+	}
+}
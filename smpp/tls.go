@@ -0,0 +1,136 @@
+package smpp
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"smppizdez/account"
+	"strings"
+	"time"
+
+	"github.com/linxGnu/gosmpp"
+)
+
+var (
+	PinMismatch        = errors.New("Server certificate doesn't match any pinned fingerprint")
+	InvalidTLSVersions = errors.New("Minimum TLS version is above maximum")
+)
+
+var tlsVersions = map[account.TLSVersion]uint16{
+	account.TLS10: tls.VersionTLS10,
+	account.TLS11: tls.VersionTLS11,
+	account.TLS12: tls.VersionTLS12,
+	account.TLS13: tls.VersionTLS13,
+}
+
+// newTLSConfig builds the configuration of TLS connections. Without a
+// minimum version TLS 1.2 is required, or the maximum version if it's older.
+func newTLSConfig(s account.TLSSettings) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         s.ServerName,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+	}
+	if v, ok := tlsVersions[s.MaxVersion]; ok {
+		cfg.MaxVersion = v
+		cfg.MinVersion = min(cfg.MinVersion, v)
+	}
+	if v, ok := tlsVersions[s.MinVersion]; ok {
+		if cfg.MaxVersion != 0 && v > cfg.MaxVersion {
+			return nil, fmt.Errorf("%w: %v > %v", InvalidTLSVersions, s.MinVersion, s.MaxVersion)
+		}
+		cfg.MinVersion = v
+	}
+
+	if s.CAFile != "" {
+		pem, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", s.CAFile)
+		}
+	}
+
+	if s.CertFile != "" || s.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(s.PinnedSHA256) > 0 {
+		pins, err := parsePins(s.PinnedSHA256)
+		if err != nil {
+			return nil, err
+		}
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return PinMismatch
+			}
+
+			sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			if !slices.Contains(pins, sum) {
+				return fmt.Errorf("%w: %s", PinMismatch, hex.EncodeToString(sum[:]))
+			}
+			return nil
+		}
+	}
+
+	return cfg, nil
+}
+
+// parsePins decodes hex fingerprints, optionally separated by colons.
+func parsePins(pins []string) ([][sha256.Size]byte, error) {
+	result := make([][sha256.Size]byte, 0, len(pins))
+	for _, pin := range pins {
+		raw, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+		if err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("invalid SHA-256 fingerprint %s", pin)
+		}
+		result = append(result, [sha256.Size]byte(raw))
+	}
+	return result, nil
+}
+
+// tlsDialer establishes TLS with cfg over connections of base, verifying
+// host unless the server name is overridden. The handshake fails if it takes
+// longer than timeout, unless timeout is 0.
+func tlsDialer(base gosmpp.Dialer, cfg *tls.Config, host string, timeout time.Duration) gosmpp.Dialer {
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+
+	return func(addr string) (net.Conn, error) {
+		conn, err := base(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		tlsConn := tls.Client(conn, cfg)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
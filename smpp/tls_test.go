@@ -0,0 +1,41 @@
+package smpp
+
+import (
+	"crypto/tls"
+	"errors"
+	"smppizdez/account"
+	"testing"
+)
+
+func TestTLSConfigVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max account.TLSVersion
+		wantMin  uint16
+		wantMax  uint16
+		err      error
+	}{
+		{name: "default", wantMin: tls.VersionTLS12},
+		{name: "min only", min: account.TLS13, wantMin: tls.VersionTLS13},
+		{name: "old max lowers default min", max: account.TLS11, wantMin: tls.VersionTLS11, wantMax: tls.VersionTLS11},
+		{name: "range", min: account.TLS10, max: account.TLS12, wantMin: tls.VersionTLS10, wantMax: tls.VersionTLS12},
+		{name: "single version", min: account.TLS13, max: account.TLS13, wantMin: tls.VersionTLS13, wantMax: tls.VersionTLS13},
+		{name: "min above max", min: account.TLS13, max: account.TLS12, err: InvalidTLSVersions},
+		{name: "min above old max", min: account.TLS12, max: account.TLS10, err: InvalidTLSVersions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := newTLSConfig(account.TLSSettings{MinVersion: tt.min, MaxVersion: tt.max})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.MinVersion != tt.wantMin || cfg.MaxVersion != tt.wantMax {
+				t.Fatalf("got versions %#x-%#x, want %#x-%#x", cfg.MinVersion, cfg.MaxVersion, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package smpp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	WindowFull    = errors.New("Outstanding window is full")
+	SessionClosed = errors.New("Session is closed")
+)
+
+// window tracks submit_sm requests sent to SMSC until the matching
+// submit_sm_resp or generic_nack arrives.
+type window struct {
+	size  int
+	block bool
+	// expiry frees slots of requests that got no response for this long, so
+	// that a lost response doesn't shrink the window forever.
+	expiry time.Duration
+	slots  chan struct{}
+
+	mu       sync.Mutex
+	inFlight map[int32]*time.Timer
+}
+
+func newWindow(size int, block bool, expiry time.Duration) *window {
+	w := &window{
+		size:     size,
+		block:    block,
+		expiry:   expiry,
+		inFlight: make(map[int32]*time.Timer),
+	}
+	if size > 0 {
+		w.slots = make(chan struct{}, size)
+	}
+	return w
+}
+
+// acquire reserves a slot for request seq. The slot must be released with
+// release once the response arrives or the request fails to be sent, it is
+// released on its own after expiry otherwise.
+func (w *window) acquire(ctx context.Context, done <-chan struct{}, seq int32) error {
+	if w.slots != nil {
+		if w.block {
+			select {
+			case w.slots <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-done:
+				return SessionClosed
+			}
+		} else {
+			select {
+			case w.slots <- struct{}{}:
+			default:
+				return WindowFull
+			}
+		}
+	}
+
+	var timer *time.Timer
+	if w.expiry > 0 {
+		timer = time.AfterFunc(w.expiry, func() { w.release(seq) })
+	}
+
+	w.mu.Lock()
+	w.inFlight[seq] = timer
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *window) release(seq int32) {
+	w.mu.Lock()
+	timer, ok := w.inFlight[seq]
+	delete(w.inFlight, seq)
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if timer != nil {
+		timer.Stop()
+	}
+	if w.slots != nil {
+		<-w.slots
+	}
+}
+
+// releaseAll frees every slot, since responses to requests sent over a
+// closed connection will never arrive.
+func (w *window) releaseAll() {
+	w.mu.Lock()
+	seqs := make([]int32, 0, len(w.inFlight))
+	for seq := range w.inFlight {
+		seqs = append(seqs, seq)
+	}
+	w.mu.Unlock()
+
+	for _, seq := range seqs {
+		w.release(seq)
+	}
+}
+
+func (w *window) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.inFlight)
+}
@@ -3,11 +3,15 @@ package main
 import (
 	"encoding/hex"
 	"fmt"
+	"os"
 	"slices"
 	"smppizdez/account"
 	"smppizdez/coding"
 	"smppizdez/sender"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
@@ -37,6 +41,32 @@ var submitSmNpis = []sender.NPI{
 	sender.NPIWAP,
 }
 
+var submitSmConcatIEs = []sender.ConcatIE{sender.Concat8Bit, sender.Concat16Bit}
+
+var submitSmRefModes = []sender.RefMode{
+	sender.RefAuto,
+	sender.RefPerDestination,
+	sender.RefExplicit,
+}
+
+var submitSmPortAddressings = []sender.PortAddressing{
+	sender.PortsNone,
+	sender.Ports8Bit,
+	sender.Ports16Bit,
+}
+
+type portPreset struct {
+	source      uint16
+	destination uint16
+}
+
+var submitSmPortPresets = []portPreset{
+	{},
+	{source: 0, destination: sender.PortVCard},
+	{source: 0, destination: sender.PortVCalendar},
+	{source: sender.PortWAPConnectionless, destination: sender.PortWAPPush},
+}
+
 var submitSmStartSessionCallback func(*account.Account)
 
 type radioBtnSplitMode struct {
@@ -57,18 +87,49 @@ type submitSmContext struct {
 	validityEntry     *gtk.Entry
 	effCodingSelector *gtk.ComboBox
 	decCodingSelector *gtk.ComboBox
+	dcs               dcsBuilder
 	rdReqCheck        *gtk.CheckButton
 	rdFailCheck       *gtk.CheckButton
 	rdInterCheck      *gtk.CheckButton
 	messageEntry      *gtk.TextView
+	binaryCheck       *gtk.CheckButton
+	loadBinaryBtn     *gtk.Button
 	spltRadios        []radioBtnSplitMode
 	segmentBytesEntry *gtk.Entry
+	concatIESelector  *gtk.ComboBox
+	refModeSelector   *gtk.ComboBox
+	refEntry          *gtk.Entry
+	portsSelector     *gtk.ComboBox
+	portPresetSel     *gtk.ComboBox
+	srcPortEntry      *gtk.Entry
+	dstPortEntry      *gtk.Entry
 	messageLabel      *gtk.Label
 	logsArea          *gtk.TextView
 	logsScroller      *gtk.ScrolledWindow
 	unbindBtn         *gtk.Button
+	windowLabel       *gtk.Label
+	statsLabel        *gtk.Label
+	bindsLabel        *gtk.Label
+	requestMarks      map[uint32]*gtk.TextMark
+	closed            bool
 	tlvs              []tlvData
+	infoElements      []tlvData
+	supportedCodings  []coding.Coding
 	effectiveCoding   coding.Coding
+	bulkSend          bulkSend
+}
+
+type dcsBuilder struct {
+	overrideSwitch    *gtk.Switch
+	groupSelector     *gtk.ComboBox
+	alphabetSelector  *gtk.ComboBox
+	classSelector     *gtk.ComboBox
+	compressedSwitch  *gtk.Switch
+	indicationSel     *gtk.ComboBox
+	indicationActive  *gtk.Switch
+	rawEntry          *gtk.Entry
+	valueLabel        *gtk.Label
+	decCodingSelector *gtk.ComboBox
 }
 
 type tlvData struct {
@@ -115,6 +176,7 @@ func (ctx *submitSmContext) initCodingSelectors() {
 	effStore, _ := gtk.ListStoreNew(glib.TYPE_STRING)
 	supportedCodings := ctx.sender.SupportedCodings()
 	slices.Sort(supportedCodings)
+	ctx.supportedCodings = supportedCodings
 	for _, cod := range supportedCodings {
 		iter := effStore.Append()
 		effStore.Set(iter, []int{0}, []any{codingToString(cod)})
@@ -156,21 +218,34 @@ func (ctx *submitSmContext) initCodingSelectors() {
 	ctx.decCodingSelector.SetActive(decActiveIdx)
 }
 
-func (ctx *submitSmContext) initTLVForm(builder *gtk.Builder) {
+type editableFormIDs struct {
+	tree    string
+	menu    string
+	addItem string
+	delItem string
+}
+
+func initEditableForm(
+	builder *gtk.Builder,
+	ids editableFormIDs,
+	columns [2]string,
+	defaultKey string,
+	rows *[]tlvData,
+) {
 	store, _ := gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING)
-	tree := getTreeViewById(builder, "tlv_form")
+	tree := getTreeViewById(builder, ids.tree)
 	tree.SetModel(store)
 
-	addItem := getMenuItemById(builder, "add_tlv_item")
+	addItem := getMenuItemById(builder, ids.addItem)
 	addItem.Connect("button_release_event", func() {
 		iter := store.Append()
-		store.Set(iter, []int{0, 1}, []any{"0000", ""})
-		ctx.tlvs = append(ctx.tlvs, tlvData{tag: "0000", value: ""})
+		store.Set(iter, []int{0, 1}, []any{defaultKey, ""})
+		*rows = append(*rows, tlvData{tag: defaultKey, value: ""})
 	})
 
-	delItem := getMenuItemById(builder, "del_tlv_item")
+	delItem := getMenuItemById(builder, ids.delItem)
 	delItem.Connect("button_release_event", func() {
-		if len(ctx.tlvs) == 0 {
+		if len(*rows) == 0 {
 			return
 		}
 
@@ -178,27 +253,29 @@ func (ctx *submitSmContext) initTLVForm(builder *gtk.Builder) {
 		idx := path.GetIndices()[0]
 		iter, _ := store.GetIter(path)
 		store.Remove(iter)
-		ctx.tlvs = append(ctx.tlvs[:idx], ctx.tlvs[idx+1:]...)
+		*rows = append((*rows)[:idx], (*rows)[idx+1:]...)
 	})
 
-	for i, name := range []string{"Tag", "Value"} {
+	for i, name := range columns {
 		rend, _ := gtk.CellRendererTextNew()
 		rend.SetProperty("editable", true)
 		col, _ := gtk.TreeViewColumnNewWithAttribute(name, rend, "text", i)
 		tree.AppendColumn(col)
 
-		var handler func(string, string, *gtk.ListStore)
-		if i == 0 {
-			handler = ctx.tagEditedHandler
-		} else {
-			handler = ctx.valueEditedHandler
-		}
 		rend.Connect("edited", func(_ *gtk.CellRendererText, path, newText string) {
-			handler(path, newText, store)
+			iter, _ := store.GetIterFromString(path)
+			store.Set(iter, []int{i}, []any{newText})
+			treePath, _ := store.GetPath(iter)
+			idx := treePath.GetIndices()[0]
+			if i == 0 {
+				(*rows)[idx].tag = newText
+			} else {
+				(*rows)[idx].value = newText
+			}
 		})
 	}
 
-	menu := getMenuById(builder, "tlv_menu")
+	menu := getMenuById(builder, ids.menu)
 	tree.Connect("button_press_event", func(_ *gtk.TreeView, event *gdk.Event) bool {
 		btnEvent := gdk.EventButtonNewFromEvent(event)
 		if btnEvent.Button() == gdk.BUTTON_SECONDARY {
@@ -209,24 +286,8 @@ func (ctx *submitSmContext) initTLVForm(builder *gtk.Builder) {
 	})
 }
 
-func (ctx *submitSmContext) tagEditedHandler(path, newText string, store *gtk.ListStore) {
-	iter, _ := store.GetIterFromString(path)
-	store.Set(iter, []int{0}, []any{newText})
-	treePath, _ := store.GetPath(iter)
-	idx := treePath.GetIndices()[0]
-	ctx.tlvs[idx].tag = newText
-}
-
-func (ctx *submitSmContext) valueEditedHandler(path, newText string, store *gtk.ListStore) {
-	iter, _ := store.GetIterFromString(path)
-	store.Set(iter, []int{1}, []any{newText})
-	treePath, _ := store.GetPath(iter)
-	idx := treePath.GetIndices()[0]
-	ctx.tlvs[idx].value = newText
-}
-
-func initSubmitSmForm(builder *gtk.Builder, s sender.Sender) {
-	ctx := submitSmContext{
+func initSubmitSmForm(builder *gtk.Builder, s sender.Sender) *submitSmContext {
+	ctx := &submitSmContext{
 		sender:            s,
 		srcTonSelector:    getComboById(builder, "source_ton_selector"),
 		srcNpiSelector:    getComboById(builder, "source_npi_selector"),
@@ -241,6 +302,8 @@ func initSubmitSmForm(builder *gtk.Builder, s sender.Sender) {
 		rdFailCheck:       getCheckById(builder, "rd_failure"),
 		rdInterCheck:      getCheckById(builder, "rd_intermediate"),
 		messageEntry:      getTextViewById(builder, "message_input"),
+		binaryCheck:       getCheckById(builder, "binary_message_check"),
+		loadBinaryBtn:     getButtonById(builder, "load_binary_button"),
 		spltRadios: []radioBtnSplitMode{
 			{btn: getRadioById(builder, "splt_udh_radio"), mode: sender.SplitUDH},
 			{btn: getRadioById(builder, "splt_sar_radio"), mode: sender.SplitSAR},
@@ -251,22 +314,19 @@ func initSubmitSmForm(builder *gtk.Builder, s sender.Sender) {
 			{btn: getRadioById(builder, "splt_none_radio"), mode: sender.SplitNone},
 		},
 		segmentBytesEntry: getEntryById(builder, "segment_bytes_input"),
+		concatIESelector:  getComboById(builder, "concat_ie_selector"),
+		refModeSelector:   getComboById(builder, "ref_mode_selector"),
+		refEntry:          getEntryById(builder, "ref_input"),
+		portsSelector:     getComboById(builder, "port_addressing_selector"),
+		portPresetSel:     getComboById(builder, "port_preset_selector"),
+		srcPortEntry:      getEntryById(builder, "source_port_input"),
+		dstPortEntry:      getEntryById(builder, "dest_port_input"),
 		logsArea:          getTextViewById(builder, "logs_area"),
 		messageLabel:      getLabelById(builder, "submit_sm_message_label"),
 	}
 
 	msgBuf, _ := ctx.messageEntry.GetBuffer()
-	msgBuf.Connect("changed", func() {
-		msgStart, msgEnd := msgBuf.GetBounds()
-		message, _ := msgBuf.GetText(msgStart, msgEnd, true)
-		var labelText string
-		if len(message) == 1 {
-			labelText = "Message (1 character)"
-		} else {
-			labelText = fmt.Sprintf("Message (%d characters)", len(message))
-		}
-		ctx.messageLabel.SetText(labelText)
-	})
+	msgBuf.Connect("changed", ctx.updateMessageLabel)
 
 	gridI, _ := builder.GetObject("submit_sm_grid")
 	ctx.submitSmForm = gridI.(*gtk.Grid)
@@ -275,21 +335,66 @@ func initSubmitSmForm(builder *gtk.Builder, s sender.Sender) {
 	ctx.logsScroller = scrollerI.(*gtk.ScrolledWindow)
 
 	ctx.initCodingSelectors()
-	ctx.initTLVForm(builder)
+	ctx.dcs.init(builder, ctx.decCodingSelector)
+	ctx.initBinaryInput()
+	ctx.initPortsForm()
 
-	submitSmStartSessionCallback = ctx.startSession
+	ctx.refModeSelector.Connect("changed", func() {
+		refMode := submitSmRefModes[getComboIndex(ctx.refModeSelector)]
+		ctx.refEntry.SetSensitive(refMode == sender.RefExplicit)
+	})
+	initEditableForm(
+		builder,
+		editableFormIDs{
+			tree:    "tlv_form",
+			menu:    "tlv_menu",
+			addItem: "add_tlv_item",
+			delItem: "del_tlv_item",
+		},
+		[2]string{"Tag", "Value"},
+		"0000",
+		&ctx.tlvs,
+	)
+	initEditableForm(
+		builder,
+		editableFormIDs{
+			tree:    "udh_form",
+			menu:    "udh_menu",
+			addItem: "add_udh_item",
+			delItem: "del_udh_item",
+		},
+		[2]string{"IEI", "Value"},
+		"00",
+		&ctx.infoElements,
+	)
 
 	sendBtn := getButtonById(builder, "send_button")
 	sendBtn.Connect("pressed", func() {
 		ctx.resetStyles()
-		if req := ctx.getRequest(); req != nil {
-			err := ctx.session.SendMessage(req)
-			if err != nil {
-				errorDialog("Message submission error: %v", err)
-			}
+		if req := ctx.getRequest(false); req != nil {
+			// SendMessage blocks while the outstanding window is full.
+			session := ctx.session
+			go func() {
+				err := session.SendMessage(req)
+				if err != nil {
+					glib.IdleAdd(func() {
+						errorDialog("Message submission error: %v", err)
+					})
+				}
+			}()
 		}
 	})
 
+	ctx.initBulkSend(builder)
+
+	ctx.windowLabel = getLabelById(builder, "window_label")
+	glib.TimeoutAdd(250, ctx.updateWindowLabel)
+	ctx.statsLabel = getLabelById(builder, "stats_label")
+	glib.TimeoutAdd(1000, ctx.updateStatsLabel)
+	ctx.bindsLabel = getLabelById(builder, "binds_label")
+	glib.TimeoutAdd(1000, ctx.updateBindsLabel)
+	ctx.requestMarks = make(map[uint32]*gtk.TextMark)
+
 	ctx.unbindBtn = getButtonById(builder, "unbind_button")
 	ctx.unbindBtn.Connect("pressed", func() {
 		ctx.submitSmForm.SetSensitive(false)
@@ -297,38 +402,239 @@ func initSubmitSmForm(builder *gtk.Builder, s sender.Sender) {
 		if ctx.session == nil {
 			return
 		}
-		err := ctx.session.Close()
+		ctx.appendLog("Unbinding\n")
+		ctx.stopBulkSend()
+		go ctx.closeSession()
+	})
+
+	return ctx
+}
+
+func (d *dcsBuilder) init(builder *gtk.Builder, decCodingSelector *gtk.ComboBox) {
+	d.overrideSwitch = getSwitchById(builder, "dcs_override_switch")
+	d.groupSelector = getComboById(builder, "dcs_group_selector")
+	d.alphabetSelector = getComboById(builder, "dcs_alphabet_selector")
+	d.classSelector = getComboById(builder, "dcs_class_selector")
+	d.compressedSwitch = getSwitchById(builder, "dcs_compressed_switch")
+	d.indicationSel = getComboById(builder, "dcs_indication_selector")
+	d.indicationActive = getSwitchById(builder, "dcs_indication_active_switch")
+	d.rawEntry = getEntryById(builder, "dcs_raw_input")
+	d.valueLabel = getLabelById(builder, "dcs_value_label")
+	d.decCodingSelector = decCodingSelector
+
+	for _, combo := range []*gtk.ComboBox{
+		d.groupSelector,
+		d.alphabetSelector,
+		d.classSelector,
+		d.indicationSel,
+	} {
+		combo.Connect("changed", d.update)
+	}
+	for _, sw := range []*gtk.Switch{d.overrideSwitch, d.compressedSwitch, d.indicationActive} {
+		sw.Connect("notify::active", d.update)
+	}
+	d.rawEntry.Connect("changed", d.update)
+	d.update()
+}
+
+func (d *dcsBuilder) update() {
+	d.decCodingSelector.SetSensitive(!d.overrideSwitch.GetActive())
+
+	group := coding.AllDCSGroups[getComboIndex(d.groupSelector)]
+	isGeneral := group == coding.DCSGeneral
+	isMWI := group == coding.DCSMWIDiscard || group == coding.DCSMWIStoreGSM7 ||
+		group == coding.DCSMWIStoreUCS2
+	isDataClass := group == coding.DCSDataClass
+
+	d.alphabetSelector.SetSensitive(isGeneral || isDataClass)
+	d.classSelector.SetSensitive(isGeneral || isDataClass)
+	d.compressedSwitch.SetSensitive(isGeneral)
+	d.indicationSel.SetSensitive(isMWI)
+	d.indicationActive.SetSensitive(isMWI)
+	d.rawEntry.SetSensitive(group == coding.DCSRaw)
+
+	dcs, ok := d.get()
+	b, err := dcs.Byte()
+	if ok && err == nil {
+		d.valueLabel.SetText(fmt.Sprintf("0x%02X", b))
+	} else {
+		d.valueLabel.SetText("invalid")
+	}
+}
+
+func (d *dcsBuilder) get() (coding.DCS, bool) {
+	dcs := coding.DCS{
+		Group:            coding.AllDCSGroups[getComboIndex(d.groupSelector)],
+		Alphabet:         coding.AllAlphabets[getComboIndex(d.alphabetSelector)],
+		Class:            coding.AllMessageClasses[getComboIndex(d.classSelector)],
+		Compressed:       d.compressedSwitch.GetActive(),
+		IndicationActive: d.indicationActive.GetActive(),
+		Indication:       coding.AllIndications[getComboIndex(d.indicationSel)],
+	}
+
+	if dcs.Group == coding.DCSRaw {
+		text, _ := d.rawEntry.GetText()
+		raw, err := strconv.ParseUint(text, 16, 8)
+		if err != nil {
+			return dcs, false
+		}
+		dcs.Raw = byte(raw)
+	}
+
+	return dcs, true
+}
+
+func (ctx *submitSmContext) initBinaryInput() {
+	ctx.binaryCheck.Connect("toggled", func() {
+		isBinary := ctx.binaryCheck.GetActive()
+		ctx.loadBinaryBtn.SetSensitive(isBinary)
+		ctx.updateMessageLabel()
+
+		if !isBinary || ctx.effectiveCoding == coding.Octet1 ||
+			ctx.effectiveCoding == coding.Octet2 {
+			return
+		}
+
+		for i, cod := range ctx.supportedCodings {
+			if cod == coding.Octet2 {
+				ctx.effCodingSelector.SetActive(i)
+				break
+			}
+		}
+	})
+
+	ctx.loadBinaryBtn.Connect("pressed", func() {
+		dialog, err := gtk.FileChooserDialogNewWith2Buttons(
+			"Load binary message",
+			mainWindow,
+			gtk.FILE_CHOOSER_ACTION_OPEN,
+			"Cancel",
+			gtk.RESPONSE_CANCEL,
+			"Open",
+			gtk.RESPONSE_ACCEPT,
+		)
 		if err != nil {
-			errorDialog("Session closing error: %v", err)
+			errorDialog("Failed to create file chooser: %v", err)
+			return
+		}
+		defer dialog.Destroy()
+
+		if dialog.Run() != gtk.RESPONSE_ACCEPT {
+			return
+		}
+
+		content, err := os.ReadFile(dialog.GetFilename())
+		if err != nil {
+			errorDialog("Failed to load binary message: %v", err)
+			return
 		}
+
+		msgBuf, _ := ctx.messageEntry.GetBuffer()
+		msgBuf.SetText(hex.EncodeToString(content))
 	})
 }
 
-func (ctx *submitSmContext) startSession(acc *account.Account) {
-	buf, err := ctx.logsArea.GetBuffer()
-	if err != nil {
-		return
+func (ctx *submitSmContext) initPortsForm() {
+	ctx.portPresetSel.Connect("changed", func() {
+		idx := getComboIndex(ctx.portPresetSel)
+		if idx == 0 {
+			return
+		}
+
+		preset := submitSmPortPresets[idx]
+		ctx.portsSelector.SetActive(slices.Index(submitSmPortAddressings, sender.Ports16Bit))
+		ctx.srcPortEntry.SetText(strconv.Itoa(int(preset.source)))
+		ctx.dstPortEntry.SetText(strconv.Itoa(int(preset.destination)))
+	})
+}
+
+func (ctx *submitSmContext) updateMessageLabel() {
+	message := ctx.getMessageText()
+
+	var labelText string
+	if ctx.binaryCheck.GetActive() {
+		size := len(strings.Join(strings.Fields(message), "")) / 2
+		if size == 1 {
+			labelText = "Message (1 byte)"
+		} else {
+			labelText = fmt.Sprintf("Message (%d bytes)", size)
+		}
+	} else if len(message) == 1 {
+		labelText = "Message (1 character)"
+	} else {
+		labelText = fmt.Sprintf("Message (%d characters)", len(message))
 	}
-	logsStart, logsEnd := buf.GetBounds()
-	buf.Delete(logsStart, logsEnd)
+	ctx.messageLabel.SetText(labelText)
+}
 
-	if ctx.session != nil {
-		err = ctx.session.Close()
-		if err != nil {
-			errorDialog("Session closing error: %v", err)
+func (ctx *submitSmContext) getMessageText() string {
+	msgBuf, _ := ctx.messageEntry.GetBuffer()
+	msgStart, msgEnd := msgBuf.GetBounds()
+	message, _ := msgBuf.GetText(msgStart, msgEnd, true)
+	return message
+}
+
+// startSession binds the account off the main loop, so that slow binds don't
+// freeze the window, and calls done on the main loop once bound or failed.
+func (ctx *submitSmContext) startSession(orig *account.Account, done func(error)) {
+	// The account list may be edited while binding.
+	acc := new(account.Account)
+	*acc = *orig
+	go func() {
+		session, err := ctx.sender.StartSession(
+			acc,
+			ctx.pduHandler,
+			ctx.sessionCloseHandler,
+			ctx.reconnectHandler,
+			ctx.stateHandler,
+		)
+		glib.IdleAdd(func() {
+			if err == nil {
+				ctx.sessionStarted(session)
+			}
+			done(err)
+		})
+	}()
+}
+
+func (ctx *submitSmContext) sessionStarted(session sender.Session) {
+	// The session is kept once closed, so that handlers never see it
+	// swapped. Its state tells whether it is usable.
+	ctx.session = session
+
+	binds := session.Binds()
+	for i, bind := range binds {
+		if len(binds) > 1 {
+			ctx.appendLog(fmt.Sprintf("Bind %d: bound to %s\n", i+1, bind.Endpoint))
+		} else {
+			ctx.appendLog(fmt.Sprintf("Bound to %s\n", bind.Endpoint))
 		}
 	}
+}
+
+// close closes the session and stops updating the form, once its tab is
+// closed.
+func (ctx *submitSmContext) close() {
+	ctx.closed = true
+	ctx.stopBulkSend()
+	if ctx.session == nil {
+		return
+	}
+	go ctx.closeSession()
+}
 
-	ctx.session, err = ctx.sender.StartSession(acc, ctx.pduHandler, ctx.sessionCloseHandler)
+// closeSession waits for the session to drain and unbind, so it must not
+// run on the main loop.
+func (ctx *submitSmContext) closeSession() {
+	err := ctx.session.Close()
 	if err != nil {
-		errorDialog("Failed to start SMPP session: %v", err)
-		return
+		glib.IdleAdd(func() { errorDialog("Session closing error: %v", err) })
 	}
-	ctx.submitSmForm.SetSensitive(true)
-	ctx.unbindBtn.SetSensitive(true)
 }
 
 func (ctx *submitSmContext) pduHandler(dir sender.Direction, pdu sender.PDU) {
+	ctx.bulkPDUHandler(dir, pdu)
+
 	var dirStr string
 	if dir == sender.Inbound {
 		dirStr = "Incoming PDU"
@@ -360,6 +666,9 @@ func (ctx *submitSmContext) pduHandler(dir sender.Direction, pdu sender.PDU) {
 				req.Sequence,
 			)
 		}
+		if req.Retry > 0 {
+			log += fmt.Sprintf("    Retry: %d\n", req.Retry)
+		}
 	case *sender.SubmitSMRespPDU:
 		log = fmt.Sprintf(
 			"%s\n    Command: %v\n    Status: %v\n   Sequence: %d\n    "+
@@ -392,6 +701,9 @@ func (ctx *submitSmContext) pduHandler(dir sender.Direction, pdu sender.PDU) {
 			req.Message,
 			req.MessageID,
 		)
+	case *sender.NoResponsePDU:
+		glib.IdleAdd(func() { ctx.markNoResponse(req) })
+		return
 	case *sender.GenericPDU:
 		if req.Command == sender.EnquireLink || req.Command == sender.EnquireLinkResp {
 			return
@@ -406,29 +718,227 @@ func (ctx *submitSmContext) pduHandler(dir sender.Direction, pdu sender.PDU) {
 		)
 	}
 
+	hdr := pdu.GetHeader()
 	glib.IdleAdd(func() {
-		buf, err := ctx.logsArea.GetBuffer()
-		if err != nil {
+		if dir == sender.Outbound && hdr.Command == sender.SubmitSM {
+			ctx.appendRequestLog(hdr.Sequence, dirStr, log)
 			return
 		}
-		buf.Insert(buf.GetEndIter(), log)
-		vadg := ctx.logsScroller.GetVAdjustment()
-		vadg.SetValue(vadg.GetUpper())
+
+		isResp := hdr.Command == sender.SubmitSMResp || hdr.Command == sender.GenericNack
+		if dir == sender.Inbound && isResp {
+			ctx.dropRequestMark(hdr.Sequence)
+		}
+		ctx.appendLog(log)
+	})
+}
+
+// appendRequestLog appends log of a request and marks the end of its first
+// line, so that missing response can be reported next to it.
+func (ctx *submitSmContext) appendRequestLog(seq uint32, title string, log string) {
+	buf, err := ctx.logsArea.GetBuffer()
+	if err != nil {
+		return
+	}
+
+	offset := buf.GetEndIter().GetOffset()
+	ctx.appendLog(log)
+
+	ctx.dropRequestMark(seq)
+	iter := buf.GetIterAtOffset(offset + utf8.RuneCountInString(title))
+	ctx.requestMarks[seq] = buf.CreateMark(fmt.Sprintf("request-%d", seq), iter, true)
+}
+
+func (ctx *submitSmContext) dropRequestMark(seq uint32) {
+	mark, ok := ctx.requestMarks[seq]
+	if !ok {
+		return
+	}
+	delete(ctx.requestMarks, seq)
+
+	buf, err := ctx.logsArea.GetBuffer()
+	if err != nil {
+		return
+	}
+	buf.DeleteMark(mark)
+}
+
+func (ctx *submitSmContext) markNoResponse(req *sender.NoResponsePDU) {
+	buf, err := ctx.logsArea.GetBuffer()
+	if err != nil {
+		return
+	}
+
+	if mark, ok := ctx.requestMarks[req.Sequence]; ok {
+		buf.Insert(buf.GetIterAtMark(mark), fmt.Sprintf(" (no response within %v)", req.Timeout))
+		ctx.dropRequestMark(req.Sequence)
+		return
+	}
+
+	ctx.appendLog(fmt.Sprintf(
+		"No response\n    Command: %v\n    Sequence: %d\n    Timeout: %v\n",
+		req.Command,
+		req.Sequence,
+		req.Timeout,
+	))
+}
+
+func (ctx *submitSmContext) updateStatsLabel() bool {
+	if ctx.closed {
+		return false
+	}
+	if ctx.session == nil {
+		ctx.statsLabel.SetText("")
+		return true
+	}
+
+	var text strings.Builder
+	for _, stats := range ctx.session.Stats() {
+		fmt.Fprintf(
+			&text,
+			"%v: %d responses, %d missing\n",
+			stats.Command,
+			stats.Count,
+			stats.Missing,
+		)
+		if stats.Count > 0 {
+			fmt.Fprintf(
+				&text,
+				"    min %v, avg %v\n    p95 %v, p99 %v\n",
+				roundLatency(stats.Min),
+				roundLatency(stats.Avg),
+				roundLatency(stats.P95),
+				roundLatency(stats.P99),
+			)
+		}
+	}
+	ctx.statsLabel.SetText(strings.TrimSuffix(text.String(), "\n"))
+	return true
+}
+
+// updateBindsLabel shows status of every bind, if the session has several
+// of them.
+func (ctx *submitSmContext) updateBindsLabel() bool {
+	if ctx.closed {
+		return false
+	}
+	if ctx.session == nil {
+		ctx.bindsLabel.SetText("")
+		return true
+	}
+
+	binds := ctx.session.Binds()
+	if len(binds) < 2 {
+		ctx.bindsLabel.SetText("")
+		return true
+	}
+
+	var text strings.Builder
+	for i, bind := range binds {
+		state := bind.State.String()
+		if bind.ReceiverDown {
+			state += " (receiver reconnecting)"
+		}
+		fmt.Fprintf(
+			&text,
+			"Bind %d: %s, sent %d, received %d, in flight %d\n",
+			i+1,
+			state,
+			bind.Sent,
+			bind.Received,
+			bind.InFlight,
+		)
+	}
+	ctx.bindsLabel.SetText(strings.TrimSuffix(text.String(), "\n"))
+	return true
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	return d.Round(100 * time.Microsecond)
+}
+
+func (ctx *submitSmContext) updateWindowLabel() bool {
+	if ctx.closed {
+		return false
+	}
+	if ctx.session == nil {
+		ctx.windowLabel.SetText("")
+		return true
+	}
+
+	inFlight, size := ctx.session.InFlight()
+	if size > 0 {
+		ctx.windowLabel.SetText(fmt.Sprintf("In flight: %d/%d", inFlight, size))
+	} else {
+		ctx.windowLabel.SetText(fmt.Sprintf("In flight: %d", inFlight))
+	}
+	return true
+}
+
+func (ctx *submitSmContext) appendLog(log string) {
+	buf, err := ctx.logsArea.GetBuffer()
+	if err != nil {
+		return
+	}
+	buf.Insert(buf.GetEndIter(), log)
+	vadg := ctx.logsScroller.GetVAdjustment()
+	vadg.SetValue(vadg.GetUpper())
+}
+
+func (ctx *submitSmContext) reconnectHandler(ev sender.ReconnectEvent) {
+	var msg string
+	switch ev.State {
+	case sender.Reconnecting:
+		attempts := "unlimited"
+		if ev.MaxAttempts > 0 {
+			attempts = strconv.Itoa(ev.MaxAttempts)
+		}
+		msg = fmt.Sprintf(
+			"Connection lost: %v. Reconnecting in %v (attempt %d/%s)\n",
+			ev.Err,
+			ev.Delay,
+			ev.Attempt,
+			attempts,
+		)
+	case sender.Reconnected:
+		msg = fmt.Sprintf(
+			"Reconnected to %s after %d attempt(s)\n",
+			ev.Endpoint,
+			ev.Attempt,
+		)
+	}
+	if ev.ReceiveOnly {
+		msg = fmt.Sprintf("Receiver: %s", msg)
+	}
+	if ev.Bind > 0 {
+		msg = fmt.Sprintf("Bind %d: %s", ev.Bind, msg)
+	}
+
+	glib.IdleAdd(func() { ctx.appendLog(msg) })
+}
+
+// stateHandler makes the form available only while the session is bound.
+// The session stays bound while any of its binds is bound.
+func (ctx *submitSmContext) stateHandler(state sender.SessionState) {
+	glib.IdleAdd(func() {
+		ctx.submitSmForm.SetSensitive(state == sender.StateBound)
+		ctx.unbindBtn.SetSensitive(
+			state == sender.StateBound || state == sender.StateReconnecting,
+		)
 	})
 }
 
 func (ctx *submitSmContext) sessionCloseHandler(err error) {
 	glib.IdleAdd(func() {
-		ctx.session = nil
-		ctx.submitSmForm.SetSensitive(false)
-		ctx.unbindBtn.SetSensitive(false)
-		if err != nil {
+		if err != nil && !ctx.closed {
 			errorDialog("SMPP session error: %v", err)
 		}
 	})
 }
 
-func (ctx *submitSmContext) getRequest() *sender.Request {
+// getRequest reads the request from the form. Destination address is left
+// empty for bulk jobs, which take it from CSV.
+func (ctx *submitSmContext) getRequest(forBulk bool) *sender.Request {
 	req := &sender.Request{}
 
 	var ok bool
@@ -440,22 +950,75 @@ func (ctx *submitSmContext) getRequest() *sender.Request {
 
 	req.Destination.TON = ctx.getTON(ctx.dstTonSelector)
 	req.Destination.NPI = ctx.getNPI(ctx.dstNpiSelector)
-	req.Destination.Addr, ok = checkEntryPresence(ctx.dstAddrEntry, "Destination Address")
-	isValid = isValid && ok
+	if !forBulk {
+		req.Destination.Addr, ok = checkEntryPresence(ctx.dstAddrEntry, "Destination Address")
+		isValid = isValid && ok
+	}
 	req.ValidityPeriod, _ = ctx.validityEntry.GetText()
 	req.EffectiveCoding = ctx.effectiveCoding
 	req.DeceptiveCoding = ctx.getDeceptiveCoding()
+	req.OverrideDataCoding = ctx.dcs.overrideSwitch.GetActive()
+	if req.OverrideDataCoding {
+		dcs, ok := ctx.dcs.get()
+		if !ok {
+			markInvalidEntry(&ctx.dcs.rawEntry.Widget, "Raw value must be a hex byte")
+			isValid = false
+		}
+		var err error
+		req.DataCoding, err = dcs.Byte()
+		if err != nil {
+			markInvalidEntry(&ctx.dcs.classSelector.Widget, err.Error())
+			isValid = false
+		}
+	}
 	req.RegisteredDelivery = ctx.getRegisteredDelivery()
 	req.SplitMode = ctx.getSplitMode()
 
-	msgBuf, _ := ctx.messageEntry.GetBuffer()
-	msgStart, msgEnd := msgBuf.GetBounds()
-	req.Message, _ = msgBuf.GetText(msgStart, msgEnd, true)
+	req.IsBinary = ctx.binaryCheck.GetActive()
+	if req.IsBinary {
+		hexMessage := strings.Join(strings.Fields(ctx.getMessageText()), "")
+		binaryMessage, err := hex.DecodeString(hexMessage)
+		if err != nil {
+			markInvalidEntry(&ctx.messageEntry.Widget, "Binary message must be a hex string")
+			isValid = false
+		}
+		req.BinaryMessage = binaryMessage
+	} else {
+		req.Message = ctx.getMessageText()
+	}
 
 	segmentBytesU64, ok := checkEntryNumerical(ctx.segmentBytesEntry, 8, "Bytes per segment")
 	isValid = isValid && ok
 	req.BytePerSegment = int(segmentBytesU64)
 
+	req.ConcatIE = submitSmConcatIEs[getComboIndex(ctx.concatIESelector)]
+	req.RefMode = submitSmRefModes[getComboIndex(ctx.refModeSelector)]
+	if req.RefMode == sender.RefExplicit {
+		refBits := 16
+		if req.SplitMode == sender.SplitUDH && req.ConcatIE == sender.Concat8Bit {
+			refBits = 8
+		}
+
+		refU64, ok := checkEntryNumerical(ctx.refEntry, refBits, "Reference number")
+		isValid = isValid && ok
+		req.Ref = uint16(refU64)
+	}
+
+	req.Ports.Addressing = submitSmPortAddressings[getComboIndex(ctx.portsSelector)]
+	if req.Ports.Addressing != sender.PortsNone {
+		bits := 16
+		if req.Ports.Addressing == sender.Ports8Bit {
+			bits = 8
+		}
+
+		srcPort, ok := checkEntryNumerical(ctx.srcPortEntry, bits, "Source port")
+		isValid = isValid && ok
+		dstPort, ok := checkEntryNumerical(ctx.dstPortEntry, bits, "Destination port")
+		isValid = isValid && ok
+		req.Ports.Source = uint16(srcPort)
+		req.Ports.Destination = uint16(dstPort)
+	}
+
 	for _, tlv := range ctx.tlvs {
 		tag, err := strconv.ParseUint(tlv.tag, 16, 16)
 		if err != nil {
@@ -474,6 +1037,27 @@ func (ctx *submitSmContext) getRequest() *sender.Request {
 		req.Optional = append(req.Optional, sender.TLV{Tag: uint16(tag), Value: value})
 	}
 
+	for _, ie := range ctx.infoElements {
+		id, err := strconv.ParseUint(ie.tag, 16, 8)
+		if err != nil {
+			errorDialog("Invalid UDH IEI: %v", err)
+			isValid = false
+			break
+		}
+
+		value, err := hex.DecodeString(ie.value)
+		if err != nil {
+			errorDialog("Invalid UDH IE value: %v", err)
+			isValid = false
+			break
+		}
+
+		req.InfoElements = append(
+			req.InfoElements,
+			sender.InfoElement{ID: byte(id), Value: value},
+		)
+	}
+
 	if isValid {
 		return req
 	}
@@ -485,7 +1069,13 @@ func (ctx *submitSmContext) resetStyles() {
 	widgets := []*gtk.Widget{
 		&ctx.srcAddrEntry.Widget,
 		&ctx.dstAddrEntry.Widget,
+		&ctx.messageEntry.Widget,
 		&ctx.segmentBytesEntry.Widget,
+		&ctx.dcs.rawEntry.Widget,
+		&ctx.dcs.classSelector.Widget,
+		&ctx.refEntry.Widget,
+		&ctx.srcPortEntry.Widget,
+		&ctx.dstPortEntry.Widget,
 	}
 	for _, widget := range widgets {
 		widget.SetTooltipText("")
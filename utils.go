@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/gotk3/gotk3/gtk"
 )
@@ -100,6 +101,16 @@ func getMenuById(b *gtk.Builder, id string) *gtk.Menu {
 	return v.(*gtk.Menu)
 }
 
+func getNotebookById(b *gtk.Builder, id string) *gtk.Notebook {
+	v, _ := b.GetObject(id)
+	return v.(*gtk.Notebook)
+}
+
+func getBoxById(b *gtk.Builder, id string) *gtk.Box {
+	v, _ := b.GetObject(id)
+	return v.(*gtk.Box)
+}
+
 func markInvalidEntry(e *gtk.Widget, tip string) {
 	e.SetTooltipText(tip)
 	ctx, _ := e.GetStyleContext()
@@ -135,3 +146,17 @@ func checkEntryNumerical(e *gtk.Entry, bits int, name string) (uint64, bool) {
 	}
 	return val, true
 }
+
+func checkEntryDuration(e *gtk.Entry, name string) (time.Duration, bool) {
+	text, ok := checkEntryPresence(e, name)
+	if !ok {
+		return 0, false
+	}
+
+	val, err := time.ParseDuration(text)
+	if err != nil || val < 0 {
+		markInvalidEntry(&e.Widget, fmt.Sprintf("%s must be a duration like 500ms, 1s or 1m", name))
+		return 0, false
+	}
+	return val, true
+}